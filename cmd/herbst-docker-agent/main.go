@@ -2,34 +2,64 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"herbst/internal/docker"
 	"herbst/internal/proto"
+	"herbst/internal/sysinfo"
 
 	"nhooyr.io/websocket"
 )
 
+// Version is set at build time via -ldflags
+var Version = "dev"
+
 func main() {
 	herbstURL := os.Getenv("HERBST_URL")
 	token := os.Getenv("HERBST_TOKEN")
 	nodeName := os.Getenv("NODE_NAME")
-	if nodeName == "" {
-		nodeName = "docker-node"
-	}
 
 	if herbstURL == "" {
 		log.Fatal("HERBST_URL is required")
 	}
-	if token == "" {
-		log.Fatal("HERBST_TOKEN is required")
+
+	// Client certificate for mTLS; herbst then takes the node name from its CN
+	tlsCfg, certName, err := loadTLSConfig(os.Getenv("HERBST_TLS_CERT"), os.Getenv("HERBST_TLS_KEY"), os.Getenv("HERBST_TLS_CA"))
+	if err != nil {
+		log.Fatalf("TLS setup failed: %v", err)
+	}
+	if certName != "" {
+		if nodeName != "" && nodeName != certName {
+			log.Printf("NODE_NAME %q ignored, the client certificate is issued to %q", nodeName, certName)
+		}
+		nodeName = certName
+	}
+	if nodeName == "" {
+		nodeName = "docker-node"
+	}
+	if token == "" && certName == "" {
+		log.Fatal("HERBST_TOKEN or HERBST_TLS_CERT/HERBST_TLS_KEY is required")
+	}
+
+	var dialOpts *websocket.DialOptions
+	if tlsCfg != nil {
+		dialOpts = &websocket.DialOptions{
+			HTTPClient: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}},
+		}
 	}
 
 	socketPath := os.Getenv("DOCKER_SOCKET")
@@ -37,30 +67,81 @@ func main() {
 		socketPath = "/var/run/docker.sock"
 	}
 
-	log.Printf("starting herbst-docker-agent for node=%q, url=%q, socket=%q",
-		nodeName, herbstURL, socketPath)
+	// Container changes are pushed from Docker events, the periodic re-list is only a safety net
+	resyncInterval := 30 * time.Second
+	if v := os.Getenv("RESYNC_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			log.Fatalf("invalid RESYNC_INTERVAL %q: use a duration like 30s or 2m", v)
+		}
+		resyncInterval = d
+	}
+
+	// Send only changes after the first snapshot (used if herbst accepts it in the handshake)
+	deltaUpdates := true
+	if v := os.Getenv("DELTA_UPDATES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid DELTA_UPDATES %q: use true or false", v)
+		}
+		deltaUpdates = b
+	}
 
-	httpClient := &http.Client{
-		Transport: &http.Transport{
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				return net.Dial("unix", socketPath)
-			},
-		},
-		Timeout: 8 * time.Second,
+	// Host metrics (CPU, memory, disk, load, uptime), 0 disables them
+	metricsInterval := 10 * time.Second
+	if v := os.Getenv("METRICS_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || (d != 0 && d < time.Second) {
+			log.Fatalf("invalid METRICS_INTERVAL %q: use a duration like 10s, or 0 to disable", v)
+		}
+		metricsInterval = d
+	}
+	// Container stats are sampled in the background at this interval
+	statsInterval := 10 * time.Second
+	if v := os.Getenv("STATS_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			log.Fatalf("invalid STATS_INTERVAL %q: use a duration like 10s or 1m", v)
+		}
+		statsInterval = d
+	}
+	// Comma-separated lists, DISKS=all monitors every real filesystem
+	metricsOpts := sysinfo.Options{
+		Disks:      splitList(os.Getenv("DISKS")),
+		Interfaces: splitList(os.Getenv("NET_INTERFACES")),
 	}
 
+	log.Printf("starting herbst-docker-agent for node=%q, url=%q, socket=%q, resync=%s, delta=%t, metrics=%s, stats=%s",
+		nodeName, herbstURL, socketPath, resyncInterval, deltaUpdates, metricsInterval, statsInterval)
+
+	dockerClient := docker.NewClient(socketPath)
+
 	// Graceful shutdown
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// CPU usage and network rates are measured in the background
+	var sampler *sysinfo.Sampler
+	if metricsInterval > 0 {
+		sampler = sysinfo.NewSampler()
+		sampler.Start(ctx, time.Second)
+	}
+
 	for {
 		if ctx.Err() != nil {
 			log.Println("shutdown requested, exiting agent loop")
 			return
 		}
 
-		if err := runOnce(ctx, herbstURL, token, nodeName, httpClient); err != nil {
+		backoff := 5 * time.Second
+		mr := &metricsReporter{nodeName: nodeName, sampler: sampler, opts: metricsOpts, interval: metricsInterval}
+		if err := runOnce(ctx, herbstURL, dialOpts, token, nodeName, dockerClient, resyncInterval, statsInterval, deltaUpdates, mr); err != nil {
 			log.Printf("agent cycle ended with error: %v", err)
+			// Retrying quickly will not fix a version mismatch
+			var rejected *rejectedError
+			if errors.As(err, &rejected) {
+				backoff = time.Minute
+			}
 		} else {
 			log.Println("agent cycle ended without explicit error")
 		}
@@ -70,17 +151,72 @@ func main() {
 		case <-ctx.Done():
 			log.Println("shutdown requested during backoff, exiting")
 			return
-		case <-time.After(5 * time.Second):
+		case <-time.After(backoff):
 		}
 	}
 }
 
-func runOnce(ctx context.Context, herbstURL, token, nodeName string, httpClient *http.Client) error {
+// loadTLSConfig builds the client TLS config from PEM files. The CA file pins
+// the server certificate to the herbst agent CA instead of the system roots.
+// It returns nil if no TLS files are set, and the certificate CN if a client
+// certificate is used.
+func loadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, string, error) {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil, "", nil
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, "", errors.New("HERBST_TLS_CERT and HERBST_TLS_KEY must be set together")
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, "", err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, "", fmt.Errorf("%s: no PEM certificates found", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	var certName string
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, "", err
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, "", err
+		}
+		if time.Now().After(leaf.NotAfter) {
+			log.Printf("warning: client certificate expired on %s", leaf.NotAfter.Format("2006-01-02"))
+		}
+		certName = leaf.Subject.CommonName
+
+		// Re-read on every handshake, so a renewed certificate is picked up without restart
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				log.Printf("reloading client certificate failed, using the previous one: %v", err)
+				return &cert, nil
+			}
+			return &c, nil
+		}
+	}
+
+	return cfg, certName, nil
+}
+
+func runOnce(ctx context.Context, herbstURL string, dialOpts *websocket.DialOptions, token, nodeName string, dc *docker.Client, resyncInterval, statsInterval time.Duration, deltaUpdates bool, mr *metricsReporter) error {
 	// eigene Connect-Deadline
 	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	c, _, err := websocket.Dial(dialCtx, herbstURL, nil)
+	c, _, err := websocket.Dial(dialCtx, herbstURL, dialOpts)
 	if err != nil {
 		return err
 	}
@@ -88,98 +224,541 @@ func runOnce(ctx context.Context, herbstURL, token, nodeName string, httpClient
 
 	log.Printf("Connected to %s as node %q", herbstURL, nodeName)
 
+	caps := []string{proto.CapCommands, proto.CapLogsFollow, proto.CapContainerStats}
+	if deltaUpdates {
+		caps = append(caps, proto.CapContainersDelta)
+	}
+	if mr.interval > 0 {
+		caps = append(caps, proto.CapMetrics)
+	}
+
 	hello := proto.HelloMessage{
-		Type:     "hello",
-		NodeName: nodeName,
-		Token:    token,
-		Kind:     "docker",
+		Type:         "hello",
+		NodeName:     nodeName,
+		Token:        token,
+		Kind:         "docker",
+		Version:      proto.ProtocolVersion,
+		Capabilities: caps,
+		AgentVersion: Version,
 	}
 	if err := sendJSON(ctx, c, hello); err != nil {
 		return wrapErr("failed to send hello", err)
 	}
 	log.Println("Hello sent")
 
-	ticker := time.NewTicker(5 * time.Second)
+	// Connection-scoped context: ends when the server goes away or we shut down
+	ctx, cancelConn := context.WithCancel(ctx)
+	defer cancelConn()
+
+	// Until herbst answers with a welcome we speak protocol 1 (full snapshots only),
+	// older servers never send one
+	cs := &containerSync{c: c, dc: dc, nodeName: nodeName}
+
+	// Commands from herbst arrive on the same connection
+	readErr := make(chan error, 1)
+	welcome := make(chan proto.WelcomeMessage, 1)
+	go func() {
+		readErr <- readLoop(ctx, c, dc, cs, welcome)
+		cancelConn()
+	}()
+
+	// Docker events trigger an immediate update
+	changed := make(chan struct{}, 1)
+	go dc.WatchContainers(ctx, 250*time.Millisecond, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	// Initial snapshot right after connecting
+	if err := cs.send(ctx, true); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(resyncInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			select {
+			case err := <-readErr:
+				return wrapErr("connection closed", err)
+			default:
+				return ctx.Err()
+			}
 
-		case <-ticker.C:
-			containers, err := fetchDockerContainers(ctx, httpClient)
-			if err != nil {
-				log.Printf("failed to list containers: %v", err)
-				// Kein Abbruch, einfach beim nächsten Tick nochmal probieren
-				continue
+		case <-changed:
+			if err := cs.send(ctx, false); err != nil {
+				return err
 			}
 
-			msg := proto.ContainersMessage{
-				Type:       "containers",
-				NodeName:   nodeName,
-				Containers: containers,
+		case wm := <-welcome:
+			// Metrics are only sent to servers that accepted them
+			if slices.Contains(wm.Capabilities, proto.CapMetrics) {
+				go mr.run(ctx, c)
+			}
+			// Same for container stats, sampling them is too slow to do on every send
+			if slices.Contains(wm.Capabilities, proto.CapContainerStats) {
+				go cs.sampleStats(ctx, statsInterval)
 			}
 
-			if err := sendJSON(ctx, c, msg); err != nil {
+		case <-ticker.C:
+			// Re-list in case an event was missed; in delta mode only the differences
+			// are sent, sequence numbers let herbst ask for a snapshot on a gap
+			if err := cs.send(ctx, false); err != nil {
 				// typischer Fall: broken pipe / server weg / unauthorized -> runOnce beendet sich,
 				// main-Loop macht Reconnect
-				return wrapErr("failed to send containers", err)
+				return err
 			}
-
-			log.Printf("Sent %d containers for node %q", len(containers), nodeName)
 		}
 	}
 }
 
-func fetchDockerContainers(ctx context.Context, client *http.Client) ([]proto.Container, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/json?all=true", nil)
+// containerSync pushes the container list to herbst. In delta mode only the
+// first message (and every explicit resync) is a full snapshot, everything in
+// between is sent as added/changed/removed deltas with increasing sequence numbers.
+type containerSync struct {
+	c        *websocket.Conn
+	dc       *docker.Client
+	nodeName string
+	delta    bool
+
+	mu    sync.Mutex // serializes sends so sequence numbers arrive in order
+	seq   uint64
+	last  map[string]proto.Container // what herbst has, nil until the first snapshot
+	stats *docker.StatsCache         // nil unless herbst accepted container stats
+}
+
+// send lists local containers and pushes them to herbst, as a snapshot if full is set.
+// Docker errors are only logged, write errors are returned.
+func (cs *containerSync) send(ctx context.Context, full bool) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.sendLocked(ctx, full)
+}
+
+func (cs *containerSync) sendLocked(ctx context.Context, full bool) error {
+	containers, err := cs.dc.ListContainers(ctx)
 	if err != nil {
-		return nil, err
+		log.Printf("failed to list containers: %v", err)
+		// Kein Abbruch, einfach beim nächsten Tick nochmal probieren
+		return nil
+	}
+	if cs.stats != nil {
+		cs.stats.Attach(containers)
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	if !cs.delta || full || cs.last == nil {
+		return cs.sendSnapshot(ctx, containers)
+	}
+	return cs.sendDelta(ctx, containers)
+}
+
+func (cs *containerSync) sendSnapshot(ctx context.Context, containers []proto.Container) error {
+	msg := proto.ContainersMessage{
+		Type:       "containers",
+		NodeName:   cs.nodeName,
+		Containers: containers,
+	}
+	if cs.delta {
+		cs.seq++
+		msg.Seq = cs.seq
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		return nil, wrapErr("docker API returned error status", errStatus(resp.StatusCode))
+	if err := sendJSON(ctx, cs.c, msg); err != nil {
+		// Unknown what herbst received, start over with a snapshot
+		cs.last = nil
+		return wrapErr("failed to send containers", err)
 	}
 
-	var raw []struct {
-		ID      string   `json:"Id"`
-		Names   []string `json:"Names"`
-		Image   string   `json:"Image"`
-		State   string   `json:"State"`
-		Status  string   `json:"Status"`
-		Created int64    `json:"Created"`
+	cs.last = make(map[string]proto.Container, len(containers))
+	for _, ct := range containers {
+		cs.last[ct.ID] = ct
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
-		return nil, err
+
+	log.Printf("Sent %d containers for node %q", len(containers), cs.nodeName)
+	return nil
+}
+
+func (cs *containerSync) sendDelta(ctx context.Context, containers []proto.Container) error {
+	msg := proto.ContainersDeltaMessage{
+		Type:     "containers_delta",
+		NodeName: cs.nodeName,
 	}
 
-	out := make([]proto.Container, 0, len(raw))
-	for _, c := range raw {
-		name := c.ID
-		if len(c.Names) > 0 {
-			name = strings.TrimPrefix(c.Names[0], "/")
-		} else if len(c.ID) >= 12 {
-			name = c.ID[:12]
+	current := make(map[string]proto.Container, len(containers))
+	for _, ct := range containers {
+		current[ct.ID] = ct
+		prev, ok := cs.last[ct.ID]
+		switch {
+		case !ok:
+			msg.Added = append(msg.Added, ct)
+		case !sameContainer(prev, ct):
+			msg.Changed = append(msg.Changed, ct)
+		default:
+			// herbst keeps the stats it got last
+			current[ct.ID] = prev
 		}
+	}
+	for id := range cs.last {
+		if _, ok := current[id]; !ok {
+			msg.Removed = append(msg.Removed, id)
+		}
+	}
 
-		out = append(out, proto.Container{
-			ID:      c.ID,
-			Name:    name,
-			Image:   c.Image,
-			State:   c.State,
-			Status:  c.Status,
-			Created: c.Created,
+	if len(msg.Added)+len(msg.Changed)+len(msg.Removed) == 0 {
+		return nil
+	}
+
+	cs.seq++
+	msg.Seq = cs.seq
+	if err := sendJSON(ctx, cs.c, msg); err != nil {
+		cs.last = nil
+		return wrapErr("failed to send container delta", err)
+	}
+	cs.last = current
+
+	log.Printf("Sent delta #%d for node %q: %d added, %d changed, %d removed",
+		msg.Seq, cs.nodeName, len(msg.Added), len(msg.Changed), len(msg.Removed))
+	return nil
+}
+
+// enableDelta switches to delta mode; the next send after the current snapshot is a delta
+func (cs *containerSync) enableDelta() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.delta = true
+}
+
+// sampleStats refreshes the container stats until ctx ends and sends the
+// ones that changed after every round. Write errors end the connection
+// through the read loop.
+func (cs *containerSync) sampleStats(ctx context.Context, interval time.Duration) {
+	stats := docker.NewStatsCache()
+	cs.mu.Lock()
+	cs.stats = stats
+	cs.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := stats.Refresh(ctx, cs.dc); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("failed to sample container stats: %v", err)
+			}
+		} else if err := cs.sendStats(ctx); err != nil {
+			log.Printf("failed to send container stats: %v", err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendStats pushes the containers whose cached stats differ from the ones
+// herbst has, as a delta or, without delta mode, as a full snapshot
+func (cs *containerSync) sendStats(ctx context.Context) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.last == nil {
+		return nil
+	}
+
+	containers := make([]proto.Container, 0, len(cs.last))
+	for _, ct := range cs.last {
+		containers = append(containers, ct)
+	}
+	cs.stats.Attach(containers)
+
+	msg := proto.ContainersDeltaMessage{
+		Type:     "containers_delta",
+		NodeName: cs.nodeName,
+	}
+	for _, ct := range containers {
+		if !sameStats(cs.last[ct.ID].Stats, ct.Stats) {
+			msg.Changed = append(msg.Changed, ct)
+		}
+	}
+	if len(msg.Changed) == 0 {
+		return nil
+	}
+	if !cs.delta {
+		return cs.sendLocked(ctx, true)
+	}
+
+	cs.seq++
+	msg.Seq = cs.seq
+	if err := sendJSON(ctx, cs.c, msg); err != nil {
+		cs.last = nil
+		return wrapErr("failed to send container stats", err)
+	}
+	for _, ct := range msg.Changed {
+		cs.last[ct.ID] = ct
+	}
+	return nil
+}
+
+// metricsReporter periodically sends host metrics of the agent machine
+type metricsReporter struct {
+	nodeName string
+	sampler  *sysinfo.Sampler
+	opts     sysinfo.Options
+	interval time.Duration
+}
+
+// run sends metrics until ctx ends. Write errors end the connection through the read loop.
+func (mr *metricsReporter) run(ctx context.Context, c *websocket.Conn) {
+	// The first report waits for the sampler's first round
+	timer := time.NewTimer(2 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			timer.Reset(mr.interval)
+			msg := proto.MetricsMessage{
+				Type:     "metrics",
+				NodeName: mr.nodeName,
+				Metrics:  sysinfo.Collect(mr.sampler, mr.opts),
+			}
+			if err := sendJSON(ctx, c, msg); err != nil {
+				log.Printf("failed to send metrics: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// sameContainer compares everything but the stats, which differ on every
+// sample and are sent on their own cadence by sendStats
+func sameContainer(a, b proto.Container) bool {
+	a.Stats, b.Stats = nil, nil
+	return a == b
+}
+
+func sameStats(a, b *proto.ContainerStats) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// readLoop reads messages from herbst and runs incoming commands
+func readLoop(ctx context.Context, c *websocket.Conn, dc *docker.Client, cs *containerSync, welcome chan<- proto.WelcomeMessage) error {
+	// Running commands that can be cancelled by herbst (followed log streams)
+	var (
+		runningMu sync.Mutex
+		running   = make(map[string]context.CancelFunc)
+	)
+
+	for {
+		_, data, err := c.Read(ctx)
+		if err != nil {
+			return err
+		}
+
+		var base struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &base); err != nil {
+			log.Printf("invalid message from server: %v", err)
+			continue
+		}
+
+		switch base.Type {
+		case "command":
+			var cmd proto.CommandMessage
+			if err := json.Unmarshal(data, &cmd); err != nil {
+				log.Printf("invalid command: %v", err)
+				continue
+			}
+			cmdCtx, cancel := context.WithCancel(ctx)
+			runningMu.Lock()
+			running[cmd.ID] = cancel
+			runningMu.Unlock()
+
+			go func() {
+				defer func() {
+					runningMu.Lock()
+					delete(running, cmd.ID)
+					runningMu.Unlock()
+					cancel()
+				}()
+
+				res := handleCommand(cmdCtx, c, dc, cs, cmd)
+				// Use the connection context, cmdCtx may already be cancelled
+				if err := sendJSON(ctx, c, res); err != nil {
+					log.Printf("failed to send result for command %s: %v", cmd.ID, err)
+				}
+			}()
+		case "welcome":
+			var wm proto.WelcomeMessage
+			if err := json.Unmarshal(data, &wm); err != nil {
+				log.Printf("invalid welcome: %v", err)
+				continue
+			}
+			log.Printf("Welcome from herbst %s: protocol %d, capabilities %v", wm.ServerVersion, wm.Version, wm.Capabilities)
+			if slices.Contains(wm.Capabilities, proto.CapContainersDelta) {
+				cs.enableDelta()
+			}
+			select {
+			case welcome <- wm:
+			default:
+			}
+		case "reject":
+			var rm proto.RejectMessage
+			if err := json.Unmarshal(data, &rm); err != nil {
+				log.Printf("invalid reject: %v", err)
+				continue
+			}
+			return &rejectedError{reason: rm.Reason}
+		case "resync":
+			log.Println("Resync requested by server")
+			go func() {
+				if err := cs.send(ctx, true); err != nil {
+					log.Printf("resync failed: %v", err)
+				}
+			}()
+		case "cancel":
+			var cm proto.CancelMessage
+			if err := json.Unmarshal(data, &cm); err != nil {
+				log.Printf("invalid cancel: %v", err)
+				continue
+			}
+			runningMu.Lock()
+			if cancel, ok := running[cm.ID]; ok {
+				log.Printf("Command %s cancelled", cm.ID)
+				cancel()
+			}
+			runningMu.Unlock()
+		default:
+			log.Printf("ignoring message of type %q", base.Type)
+		}
+	}
+}
+
+// maxLogsSize caps the logs returned by a single logs command
+const maxLogsSize = 4 << 20
+
+var errLogsTruncated = errors.New("logs truncated")
+
+// handleCommand executes a single command against the Docker socket
+func handleCommand(ctx context.Context, c *websocket.Conn, dc *docker.Client, cs *containerSync, cmd proto.CommandMessage) proto.ResultMessage {
+	res := proto.ResultMessage{Type: "result", ID: cmd.ID}
+	log.Printf("Command %s: %s %s", cmd.ID, cmd.Action, cmd.ContainerID)
+
+	switch {
+	case docker.IsValidAction(cmd.Action):
+		state, err := dc.ContainerAction(ctx, cmd.ContainerID, cmd.Action)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		res.OK = true
+		res.Container = state
+
+		// Send the new list before the result so herbst already has it when the caller returns
+		if err := cs.send(ctx, false); err != nil {
+			log.Printf("failed to refresh containers after %s: %v", cmd.Action, err)
+		}
+
+	case cmd.Action == "logs" && cmd.Follow:
+		err := streamLogs(ctx, c, dc, cmd)
+		if err != nil && ctx.Err() == nil {
+			res.Error = err.Error()
+			return res
+		}
+		res.OK = true
+
+	case cmd.Action == "logs":
+		var sb strings.Builder
+		opts := docker.LogOptions{Tail: cmd.Tail, Since: cmd.Since}
+		err := dc.ContainerLogs(ctx, cmd.ContainerID, opts, func(l proto.LogLine) error {
+			// Stay well below the server's message size limit
+			if sb.Len()+len(l.Line) >= maxLogsSize {
+				return errLogsTruncated
+			}
+			sb.WriteString(l.Line)
+			sb.WriteByte('\n')
+			return nil
 		})
+		if errors.Is(err, errLogsTruncated) {
+			err = nil
+		}
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		res.OK = true
+		res.Logs = sb.String()
+
+	default:
+		res.Error = "unknown action: " + cmd.Action
 	}
 
-	return out, nil
+	return res
+}
+
+// streamLogs follows a container log and sends the lines to herbst in small batches
+// until the command is cancelled or the container stops
+func streamLogs(ctx context.Context, c *websocket.Conn, dc *docker.Client, cmd proto.CommandMessage) error {
+	lines := make(chan proto.LogLine, 256)
+	done := make(chan error, 1)
+
+	go func() {
+		opts := docker.LogOptions{Follow: true, Tail: cmd.Tail, Since: cmd.Since}
+		done <- dc.ContainerLogs(ctx, cmd.ContainerID, opts, func(l proto.LogLine) error {
+			select {
+			case lines <- l:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(lines)
+	}()
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	batch := make([]proto.LogLine, 0, 100)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := sendJSON(ctx, c, proto.LogsMessage{Type: "logs", ID: cmd.ID, Lines: batch})
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				if err := flush(); err != nil {
+					return err
+				}
+				return <-done
+			}
+			batch = append(batch, l)
+			if len(batch) == cap(batch) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
 }
 
 func sendJSON(ctx context.Context, c *websocket.Conn, v any) error {
@@ -196,10 +775,14 @@ func sendJSON(ctx context.Context, c *websocket.Conn, v any) error {
 }
 
 // kleine Helfer für nicer Logs / Fehlermeldungen
-type errStatus int
 
-func (e errStatus) Error() string {
-	return http.StatusText(int(e))
+// rejectedError means herbst refused the connection (e.g. incompatible protocol version)
+type rejectedError struct {
+	reason string
+}
+
+func (e *rejectedError) Error() string {
+	return "rejected by server: " + e.reason
 }
 
 func wrapErr(msg string, err error) error {
@@ -221,3 +804,14 @@ func (w *wrappedError) Error() string {
 func (w *wrappedError) Unwrap() error {
 	return w.inner
 }
+
+// splitList splits a comma-separated env value, ignoring empty entries
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
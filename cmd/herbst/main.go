@@ -2,15 +2,19 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
+	"crypto/subtle"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,14 +22,22 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/joho/godotenv"
 	"github.com/pelletier/go-toml/v2"
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/disk"
-	"github.com/shirou/gopsutil/v3/host"
-	"github.com/shirou/gopsutil/v3/mem"
 
 	"herbst/internal/agents"
+	"herbst/internal/alerts"
 	"herbst/internal/config"
+	"herbst/internal/docker"
+	"herbst/internal/health"
+	"herbst/internal/history"
+	"herbst/internal/notify"
+	"herbst/internal/pki"
+	"herbst/internal/proto"
+	"herbst/internal/revisions"
+	"herbst/internal/schema"
+	"herbst/internal/storage"
+	"herbst/internal/sysinfo"
 	"herbst/internal/themes"
+	"herbst/internal/uptime"
 	"herbst/internal/util"
 )
 
@@ -38,17 +50,23 @@ const (
 	containerStaticDir = "/app/static"
 )
 
+// containerStatsInterval is how often the stats of local containers are sampled
+const containerStatsInterval = 10 * time.Second
+
 // DockerAPIConfig is the resolved Docker config for API responses
 type DockerAPIConfig struct {
 	Enabled          bool   `json:"enabled"`
 	SocketPath       string `json:"socketPath"`
 	AgentsConfigured bool   `json:"agentsConfigured"`
+	ActionsEnabled   bool   `json:"actionsEnabled"` // true if an API token is configured
 }
 
 // SystemAPIConfig is the resolved System config for API responses
 type SystemAPIConfig struct {
-	Enabled  bool   `json:"enabled"`
-	DiskPath string `json:"diskPath"`
+	Enabled    bool     `json:"enabled"`
+	DiskPath   string   `json:"diskPath"`
+	Disks      []string `json:"disks"`
+	Interfaces []string `json:"interfaces"`
 }
 
 // APIConfig is the response structure for /api/config
@@ -116,46 +134,53 @@ func (b *SSEBroker) Notify(event string) {
 	b.broadcast <- event
 }
 
-// CPUCache holds cached CPU usage percentage updated in background
-type CPUCache struct {
-	mu      sync.RWMutex
-	percent float64
-}
-
-func (c *CPUCache) Get() float64 {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.percent
-}
-
-func (c *CPUCache) Update(percent float64) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.percent = percent
+// ClientCount returns the number of connected SSE clients
+func (b *SSEBroker) ClientCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.clients)
 }
 
-// StartCPUMonitor starts a background goroutine that updates CPU usage
-func StartCPUMonitor(cache *CPUCache) {
-	go func() {
-		for {
-			// This blocks for 1 second to measure CPU usage
-			cpuPercent, err := cpu.Percent(time.Second, false)
-			if err == nil && len(cpuPercent) > 0 {
-				cache.Update(cpuPercent[0])
-			}
-			// No additional sleep needed - cpu.Percent already takes 1 second
-		}
-	}()
+// newAPIConfig builds the API response config from the loaded config and theme
+func newAPIConfig(cfg *config.Config, activeTheme themes.Theme) APIConfig {
+	return APIConfig{
+		Title:   cfg.Title,
+		UI:      cfg.UI,
+		Weather: cfg.Weather,
+		Docker: DockerAPIConfig{
+			Enabled:          cfg.Docker.Local.IsEnabled(),
+			SocketPath:       cfg.Docker.Local.SocketPath,
+			AgentsConfigured: len(cfg.Docker.Agents) > 0,
+			ActionsEnabled:   cfg.API.Token != "",
+		},
+		System: SystemAPIConfig{
+			Enabled:    cfg.System.Enabled,
+			DiskPath:   cfg.System.DiskPath,
+			Disks:      cfg.System.DiskPaths(),
+			Interfaces: cfg.System.Interfaces,
+		},
+		Services:  cfg.Services,
+		Sections:  cfg.Sections,
+		Theme:     cfg.Theme,
+		ThemeVars: activeTheme.Vars,
+	}
 }
 
 // ConfigStore holds the current config with thread-safe access
 type ConfigStore struct {
 	mu          sync.RWMutex
 	apiConfig   APIConfig
+	cfg         *config.Config
 	configPath  string
 	themesPath  string
 	broker      *SSEBroker
 	agentServer *agents.Server
+	health      *health.Scheduler
+	uptime      *uptime.Tracker
+	alerts      *notify.Manager
+	engine      *alerts.Engine
+	revisions   *revisions.Store
+	saveMu      sync.Mutex // serializes saves of config.toml and themes.toml with their revisions
 }
 
 func (cs *ConfigStore) Get() APIConfig {
@@ -164,6 +189,13 @@ func (cs *ConfigStore) Get() APIConfig {
 	return cs.apiConfig
 }
 
+// Config returns the full parsed config (including secrets, never send it to clients)
+func (cs *ConfigStore) Config() *config.Config {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.cfg
+}
+
 func (cs *ConfigStore) Reload() error {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
@@ -184,30 +216,35 @@ func (cs *ConfigStore) Reload() error {
 	activeTheme := themeFile.ActiveTheme(cfg.Theme)
 
 	// Update API config
-	cs.apiConfig = APIConfig{
-		Title:   cfg.Title,
-		UI:      cfg.UI,
-		Weather: cfg.Weather,
-		Docker: DockerAPIConfig{
-			Enabled:          cfg.Docker.Local.IsEnabled(),
-			SocketPath:       cfg.Docker.Local.SocketPath,
-			AgentsConfigured: len(cfg.Docker.Agents) > 0,
-		},
-		System: SystemAPIConfig{
-			Enabled:  cfg.System.Enabled,
-			DiskPath: cfg.System.DiskPath,
-		},
-		Services:  cfg.Services,
-		Sections:  cfg.Sections,
-		Theme:     cfg.Theme,
-		ThemeVars: activeTheme.Vars,
-	}
+	cs.apiConfig = newAPIConfig(cfg, activeTheme)
+	cs.cfg = cfg
 
 	// Reload agent server config (updates allowed tokens)
 	if cs.agentServer != nil {
 		cs.agentServer.ReloadConfig(cfg)
 	}
 
+	// Reload notification channels and alert rules
+	if cs.alerts != nil {
+		configureNotify(cs.alerts, cfg)
+	}
+	if cs.engine != nil {
+		configureAlerts(cs.engine, cfg)
+	}
+
+	// Pick up added, removed or changed services
+	if cs.health != nil {
+		configureHealth(cs.health, cfg, filepath.Dir(cs.configPath))
+		if cs.uptime != nil {
+			// Removed services have no data from now on
+			checked := make(map[string]bool)
+			for _, st := range cs.health.Status() {
+				checked[st.ID] = true
+			}
+			cs.uptime.MarkUnknown(time.Now(), checked)
+		}
+	}
+
 	log.Printf("Config reloaded - Theme: %s", activeTheme.Name)
 
 	// Notify connected clients
@@ -218,7 +255,141 @@ func (cs *ConfigStore) Reload() error {
 	return nil
 }
 
+// requireToken wraps a handler so it only runs with a valid "Authorization: Bearer <token>" header.
+// Write endpoints stay disabled as long as no [api] token is configured.
+func requireToken(store *ConfigStore, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expected := store.Config().API.Token
+		if expected == "" {
+			http.Error(w, "Write access disabled: set [api] token in config.toml", http.StatusForbidden)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="herbst"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// writeCommandError writes an error response for a failed agent command.
+// It returns true if the command succeeded and the caller should continue.
+func writeCommandError(w http.ResponseWriter, res *proto.ResultMessage, err error) bool {
+	status, msg := 0, ""
+	switch {
+	case errors.Is(err, agents.ErrNotConnected):
+		status, msg = http.StatusServiceUnavailable, err.Error()
+	case errors.Is(err, agents.ErrUnsupported):
+		status, msg = http.StatusNotImplemented, err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		status, msg = http.StatusGatewayTimeout, "agent did not answer in time"
+	case err != nil:
+		status, msg = http.StatusBadGateway, err.Error()
+	case !res.OK:
+		status, msg = http.StatusBadGateway, res.Error
+	default:
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   msg,
+	})
+	return false
+}
+
+// parseLogParams reads tail, since and follow from the query string.
+// since accepts a unix timestamp, an RFC3339 time or a duration like "10m".
+func parseLogParams(r *http.Request) (docker.LogOptions, error) {
+	q := r.URL.Query()
+	opts := docker.LogOptions{Tail: 200}
+
+	if v := q.Get("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, errors.New("invalid 'tail' parameter")
+		}
+		opts.Tail = n
+	}
+
+	if v := q.Get("since"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			opts.Since = n
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			opts.Since = t.Unix()
+		} else if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			opts.Since = time.Now().Add(-d).Unix()
+		} else {
+			return opts, errors.New("invalid 'since' parameter")
+		}
+	}
+
+	if v := q.Get("follow"); v != "" {
+		follow, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errors.New("invalid 'follow' parameter")
+		}
+		opts.Follow = follow
+	}
+
+	return opts, nil
+}
+
+// serveLogStream streams log lines as Server-Sent Events ("log" per line, "end" when done)
+// until the client disconnects or run returns
+func serveLogStream(w http.ResponseWriter, r *http.Request, run func(ctx context.Context, emit func([]proto.LogLine) error) error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	emit := func(lines []proto.LogLine) error {
+		for _, l := range lines {
+			data, err := json.Marshal(l)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: log\ndata: %s\n\n", data); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	err := run(r.Context(), emit)
+	if r.Context().Err() != nil {
+		return
+	}
+	if err != nil {
+		data, _ := json.Marshal(err.Error())
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	}
+	fmt.Fprintf(w, "event: end\ndata: end\n\n")
+	flusher.Flush()
+}
+
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "cert" {
+		runCertCommand(os.Args[2:])
+		return
+	}
+
 	// Load .env file if it exists (won't override existing env vars)
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
@@ -249,42 +420,145 @@ func main() {
 	go broker.Run()
 
 	// Initialize CPU cache and start background monitor
-	cpuCache := &CPUCache{}
-	StartCPUMonitor(cpuCache)
+	sampler := sysinfo.NewSampler()
+	sampler.Start(context.Background(), time.Second)
+
+	// Load the agent token secret (persisted in the config directory, so tokens survive restarts)
+	if err := agents.LoadSecret(filepath.Dir(configPath)); err != nil {
+		log.Fatalf("Failed to load agent secret: %v", err)
+	}
 
 	// Initialize agent registry and server
 	registry := agents.NewRegistry()
 	agentServer := agents.NewServer(cfg, registry)
+	agentServer.SetServerVersion(Version)
+
+	// Agent CA for mutual TLS (the listener is started below)
+	var agentCA *pki.CA
+	if cfg.Docker.MTLS.Enabled {
+		agentCA, err = pki.LoadOrCreateCA(caDir(configPath))
+		if err != nil {
+			log.Fatalf("Failed to load agent CA: %v", err)
+		}
+		agentServer.SetCA(agentCA)
+	}
+
+	// Uptime of checked services, kept next to the history with [storage] enabled
+	uptimePath, uptimeRetention := "", uptime.DefaultRetention
+	if cfg.Storage.Enabled {
+		if opts, err := storageOptions(cfg.Storage, filepath.Dir(configPath)); err == nil {
+			uptimePath = filepath.Join(filepath.Dir(opts.Path), "uptime.log")
+			uptimeRetention = opts.Retention
+		}
+	}
+	uptimes, err := uptime.Open(uptimePath, uptimeRetention)
+	if err != nil {
+		log.Fatalf("Failed to open uptime history: %v", err)
+	}
+	// Nothing is known about the time herbst was not running
+	uptimes.MarkUnknown(time.Now(), nil)
+	go uptimes.Run(context.Background())
+
+	// Alerts about agents, containers and services go to the [[notify]] channels
+	notifier := notify.NewManager()
+	configureNotify(notifier, cfg)
+	if err := notifier.LoadSilences(filepath.Join(filepath.Dir(configPath), "silences.json")); err != nil {
+		log.Printf("Failed to load silences: %v", err)
+	}
+	go notifier.Run(context.Background())
+
+	// [[alert]] rules on metrics and states, evaluated by the state watcher
+	engine := alerts.NewEngine(notifier)
+	configureAlerts(engine, cfg)
+
+	// Background health checks for services with online-badge
+	healthChecks := health.NewScheduler()
+	healthChecks.SetNotifier(broker.Notify)
+	healthChecks.OnChange(func(st health.Status, _ health.State) {
+		uptimes.Record(st.ID, st.ChangedAt, st.State, st.Error)
+		serviceAlert(notifier, st)
+	})
+	configureHealth(healthChecks, cfg, filepath.Dir(configPath))
+	go healthChecks.Run(context.Background())
+
+	// Every saved version of config.toml and themes.toml
+	revs, err := revisions.Open(filepath.Join(filepath.Dir(configPath), "history"))
+	if err != nil {
+		log.Fatalf("Failed to open config history: %v", err)
+	}
 
 	// Initialize config store
 	store := &ConfigStore{
-		apiConfig: APIConfig{
-			Title:   cfg.Title,
-			UI:      cfg.UI,
-			Weather: cfg.Weather,
-			Docker: DockerAPIConfig{
-				Enabled:          cfg.Docker.Local.IsEnabled(),
-				SocketPath:       cfg.Docker.Local.SocketPath,
-				AgentsConfigured: len(cfg.Docker.Agents) > 0,
-			},
-			System: SystemAPIConfig{
-				Enabled:  cfg.System.Enabled,
-				DiskPath: cfg.System.DiskPath,
-			},
-			Services:  cfg.Services,
-			Sections:  cfg.Sections,
-			Theme:     cfg.Theme,
-			ThemeVars: activeTheme.Vars,
-		},
+		apiConfig:   newAPIConfig(cfg, activeTheme),
+		cfg:         cfg,
 		configPath:  configPath,
 		themesPath:  themesPath,
 		broker:      broker,
 		agentServer: agentServer,
+		health:      healthChecks,
+		uptime:      uptimes,
+		alerts:      notifier,
+		engine:      engine,
+		revisions:   revs,
+	}
+	// Changes made while herbst was not running
+	for _, path := range []string{configPath, themesPath} {
+		if err := store.recordFromDisk(path); err != nil {
+			log.Printf("Failed to keep %s in the revision history: %v", filepath.Base(path), err)
+		}
+	}
+
+	// Metrics history for sparklines (local host every second, agents as they report)
+	hist := history.NewStore(history.DefaultResolutions)
+	maxHistory := hist.MaxWindow()
+
+	// Optional on-disk history (changes to [storage] need a restart)
+	if cfg.Storage.Enabled {
+		opts, err := storageOptions(cfg.Storage, filepath.Dir(configPath))
+		if err != nil {
+			log.Fatalf("Invalid [storage] config: %v", err)
+		}
+		st, err := storage.Open(opts)
+		if err != nil {
+			log.Fatalf("Failed to open storage: %v", err)
+		}
+		// Fill the ring buffers with what was recorded before the restart
+		if err := st.Load(time.Now().Add(-maxHistory).Unix(), hist.Restore); err != nil {
+			log.Printf("Failed to load history from storage: %v", err)
+		}
+		hist.SetBackend(st)
+		go st.Run(context.Background())
+
+		maxHistory = 100 * 365 * 24 * time.Hour
+		if opts.Retention > 0 {
+			maxHistory = opts.Retention
+		}
+		log.Printf("History storage: %s (retention %s)", opts.Path, opts.Retention)
 	}
 
+	go recordHistory(hist, sampler, store, registry)
+
+	// Agent and container changes go to the browser and are checked for alerts
+	states := newStateWatcher(notifier, engine, store, registry, healthChecks, hist)
+	go states.Run()
+	agentServer.SetNotifier(func(event string) {
+		broker.Notify(event)
+		states.Poke()
+	})
+
 	// Start file watcher
 	go watchFiles(store, configPath, themesPath)
 
+	// Push local container changes to the browser as they happen
+	go watchDockerEvents(store, func() {
+		broker.Notify("containers")
+		states.Poke()
+	})
+
+	// Container stats take a second each to sample, lists show the latest ones
+	containerStats := docker.NewStatsCache()
+	go sampleContainerStats(store, containerStats)
+
 	mux := http.NewServeMux()
 
 	// WebSocket für Agents: /api/agents/ws
@@ -306,6 +580,84 @@ func main() {
 		}
 	})
 
+	// API endpoint: POST /api/docker/nodes/{node}/containers/{id}/{action}
+	// Runs a container action on a remote agent via its WebSocket connection (requires API token)
+	mux.HandleFunc("/api/docker/nodes/{node}/containers/{id}/{action}", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		node, id, action := r.PathValue("node"), r.PathValue("id"), r.PathValue("action")
+		if !docker.IsValidAction(action) {
+			http.Error(w, "Unknown action: "+action, http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Container %s requested for %s on node %s", action, id, node)
+
+		ctx, cancel := context.WithTimeout(r.Context(), 45*time.Second)
+		defer cancel()
+
+		res, err := agentServer.SendCommand(ctx, node, proto.CommandMessage{
+			Action:      action,
+			ContainerID: id,
+		})
+		if !writeCommandError(w, res, err) {
+			return
+		}
+
+		broker.Notify("containers")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"action":    action,
+			"container": res.Container,
+		})
+	}))
+
+	// API endpoint: GET /api/docker/nodes/{node}/containers/{id}/logs?tail=200&since=10m&follow=true
+	// Returns the logs of a remote container via its agent, streamed as SSE with follow=true (requires API token)
+	mux.HandleFunc("/api/docker/nodes/{node}/containers/{id}/logs", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		params, err := parseLogParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		node := r.PathValue("node")
+		cmd := proto.CommandMessage{
+			Action:      "logs",
+			ContainerID: r.PathValue("id"),
+			Tail:        params.Tail,
+			Since:       params.Since,
+		}
+
+		if params.Follow {
+			serveLogStream(w, r, func(ctx context.Context, emit func([]proto.LogLine) error) error {
+				return agentServer.StreamLogs(ctx, node, cmd, emit)
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+
+		res, err := agentServer.SendCommand(ctx, node, cmd)
+		if !writeCommandError(w, res, err) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, res.Logs)
+	}))
+
 	// API endpoint: POST /api/reload
 	// Reloads the configuration files and notifies all connected clients
 	mux.HandleFunc("/api/reload", func(w http.ResponseWriter, r *http.Request) {
@@ -357,8 +709,9 @@ func main() {
 	})
 
 	// API endpoint: GET/PUT /api/config/raw
-	// GET returns raw TOML content, PUT saves it (with backup and validation)
-	mux.HandleFunc("/api/config/raw", func(w http.ResponseWriter, r *http.Request) {
+	// GET returns raw TOML content, PUT saves it (with validation, kept in the revision history).
+	// Both need the API token: the file holds the token itself and the notify secrets.
+	mux.HandleFunc("/api/config/raw", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			data, err := os.ReadFile(store.configPath)
@@ -370,30 +723,23 @@ func main() {
 			w.Write(data)
 
 		case http.MethodPut:
-			body, err := io.ReadAll(r.Body)
-			if err != nil {
-				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			body, ok := readConfigBody(w, r)
+			if !ok {
 				return
 			}
 
-			// Validate TOML syntax
-			var cfg config.Config
-			if err := toml.Unmarshal(body, &cfg); err != nil {
-				http.Error(w, "Invalid TOML: "+err.Error(), http.StatusBadRequest)
+			// Invalid configs are not saved, the issues go back to the editor
+			validation := validateConfig(body, filepath.Dir(store.configPath))
+			if !validation.Valid {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(validation)
 				return
 			}
 
-			// Create backup
-			backupPath := store.configPath + ".bak"
-			if existing, err := os.ReadFile(store.configPath); err == nil {
-				if err := os.WriteFile(backupPath, existing, 0644); err != nil {
-					http.Error(w, "Failed to create backup", http.StatusInternalServerError)
-					return
-				}
-			}
-
-			// Write new config
-			if err := os.WriteFile(store.configPath, body, 0644); err != nil {
+			rev, err := store.saveRevision(store.configPath, body, revisionAuthor(r, store.Config().API.TrustedProxies), "")
+			if err != nil {
+				log.Printf("Failed to save config: %v", err)
 				http.Error(w, "Failed to write config file", http.StatusInternalServerError)
 				return
 			}
@@ -404,120 +750,558 @@ func main() {
 				return
 			}
 
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("OK"))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success":  true,
+				"warnings": validation.Warnings,
+				"revision": rev,
+			})
 
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
+	}))
+
+	// API endpoint: POST /api/config/validate
+	// Checks a config.toml sent as the body without saving it: unknown keys, invalid
+	// values and references, as errors and warnings with line and column
+	mux.HandleFunc("/api/config/validate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, ok := readConfigBody(w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(validateConfig(body, filepath.Dir(store.configPath)))
+	})
+
+	// revisionPath returns the file a revision belongs to
+	revisionPath := func(rev revisions.Revision) (string, bool) {
+		switch rev.File {
+		case filepath.Base(store.configPath):
+			return store.configPath, true
+		case filepath.Base(store.themesPath):
+			return store.themesPath, true
+		}
+		return "", false
+	}
+
+	// API endpoint: GET /api/config/history?file=config.toml
+	// Lists the saved versions of config.toml and themes.toml, newest first
+	mux.HandleFunc("/api/config/history", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"revisions": store.revisions.List(r.URL.Query().Get("file")),
+		})
 	})
 
-	// API endpoint: GET/PUT /api/themes/raw
-	// GET returns raw themes.toml content, PUT saves it (with backup and validation)
-	mux.HandleFunc("/api/themes/raw", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			data, err := os.ReadFile(store.themesPath)
+	// API endpoint: GET /api/config/history/diff?from=<id>&to=<id>
+	// Unified diff between two revisions of the same file, without to against the file as it is now.
+	// Old revisions hold old secrets, so diffs and contents need the API token.
+	mux.HandleFunc("/api/config/history/diff", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		readRevision := func(param string) (revisions.Revision, []byte, bool) {
+			id, err := strconv.Atoi(r.URL.Query().Get(param))
 			if err != nil {
-				http.Error(w, "Failed to read themes file", http.StatusInternalServerError)
-				return
+				http.Error(w, "Invalid '"+param+"' parameter", http.StatusBadRequest)
+				return revisions.Revision{}, nil, false
+			}
+			rev, data, err := store.revisions.Read(id)
+			if errors.Is(err, revisions.ErrNotFound) {
+				http.Error(w, fmt.Sprintf("Revision %d not found", id), http.StatusNotFound)
+				return revisions.Revision{}, nil, false
 			}
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			w.Write(data)
-
-		case http.MethodPut:
-			body, err := io.ReadAll(r.Body)
 			if err != nil {
-				http.Error(w, "Failed to read request body", http.StatusBadRequest)
-				return
+				http.Error(w, "Failed to read revision", http.StatusInternalServerError)
+				return revisions.Revision{}, nil, false
 			}
+			return rev, data, true
+		}
 
-			// Validate TOML syntax
-			var themeFile themes.ThemeFile
-			if err := toml.Unmarshal(body, &themeFile); err != nil {
-				http.Error(w, "Invalid TOML: "+err.Error(), http.StatusBadRequest)
+		from, fromData, ok := readRevision("from")
+		if !ok {
+			return
+		}
+		fromName := fmt.Sprintf("%s@%d", from.File, from.ID)
+
+		var toName string
+		var toData []byte
+		if r.URL.Query().Get("to") == "" {
+			path, ok := revisionPath(from)
+			if !ok {
+				http.Error(w, "Unknown file "+from.File, http.StatusBadRequest)
 				return
 			}
-
-			// Create backup
-			backupPath := store.themesPath + ".bak"
-			if existing, err := os.ReadFile(store.themesPath); err == nil {
-				if err := os.WriteFile(backupPath, existing, 0644); err != nil {
-					http.Error(w, "Failed to create backup", http.StatusInternalServerError)
-					return
-				}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				http.Error(w, "Failed to read "+from.File, http.StatusInternalServerError)
+				return
 			}
-
-			// Write new themes
-			if err := os.WriteFile(store.themesPath, body, 0644); err != nil {
-				http.Error(w, "Failed to write themes file", http.StatusInternalServerError)
+			toName, toData = from.File, data
+		} else {
+			to, data, ok := readRevision("to")
+			if !ok {
 				return
 			}
-
-			// Reload config store (this also reloads themes)
-			if err := store.Reload(); err != nil {
-				http.Error(w, "Themes saved but reload failed: "+err.Error(), http.StatusInternalServerError)
+			if to.File != from.File {
+				http.Error(w, "Revisions are of different files", http.StatusBadRequest)
 				return
 			}
-
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("OK"))
-
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			toName, toData = fmt.Sprintf("%s@%d", to.File, to.ID), data
 		}
-	})
 
-	// API endpoint: GET /api/health?url=<service-url>
-	// Checks if a service URL is reachable
-	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		io.WriteString(w, revisions.Diff(fromName, toName, fromData, toData))
+	}))
+
+	// API endpoint: GET /api/config/history/{id}
+	// Returns the content of a revision
+	mux.HandleFunc("/api/config/history/{id}", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		targetURL := r.URL.Query().Get("url")
-		if targetURL == "" {
-			http.Error(w, "Missing 'url' parameter", http.StatusBadRequest)
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid revision id", http.StatusBadRequest)
 			return
 		}
+		_, data, err := store.revisions.Read(id)
+		if errors.Is(err, revisions.ErrNotFound) {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read revision", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(data)
+	}))
 
-		// Create a client with timeout and skip TLS verification (for self-signed certs)
-		client := &http.Client{
-			Timeout: 5 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
+	// API endpoint: POST /api/config/history/{id}/restore
+	// Saves a revision as the current file, with the same validation as saving it
+	// in the editor, and reloads. The restore is a new revision.
+	mux.HandleFunc("/api/config/history/{id}/restore", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
 
-		// Try HEAD first, fall back to GET if it fails
-		req, err := http.NewRequest(http.MethodHead, targetURL, nil)
+		id, err := strconv.Atoi(r.PathValue("id"))
 		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{"online": false, "error": err.Error()})
+			http.Error(w, "Invalid revision id", http.StatusBadRequest)
+			return
+		}
+		rev, data, err := store.revisions.Read(id)
+		if errors.Is(err, revisions.ErrNotFound) {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read revision", http.StatusInternalServerError)
+			return
+		}
+		path, ok := revisionPath(rev)
+		if !ok {
+			http.Error(w, "Unknown file "+rev.File, http.StatusBadRequest)
+			return
+		}
+
+		// Old revisions may not pass today's checks
+		warnings := []config.Issue{}
+		if path == store.configPath {
+			validation := validateConfig(data, filepath.Dir(store.configPath))
+			if !validation.Valid {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(validation)
+				return
+			}
+			warnings = validation.Warnings
+		} else {
+			var themeFile themes.ThemeFile
+			if err := toml.Unmarshal(data, &themeFile); err != nil {
+				http.Error(w, "Invalid TOML: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		restored, err := store.saveRevision(path, data, revisionAuthor(r, store.Config().API.TrustedProxies), fmt.Sprintf("restored revision %d", id))
+		if err != nil {
+			log.Printf("Failed to restore revision %d: %v", id, err)
+			http.Error(w, "Failed to write "+rev.File, http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Restored %s from revision %d", rev.File, id)
+
+		if err := store.Reload(); err != nil {
+			http.Error(w, "Revision restored but reload failed: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		resp, err := client.Do(req)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"warnings": warnings,
+			"revision": restored,
+		})
+	}))
+
+	// API endpoint: GET /api/schema/config and /api/schema/themes
+	// JSON Schema of config.toml and themes.toml for editor completion and checks
+	serveSchema := func(build func() ([]byte, error)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			data, err := build()
+			if err != nil {
+				http.Error(w, "Failed to build schema", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/schema+json")
+			w.Write(data)
+		}
+	}
+	mux.HandleFunc("/api/schema/config", serveSchema(schema.ConfigJSON))
+	mux.HandleFunc("/api/schema/themes", serveSchema(schema.ThemesJSON))
+
+	// API endpoint: GET/PUT /api/themes/raw
+	// GET returns raw themes.toml content, PUT saves it (with validation, kept in the revision history), both with the API token
+	mux.HandleFunc("/api/themes/raw", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			data, err := os.ReadFile(store.themesPath)
+			if err != nil {
+				http.Error(w, "Failed to read themes file", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write(data)
+
+		case http.MethodPut:
+			body, ok := readConfigBody(w, r)
+			if !ok {
+				return
+			}
+
+			// Validate TOML syntax
+			var themeFile themes.ThemeFile
+			if err := toml.Unmarshal(body, &themeFile); err != nil {
+				http.Error(w, "Invalid TOML: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if _, err := store.saveRevision(store.themesPath, body, revisionAuthor(r, store.Config().API.TrustedProxies), ""); err != nil {
+				log.Printf("Failed to save themes: %v", err)
+				http.Error(w, "Failed to write themes file", http.StatusInternalServerError)
+				return
+			}
+
+			// Reload config store (this also reloads themes)
+			if err := store.Reload(); err != nil {
+				http.Error(w, "Themes saved but reload failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	// API endpoint: GET /api/health?id=<service-id>
+	// Checks a configured service right away. Only services with online-badge can be checked,
+	// ?url= is still accepted if it is the URL of such a service.
+	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-		// If HEAD fails or returns 405 (Method Not Allowed), try GET
-		if err != nil || (resp != nil && resp.StatusCode == 405) {
-			if resp != nil {
-				resp.Body.Close()
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			targetURL := r.URL.Query().Get("url")
+			if targetURL == "" {
+				http.Error(w, "Missing 'id' parameter", http.StatusBadRequest)
+				return
+			}
+			for _, st := range healthChecks.Status() {
+				if st.URL == targetURL {
+					id = st.ID
+					break
+				}
+			}
+			if id == "" {
+				http.Error(w, "Only configured services with online-badge can be checked", http.StatusForbidden)
+				return
 			}
-			req, _ = http.NewRequest(http.MethodGet, targetURL, nil)
-			resp, err = client.Do(req)
 		}
 
-		online := err == nil && resp != nil && resp.StatusCode < 500
-		if resp != nil {
-			resp.Body.Close()
+		st, ok := healthChecks.CheckNow(r.Context(), id)
+		if !ok {
+			http.Error(w, "Unknown service or online-badge not enabled", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"online": st.State == health.StateUp,
+			"status": st,
+		})
+	})
+
+	// API endpoint: GET /api/health/status
+	// Last background check result of every service with online-badge
+	mux.HandleFunc("/api/health/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"services": healthChecks.Status(),
+		})
+	})
+
+	// API endpoint: GET /api/health/status/{id}
+	mux.HandleFunc("/api/health/status/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		st, ok := healthChecks.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Unknown service or online-badge not enabled", http.StatusNotFound)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"online": online})
+		json.NewEncoder(w).Encode(st)
 	})
 
+	// API endpoint: GET /api/health/uptime?range=24h&buckets=24
+	// Uptime of every checked service: SLA percentages and a status bar over range
+	mux.HandleFunc("/api/health/uptime", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		window, buckets, err := uptimeQuery(r.URL.Query(), 24*time.Hour, 24)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		services := []map[string]interface{}{}
+		for _, st := range healthChecks.Status() {
+			services = append(services, map[string]interface{}{
+				"id":      st.ID,
+				"name":    st.Name,
+				"section": st.Section,
+				"state":   st.State,
+				"sla":     uptimeSLA(uptimes, st.ID, now),
+				"report":  uptimes.Report(st.ID, now.Add(-window), now, buckets, false),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"range":    int(window.Seconds()),
+			"services": services,
+		})
+	})
+
+	// API endpoint: GET /api/health/uptime/{id}?range=30d&buckets=30
+	// Uptime of one service including its outages
+	mux.HandleFunc("/api/health/uptime/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		st, ok := healthChecks.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Unknown service or online-badge not enabled", http.StatusNotFound)
+			return
+		}
+		window, buckets, err := uptimeQuery(r.URL.Query(), 30*24*time.Hour, 30)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      st.ID,
+			"name":    st.Name,
+			"section": st.Section,
+			"state":   st.State,
+			"range":   int(window.Seconds()),
+			"sla":     uptimeSLA(uptimes, st.ID, now),
+			"report":  uptimes.Report(st.ID, now.Add(-window), now, buckets, true),
+		})
+	})
+
+	// API endpoint: GET /api/notify
+	// Configured notification channels and the alerts that are currently firing
+	mux.HandleFunc("/api/notify", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"channels": notifier.Channels(),
+			"active":   notifier.Active(),
+		})
+	})
+
+	// API endpoint: POST /api/notify/test
+	// Sends a test alert to every channel and reports the result per channel (requires API token)
+	mux.HandleFunc("/api/notify/test", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		results := make(map[string]string)
+		for name, err := range notifier.Test(r.Context()) {
+			results[name] = "ok"
+			if err != nil {
+				results[name] = err.Error()
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": results,
+		})
+	}))
+
+	// API endpoint: GET /api/alerts
+	// Firing alerts (with their silenced flag), rule violations waiting for their
+	// for-duration and recently resolved alerts
+	mux.HandleFunc("/api/alerts", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"firing":   notifier.Active(),
+			"pending":  engine.Pending(),
+			"resolved": notifier.Resolved(),
+		})
+	})
+
+	// API endpoint: GET/POST /api/alerts/silences
+	// Lists silences, or creates one (requires API token)
+	createSilence := requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Matchers map[string]string `json:"matchers"`
+			StartsAt time.Time         `json:"startsAt"`
+			EndsAt   time.Time         `json:"endsAt"`
+			Duration string            `json:"duration"` // instead of endsAt, e.g. "2h"
+			Comment  string            `json:"comment"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if req.Duration != "" {
+			d, err := util.ParseDuration(req.Duration)
+			if err != nil || d <= 0 {
+				http.Error(w, fmt.Sprintf("Invalid duration %q", req.Duration), http.StatusBadRequest)
+				return
+			}
+			start := req.StartsAt
+			if start.IsZero() {
+				start = time.Now()
+			}
+			req.EndsAt = start.Add(d)
+		}
+
+		silence, err := notifier.AddSilence(notify.Silence{
+			Matchers: req.Matchers,
+			StartsAt: req.StartsAt,
+			EndsAt:   req.EndsAt,
+			Comment:  req.Comment,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Added silence %s until %s", silence.ID, silence.EndsAt.Format(time.DateTime))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"silence": silence,
+		})
+	})
+	mux.HandleFunc("/api/alerts/silences", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"silences": notifier.Silences(),
+			})
+		case http.MethodPost:
+			createSilence(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// API endpoint: DELETE /api/alerts/silences/{id}
+	// Ends a silence early, alerts it held back are sent (requires API token)
+	mux.HandleFunc("/api/alerts/silences/{id}", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := r.PathValue("id")
+		if !notifier.DeleteSilence(id) {
+			http.Error(w, "Unknown silence: "+id, http.StatusNotFound)
+			return
+		}
+		log.Printf("Deleted silence %s", id)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+		})
+	}))
+
 	// API endpoint: GET /api/weather
 	// Fetches current weather from OpenWeatherMap
 	mux.HandleFunc("/api/weather", func(w http.ResponseWriter, r *http.Request) {
@@ -728,33 +1512,8 @@ func main() {
 			return
 		}
 
-		socketPath := dockerCfg.SocketPath
-		if socketPath == "" {
-			socketPath = "/var/run/docker.sock"
-		}
-
-		// Create HTTP client that connects via Unix socket
-		client := &http.Client{
-			Transport: &http.Transport{
-				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-					return net.Dial("unix", socketPath)
-				},
-			},
-			Timeout: 10 * time.Second,
-		}
-
-		// Call Docker API
-		req, err := http.NewRequest("GET", "http://localhost/containers/json?all=true", nil)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"enabled": true,
-				"error":   "Failed to create request",
-			})
-			return
-		}
-
-		resp, err := client.Do(req)
+		client := docker.NewClient(dockerCfg.SocketPath)
+		containers, err := client.ListContainers(r.Context())
 		if err != nil {
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(map[string]interface{}{
@@ -763,41 +1522,21 @@ func main() {
 			})
 			return
 		}
-		defer resp.Body.Close()
 
-		// Parse Docker API response
-		var containers []struct {
-			ID      string   `json:"Id"`
-			Names   []string `json:"Names"`
-			Image   string   `json:"Image"`
-			State   string   `json:"State"`
-			Status  string   `json:"Status"`
-			Created int64    `json:"Created"`
-		}
-
-		if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"enabled": true,
-				"error":   "Failed to parse Docker response",
-			})
-			return
-		}
+		// CPU, memory, network and block I/O for running containers, sampled in the background
+		containerStats.Attach(containers)
 
 		// Transform to our format
 		result := make([]map[string]interface{}, len(containers))
 		for i, c := range containers {
-			name := c.ID[:12]
-			if len(c.Names) > 0 {
-				name = strings.TrimPrefix(c.Names[0], "/")
-			}
 			result[i] = map[string]interface{}{
-				"id":      c.ID[:12],
-				"name":    name,
+				"id":      docker.ShortID(c.ID),
+				"name":    c.Name,
 				"image":   c.Image,
 				"state":   c.State,
 				"status":  c.Status,
 				"created": c.Created,
+				"stats":   c.Stats,
 			}
 		}
 
@@ -808,6 +1547,111 @@ func main() {
 		})
 	})
 
+	// API endpoint: POST /api/docker/containers/{id}/{action}
+	// Runs start/stop/restart/pause/unpause on a local container (requires API token)
+	mux.HandleFunc("/api/docker/containers/{id}/{action}", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dockerCfg := store.Get().Docker
+		if !dockerCfg.Enabled {
+			http.Error(w, "Docker integration not enabled", http.StatusNotFound)
+			return
+		}
+
+		id, action := r.PathValue("id"), r.PathValue("action")
+		if !docker.IsValidAction(action) {
+			http.Error(w, "Unknown action: "+action, http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Container %s requested for %s", action, id)
+
+		state, err := docker.NewClient(dockerCfg.SocketPath).ContainerAction(r.Context(), id, action)
+		if err != nil {
+			log.Printf("Container %s failed for %s: %v", action, id, err)
+			status := http.StatusBadGateway
+			var apiErr *docker.APIError
+			if errors.As(err, &apiErr) {
+				status = apiErr.StatusCode
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		// Let open dashboards refresh their container lists right away
+		broker.Notify("containers")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"action":    action,
+			"container": state,
+		})
+	}))
+
+	// API endpoint: GET /api/docker/containers/{id}/logs?tail=200&since=10m&follow=true
+	// Returns the logs of a local container, streamed as SSE with follow=true (requires API token)
+	mux.HandleFunc("/api/docker/containers/{id}/logs", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dockerCfg := store.Get().Docker
+		if !dockerCfg.Enabled {
+			http.Error(w, "Docker integration not enabled", http.StatusNotFound)
+			return
+		}
+
+		params, err := parseLogParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client := docker.NewClient(dockerCfg.SocketPath)
+		id := r.PathValue("id")
+
+		if params.Follow {
+			serveLogStream(w, r, func(ctx context.Context, emit func([]proto.LogLine) error) error {
+				return client.ContainerLogs(ctx, id, params, func(l proto.LogLine) error {
+					return emit([]proto.LogLine{l})
+				})
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+
+		var sb strings.Builder
+		err = client.ContainerLogs(ctx, id, params, func(l proto.LogLine) error {
+			sb.WriteString(l.Line)
+			sb.WriteByte('\n')
+			return nil
+		})
+		if err != nil {
+			status := http.StatusBadGateway
+			var apiErr *docker.APIError
+			if errors.As(err, &apiErr) {
+				status = apiErr.StatusCode
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, sb.String())
+	}))
+
 	// API endpoint: GET /api/system/stats
 	// Returns system metrics (CPU, memory, disk, uptime)
 	mux.HandleFunc("/api/system/stats", func(w http.ResponseWriter, r *http.Request) {
@@ -818,81 +1662,141 @@ func main() {
 
 		w.Header().Set("Content-Type", "application/json")
 
-		// Get CPU usage from cache (updated in background, no blocking)
-		cpuUsage := cpuCache.Get()
-
-		// Get CPU info
-		cpuInfo, _ := cpu.Info()
-		cpuModel := ""
-		cpuCores := 0
-		if len(cpuInfo) > 0 {
-			cpuModel = cpuInfo[0].ModelName
-			cpuCores = int(cpuInfo[0].Cores)
-		}
-		cpuCount, _ := cpu.Counts(true) // logical cores
-
-		// Get memory info
-		memInfo, _ := mem.VirtualMemory()
-		memTotal := uint64(0)
-		memUsed := uint64(0)
-		memPercent := 0.0
-		if memInfo != nil {
-			memTotal = memInfo.Total
-			memUsed = memInfo.Used
-			memPercent = memInfo.UsedPercent
-		}
-
-		// Get disk info (from configured path)
-		diskPath := store.Get().System.DiskPath
-		if diskPath == "" {
-			diskPath = "/"
-		}
-		diskInfo, _ := disk.Usage(diskPath)
-		diskTotal := uint64(0)
-		diskUsed := uint64(0)
-		diskPercent := 0.0
-		if diskInfo != nil {
-			diskTotal = diskInfo.Total
-			diskUsed = diskInfo.Used
-			diskPercent = diskInfo.UsedPercent
-		}
-
-		// Get host info
-		hostInfo, _ := host.Info()
-		hostname := ""
-		uptime := uint64(0)
-		os := ""
-		platform := ""
-		if hostInfo != nil {
-			hostname = hostInfo.Hostname
-			uptime = hostInfo.Uptime
-			os = hostInfo.OS
-			platform = hostInfo.Platform
+		// CPU usage and network rates come from the background sampler (no blocking)
+		sys := store.Get().System
+		_ = json.NewEncoder(w).Encode(sysinfo.Collect(sampler, sysinfo.Options{
+			Disks:      sys.Disks,
+			Interfaces: sys.Interfaces,
+		}))
+	})
+
+	// API endpoint: GET /api/system/nodes
+	// Lists agent nodes that report host metrics
+	mux.HandleFunc("/api/system/nodes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		type NodeMetrics struct {
+			Name      string             `json:"name"`
+			Connected bool               `json:"connected"`
+			UpdatedAt time.Time          `json:"updatedAt"`
+			Metrics   *proto.HostMetrics `json:"metrics"`
 		}
 
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"cpu": map[string]interface{}{
-				"percent": cpuUsage,
-				"model":   cpuModel,
-				"cores":   cpuCores,
-				"threads": cpuCount,
-			},
-			"memory": map[string]interface{}{
-				"total":   memTotal,
-				"used":    memUsed,
-				"percent": memPercent,
-			},
-			"disk": map[string]interface{}{
-				"total":   diskTotal,
-				"used":    diskUsed,
-				"percent": diskPercent,
-			},
-			"host": map[string]interface{}{
-				"hostname": hostname,
-				"uptime":   uptime,
-				"os":       os,
-				"platform": platform,
-			},
+		nodes := []NodeMetrics{}
+		for _, a := range store.Config().Docker.Agents {
+			ns, ok := registry.Get(a.Name)
+			if !ok || ns.Metrics == nil {
+				continue
+			}
+			nodes = append(nodes, NodeMetrics{
+				Name:      ns.Name,
+				Connected: ns.Connected,
+				UpdatedAt: ns.MetricsAt,
+				Metrics:   ns.Metrics,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"nodes": nodes,
+		})
+	})
+
+	// API endpoint: GET /api/system/nodes/{node}
+	// Returns the last host metrics of an agent node, same format as /api/system/stats
+	mux.HandleFunc("/api/system/nodes/{node}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ns, ok := registry.Get(r.PathValue("node"))
+		if !ok || ns.Metrics == nil {
+			http.Error(w, "No metrics for this node", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ns.Metrics)
+	})
+
+	// API endpoint: GET /api/system/history?node=local&range=1h&points=120&metrics=cpu,memory
+	// Returns downsampled metric series of herbst's host or an agent node
+	mux.HandleFunc("/api/system/history", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		node := q.Get("node")
+		if node == "" {
+			node = history.LocalNode
+		}
+		if node != history.LocalNode {
+			// Configured agents have history even before they reconnect after a restart
+			known := false
+			for _, a := range store.Config().Docker.Agents {
+				if a.Name == node {
+					known = true
+					break
+				}
+			}
+			if !known {
+				http.Error(w, "Unknown node", http.StatusNotFound)
+				return
+			}
+		}
+
+		window := time.Hour
+		if v := q.Get("range"); v != "" {
+			d, err := util.ParseDuration(v)
+			if err != nil || d < time.Second {
+				http.Error(w, "Invalid range, use a duration like 5m, 24h or 7d", http.StatusBadRequest)
+				return
+			}
+			window = min(d, maxHistory)
+		}
+
+		points := 120
+		if v := q.Get("points"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 2000 {
+				http.Error(w, "Invalid points, use 1-2000", http.StatusBadRequest)
+				return
+			}
+			points = n
+		}
+
+		var metrics []string
+		if v := q.Get("metrics"); v != "" {
+			metrics = strings.Split(v, ",")
+		} else {
+			prefix := history.Key(node, "")
+			for _, k := range hist.Keys(prefix) {
+				metrics = append(metrics, strings.TrimPrefix(k, prefix))
+			}
+		}
+
+		keys := make([]string, len(metrics))
+		for i, m := range metrics {
+			keys[i] = history.Key(node, m)
+		}
+		byKey, step := hist.Query(keys, window, points)
+		series := make(map[string][]history.Point, len(metrics))
+		for i, m := range metrics {
+			series[m] = byKey[keys[i]]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"node":   node,
+			"range":  int(window.Seconds()),
+			"step":   int(step.Seconds()),
+			"series": series,
 		})
 	})
 
@@ -912,29 +1816,19 @@ func main() {
 		// Verbundene Nodes aus Registry
 		connectedNodes := registry.Snapshot()
 
-		// Original-Config für Tokens / Agents laden
-		cfg, _, err := config.EnsureAndLoadConfig()
-		if err != nil {
-			log.Printf("Failed to load config in /api/docker/agents: %v", err)
-
-			// Kein Panic, sondern sauberer Fehler-Response
-			w.WriteHeader(http.StatusInternalServerError)
-			_ = json.NewEncoder(w).Encode(map[string]interface{}{
-				"enabled":       currentCfg.Docker.Enabled,
-				"agents":        []interface{}{},
-				"serverHost":    r.Host,
-				"agentProtocol": "ws",
-				"error":         "failed to load config",
-			})
-			return
-		}
+		// Tokens and agents from the loaded config, it only changes on reload
+		cfg := store.Config()
 
 		type AgentResponse struct {
-			Name       string      `json:"name"`
-			Token      string      `json:"token"`
-			Connected  bool        `json:"connected"`
-			LastSeen   *string     `json:"lastSeen"`
-			Containers interface{} `json:"containers"`
+			Name         string      `json:"name"`
+			Token        string      `json:"token"`
+			Connected    bool        `json:"connected"`
+			LastSeen     *string     `json:"lastSeen"`
+			Containers   interface{} `json:"containers"`
+			Version      int         `json:"version"`
+			Capabilities []string    `json:"capabilities"`
+			AgentVersion string      `json:"agentVersion,omitempty"`
+			Rejected     string      `json:"rejected,omitempty"` // e.g. incompatible protocol version
 		}
 
 		agentsList := make([]AgentResponse, 0, len(cfg.Docker.Agents))
@@ -947,11 +1841,12 @@ func main() {
 			}
 
 			agent := AgentResponse{
-				Name:       agentCfg.Name,
-				Token:      token,
-				Connected:  false,
-				LastSeen:   nil,
-				Containers: []interface{}{},
+				Name:         agentCfg.Name,
+				Token:        token,
+				Connected:    false,
+				LastSeen:     nil,
+				Containers:   []interface{}{},
+				Capabilities: []string{},
 			}
 
 			if node, exists := connectedNodes[agentCfg.Name]; exists {
@@ -961,6 +1856,10 @@ func main() {
 					agent.LastSeen = &lastSeen
 				}
 				agent.Containers = node.Containers
+				agent.Version = node.Version
+				agent.Capabilities = node.Capabilities
+				agent.AgentVersion = node.AgentVersion
+				agent.Rejected = node.Rejected
 			}
 
 			agentsList = append(agentsList, agent)
@@ -986,6 +1885,36 @@ func main() {
 		})
 	})
 
+	// API endpoint: POST /api/agents/secret/rotate
+	// Generates a new agent secret; all auto-generated agent tokens change (requires API token)
+	mux.HandleFunc("/api/agents/secret/rotate", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := agentServer.RotateSecret(); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, agents.ErrSecretFromEnv) {
+				status = http.StatusConflict
+			}
+			log.Printf("Failed to rotate agent secret: %v", err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		broker.Notify("nodes")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Agent secret rotated, redeploy agents with their new tokens",
+		})
+	}))
+
+	// Prometheus endpoint: GET /metrics
+	mux.HandleFunc("/metrics", metricsHandler(store, sampler, registry, healthChecks, broker))
+
 	// SSE endpoint for live reload
 	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/event-stream")
@@ -1018,6 +1947,102 @@ func main() {
 		}
 	})
 
+	// API endpoint: GET/POST /api/agents/certificates
+	// Lists or issues agent client certificates for mTLS (requires API token)
+	mux.HandleFunc("/api/agents/certificates", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if agentCA == nil {
+			http.Error(w, "mTLS is not enabled, set [docker.mtls] enabled = true", http.StatusConflict)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			list, err := agentCA.List()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"certificates": list,
+			})
+
+		case http.MethodPost:
+			var req struct {
+				Name string `json:"name"`
+				Days int    `json:"days"`
+			}
+			if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+
+			// Only configured agents can be enrolled, the CN is their node name
+			known := false
+			for _, a := range store.Config().Docker.Agents {
+				if a.Name == req.Name {
+					known = true
+					break
+				}
+			}
+			if !known {
+				http.Error(w, fmt.Sprintf("Unknown agent %q, add it as [[docker.agent]] first", req.Name), http.StatusNotFound)
+				return
+			}
+
+			certPEM, keyPEM, rec, err := agentCA.Issue(req.Name, time.Duration(req.Days)*24*time.Hour)
+			if err != nil {
+				log.Printf("Failed to issue certificate for %s: %v", req.Name, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			log.Printf("Issued agent certificate %s for %s", rec.Serial, rec.Name)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"serial":      rec.Serial,
+				"name":        rec.Name,
+				"notAfter":    rec.NotAfter,
+				"certificate": string(certPEM),
+				"key":         string(keyPEM),
+				"ca":          string(agentCA.CertPEM()),
+			})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	// API endpoint: DELETE /api/agents/certificates/{serial}
+	// Revokes an agent certificate and disconnects the agent using it (requires API token)
+	mux.HandleFunc("/api/agents/certificates/{serial}", requireToken(store, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if agentCA == nil {
+			http.Error(w, "mTLS is not enabled, set [docker.mtls] enabled = true", http.StatusConflict)
+			return
+		}
+
+		rec, err := agentServer.RevokeCertificate(r.PathValue("serial"))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, pki.ErrUnknownCertificate) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		log.Printf("Revoked agent certificate %s for %s", rec.Serial, rec.Name)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"certificate": rec,
+		})
+	}))
+
 	// Serve static files (if directory exists) under /static/
 	staticDir := util.ResolveDir(envStaticDir, devStaticDir, containerStaticDir)
 	if _, err := os.Stat(staticDir); err == nil {
@@ -1060,11 +2085,262 @@ func main() {
 		})
 	}
 
+	// Agent-Listener mit mTLS
+	if agentCA != nil {
+		go serveAgentTLS(cfg.Docker.MTLS, agentCA, agentServer)
+	}
+
 	log.Println("herbst running at http://localhost:8080")
 	log.Println("Watching for config changes...")
 	log.Fatal(http.ListenAndServe(":8080", mux))
 }
 
+// storageOptions resolves the [storage] config, relative paths are inside the config directory
+func storageOptions(cfg config.Storage, configDir string) (storage.Options, error) {
+	opts := storage.Options{Path: cfg.Path}
+	if opts.Path == "" {
+		opts.Path = "history.log"
+	}
+	if !filepath.IsAbs(opts.Path) {
+		opts.Path = filepath.Join(configDir, opts.Path)
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		def   string
+		dst   *time.Duration
+	}{
+		{"retention", cfg.Retention, "30d", &opts.Retention},
+		{"downsample-after", cfg.DownsampleAfter, "7d", &opts.DownsampleAfter},
+		{"compact-interval", cfg.CompactInterval, "1h", &opts.CompactInterval},
+	}
+	for _, d := range durations {
+		v := d.value
+		if v == "" {
+			v = d.def
+		}
+		parsed, err := util.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			return opts, fmt.Errorf("%s: invalid duration %q", d.name, v)
+		}
+		*d.dst = parsed
+	}
+	if opts.CompactInterval < time.Minute {
+		return opts, fmt.Errorf("compact-interval: must be at least 1m")
+	}
+	return opts, nil
+}
+
+// uptimeQuery parses the range and buckets parameters of the uptime endpoints
+func uptimeQuery(q url.Values, defRange time.Duration, defBuckets int) (time.Duration, int, error) {
+	window, buckets := defRange, defBuckets
+	if v := q.Get("range"); v != "" {
+		d, err := util.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return 0, 0, errors.New("Invalid range, use a duration like 24h, 7d or 90d")
+		}
+		window = d
+	}
+	if v := q.Get("buckets"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 500 {
+			return 0, 0, errors.New("Invalid buckets, use 0-500")
+		}
+		buckets = n
+	}
+	return window, buckets, nil
+}
+
+// uptimeSLA returns the uptime percentages of service id over the usual SLA windows
+func uptimeSLA(tracker *uptime.Tracker, id string, now time.Time) map[string]*float64 {
+	windows := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"24h", 24 * time.Hour},
+		{"7d", 7 * 24 * time.Hour},
+		{"30d", 30 * 24 * time.Hour},
+	}
+	sla := make(map[string]*float64, len(windows))
+	for _, w := range windows {
+		sla[w.name] = tracker.Report(id, now.Add(-w.d), now, 0, false).Uptime
+	}
+	return sla
+}
+
+// configureHealth hands the services with online-badge and the [health] settings to the scheduler
+func configureHealth(sched *health.Scheduler, cfg *config.Config, configDir string) {
+	var targets []health.Target
+	add := func(section string, svc config.Service) {
+		if !svc.OnlineBadge {
+			return
+		}
+		t, err := health.NewTarget(section, svc)
+		if err != nil {
+			log.Printf("Invalid check for service %s: %v", svc.Name, err)
+		}
+		targets = append(targets, t)
+	}
+	for _, svc := range cfg.Services {
+		add("", svc)
+	}
+	for _, sec := range cfg.Sections {
+		for _, svc := range sec.Services {
+			add(sec.Title, svc)
+		}
+	}
+
+	// Zero durations make the scheduler use its defaults
+	parse := func(name, value string) time.Duration {
+		if value == "" {
+			return 0
+		}
+		d, err := util.ParseDuration(value)
+		if err != nil || d <= 0 {
+			log.Printf("Invalid [health] %s %q, using the default", name, value)
+			return 0
+		}
+		return d
+	}
+	opts := health.Options{
+		Interval:   parse("interval", cfg.Health.Interval),
+		Timeout:    parse("timeout", cfg.Health.Timeout),
+		TLSWarning: parse("tls-expiry-warning", cfg.Health.TLSExpiryWarning),
+	}
+	opts.MaxConcurrent = cfg.Health.MaxConcurrent
+	opts.Policy.MaxRedirects = health.DefaultMaxRedirects
+	if cfg.Health.MaxRedirects != nil {
+		opts.Policy.MaxRedirects = max(*cfg.Health.MaxRedirects, 0)
+	}
+	for _, scheme := range cfg.Health.Schemes {
+		opts.Policy.Schemes = append(opts.Policy.Schemes, strings.ToLower(scheme))
+	}
+	allow, errAllow := util.ParsePrefixes(cfg.Health.AllowCIDRs)
+	deny, errDeny := util.ParsePrefixes(cfg.Health.DenyCIDRs)
+	if err := errors.Join(errAllow, errDeny); err != nil {
+		// A broken list must not silently allow everything
+		log.Printf("Invalid [health] allow-cidrs / deny-cidrs, all checks are blocked: %v", err)
+		deny = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+	}
+	opts.Policy.Allow = allow
+	opts.Policy.Deny = deny
+
+	if opts.Interval > 0 && opts.Interval < time.Second {
+		log.Printf("[health] interval %s is too short, using 1s", opts.Interval)
+		opts.Interval = time.Second
+	}
+
+	// Private CA for internal services, trusted in addition to the system roots
+	if cfg.Health.TLSCA != "" {
+		path := cfg.Health.TLSCA
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(configDir, path)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Failed to read [health] tls-ca: %v", err)
+		} else if !roots.AppendCertsFromPEM(data) {
+			log.Printf("No certificates found in [health] tls-ca %s", path)
+		} else {
+			opts.TLSRoots = roots
+		}
+	}
+
+	sched.SetTargets(targets, opts)
+}
+
+// recordHistory samples herbst's own host every second and stores agent
+// metrics whenever a node reported new ones
+func recordHistory(hist *history.Store, sampler *sysinfo.Sampler, store *ConfigStore, registry *agents.Registry) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	recorded := make(map[string]time.Time) // node -> MetricsAt of the last recorded sample
+	lastPrune := time.Now()
+	var lastTemps time.Time
+
+	for now := range ticker.C {
+		sys := store.Get().System
+		if sys.Enabled {
+			// Only the cheap values every second, the sensors once per 10s tier
+			m := sysinfo.Usage(sampler, sysinfo.Options{
+				Disks:      sys.Disks,
+				Interfaces: sys.Interfaces,
+			})
+			if now.Sub(lastTemps) >= 10*time.Second {
+				m.Temperatures = sysinfo.Temperatures()
+				lastTemps = now
+			}
+			hist.RecordHost(history.LocalNode, now, m)
+		}
+
+		for name, ns := range registry.Snapshot() {
+			if ns.Metrics != nil && ns.MetricsAt.After(recorded[name]) {
+				hist.RecordHost(name, ns.MetricsAt, *ns.Metrics)
+				recorded[name] = ns.MetricsAt
+			}
+		}
+
+		if now.Sub(lastPrune) > 10*time.Minute {
+			hist.Prune(now)
+			lastPrune = now
+		}
+	}
+}
+
+// watchDockerEvents follows the local Docker event stream and calls onChange on
+// every state change. The watch restarts when the Docker config changes.
+func watchDockerEvents(store *ConfigStore, onChange func()) {
+	for {
+		dockerCfg := store.Get().Docker
+		if !dockerCfg.Enabled {
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			for ctx.Err() == nil {
+				time.Sleep(10 * time.Second)
+				if store.Get().Docker != dockerCfg {
+					log.Println("Docker config changed, restarting event watch")
+					cancel()
+				}
+			}
+		}()
+
+		log.Printf("Watching Docker events on %s", dockerCfg.SocketPath)
+		docker.NewClient(dockerCfg.SocketPath).WatchContainers(ctx, 250*time.Millisecond, onChange)
+		cancel()
+	}
+}
+
+// sampleContainerStats refreshes the stats of the local containers while
+// someone looks at them; after a few idle minutes sampling pauses until the
+// next container list is requested.
+func sampleContainerStats(store *ConfigStore, cache *docker.StatsCache) {
+	ticker := time.NewTicker(containerStatsInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		dockerCfg := store.Get().Docker
+		if !dockerCfg.Enabled || cache.Idle(3*time.Minute) {
+			cache.Reset()
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), containerStatsInterval)
+		if err := cache.Refresh(ctx, docker.NewClient(dockerCfg.SocketPath)); err != nil {
+			log.Printf("Failed to sample container stats: %v", err)
+		}
+		cancel()
+	}
+}
+
 func watchFiles(store *ConfigStore, configPath, themesPath string) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -1114,6 +2390,12 @@ func watchFiles(store *ConfigStore, configPath, themesPath string) {
 					}
 					debounceTimer = time.AfterFunc(debounceDelay, func() {
 						log.Printf("Detected change in: %s", changedFile)
+						// Saves through the API are in the history already and skipped
+						for _, path := range []string{configPath, themesPath} {
+							if err := store.recordFromDisk(path); err != nil {
+								log.Printf("Failed to keep %s in the revision history: %v", filepath.Base(path), err)
+							}
+						}
 						if err := store.Reload(); err != nil {
 							log.Printf("Failed to reload config: %v", err)
 						}
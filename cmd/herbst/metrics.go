@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"herbst/internal/agents"
+	"herbst/internal/docker"
+	"herbst/internal/health"
+	"herbst/internal/history"
+	"herbst/internal/proto"
+	"herbst/internal/sysinfo"
+)
+
+// promWriter writes the Prometheus text exposition format.
+// All samples of a metric family must be written right after its header.
+type promWriter struct {
+	w io.Writer
+}
+
+func (p *promWriter) family(name, typ, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one value; labels are name/value pairs
+func (p *promWriter) sample(name string, v float64, labels ...string) {
+	var sb strings.Builder
+	sb.WriteString(name)
+	if len(labels) > 0 {
+		sb.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(labels[i])
+			sb.WriteString(`="`)
+			sb.WriteString(labelEscaper.Replace(labels[i+1]))
+			sb.WriteByte('"')
+		}
+		sb.WriteByte('}')
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	sb.WriteByte('\n')
+	io.WriteString(p.w, sb.String())
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// nodeMetrics is the host metrics of one node, "local" is herbst's own host
+type nodeMetrics struct {
+	node string
+	m    proto.HostMetrics
+}
+
+// metricsHandler serves GET /metrics in Prometheus text format
+func metricsHandler(store *ConfigStore, sampler *sysinfo.Sampler, registry *agents.Registry, checks *health.Scheduler, broker *SSEBroker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		cfg := store.Config()
+		apiCfg := store.Get()
+		nodes := registry.Snapshot()
+
+		// Host metrics: herbst itself plus every agent that reports them
+		hosts := []nodeMetrics{}
+		if apiCfg.System.Enabled {
+			hosts = append(hosts, nodeMetrics{history.LocalNode, sysinfo.Collect(sampler, sysinfo.Options{
+				Disks:      apiCfg.System.Disks,
+				Interfaces: apiCfg.System.Interfaces,
+			})})
+		}
+		for _, a := range cfg.Docker.Agents {
+			if ns, ok := nodes[a.Name]; ok && ns.Metrics != nil {
+				hosts = append(hosts, nodeMetrics{a.Name, *ns.Metrics})
+			}
+		}
+
+		// Local containers are listed on every scrape, stats would take a second per container
+		type nodeContainers struct {
+			node       string
+			containers []proto.Container
+		}
+		containers := []nodeContainers{}
+		if apiCfg.Docker.Enabled {
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			list, err := docker.NewClient(apiCfg.Docker.SocketPath).ListContainers(ctx)
+			cancel()
+			if err == nil {
+				containers = append(containers, nodeContainers{history.LocalNode, list})
+			}
+		}
+		for _, a := range cfg.Docker.Agents {
+			if ns, ok := nodes[a.Name]; ok && ns.Connected {
+				containers = append(containers, nodeContainers{a.Name, ns.Containers})
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		p := &promWriter{w: w}
+
+		p.family("herbst_build_info", "gauge", "herbst version")
+		p.sample("herbst_build_info", 1, "version", Version)
+
+		// ---- Host ----
+		p.family("herbst_cpu_usage_percent", "gauge", "Total CPU usage in percent")
+		for _, h := range hosts {
+			p.sample("herbst_cpu_usage_percent", h.m.CPU.Percent, "node", h.node)
+		}
+		p.family("herbst_cpu_threads", "gauge", "Number of logical CPUs")
+		for _, h := range hosts {
+			p.sample("herbst_cpu_threads", float64(h.m.CPU.Threads), "node", h.node)
+		}
+		p.family("herbst_memory_total_bytes", "gauge", "Total memory")
+		for _, h := range hosts {
+			p.sample("herbst_memory_total_bytes", float64(h.m.Memory.Total), "node", h.node)
+		}
+		p.family("herbst_memory_used_bytes", "gauge", "Used memory")
+		for _, h := range hosts {
+			p.sample("herbst_memory_used_bytes", float64(h.m.Memory.Used), "node", h.node)
+		}
+		p.family("herbst_swap_total_bytes", "gauge", "Total swap")
+		for _, h := range hosts {
+			p.sample("herbst_swap_total_bytes", float64(h.m.Swap.Total), "node", h.node)
+		}
+		p.family("herbst_swap_used_bytes", "gauge", "Used swap")
+		for _, h := range hosts {
+			p.sample("herbst_swap_used_bytes", float64(h.m.Swap.Used), "node", h.node)
+		}
+		p.family("herbst_load", "gauge", "Load average")
+		for _, h := range hosts {
+			p.sample("herbst_load", h.m.Load.Load1, "node", h.node, "period", "1m")
+			p.sample("herbst_load", h.m.Load.Load5, "node", h.node, "period", "5m")
+			p.sample("herbst_load", h.m.Load.Load15, "node", h.node, "period", "15m")
+		}
+		p.family("herbst_uptime_seconds", "gauge", "Host uptime")
+		for _, h := range hosts {
+			p.sample("herbst_uptime_seconds", float64(h.m.Host.Uptime), "node", h.node)
+		}
+		p.family("herbst_disk_total_bytes", "gauge", "Filesystem size")
+		for _, h := range hosts {
+			for _, d := range hostDisks(h.m) {
+				p.sample("herbst_disk_total_bytes", float64(d.Total), "node", h.node, "path", d.Path)
+			}
+		}
+		p.family("herbst_disk_used_bytes", "gauge", "Used filesystem space")
+		for _, h := range hosts {
+			for _, d := range hostDisks(h.m) {
+				p.sample("herbst_disk_used_bytes", float64(d.Used), "node", h.node, "path", d.Path)
+			}
+		}
+		p.family("herbst_network_receive_bytes_total", "counter", "Bytes received per interface")
+		for _, h := range hosts {
+			for _, n := range h.m.Network {
+				p.sample("herbst_network_receive_bytes_total", float64(n.RxBytes), "node", h.node, "interface", n.Interface)
+			}
+		}
+		p.family("herbst_network_transmit_bytes_total", "counter", "Bytes sent per interface")
+		for _, h := range hosts {
+			for _, n := range h.m.Network {
+				p.sample("herbst_network_transmit_bytes_total", float64(n.TxBytes), "node", h.node, "interface", n.Interface)
+			}
+		}
+		p.family("herbst_temperature_celsius", "gauge", "Hardware sensor temperature")
+		for _, h := range hosts {
+			for _, t := range h.m.Temperatures {
+				p.sample("herbst_temperature_celsius", t.Celsius, "node", h.node, "sensor", t.Sensor)
+			}
+		}
+
+		// ---- Containers ----
+		p.family("herbst_container_running", "gauge", "1 if the container is running; the state label has Docker's state")
+		for _, nc := range containers {
+			for _, c := range nc.containers {
+				p.sample("herbst_container_running", boolValue(c.State == "running"),
+					"node", nc.node, "name", c.Name, "id", docker.ShortID(c.ID), "image", c.Image, "state", c.State)
+			}
+		}
+		p.family("herbst_container_cpu_percent", "gauge", "Container CPU usage (agent nodes)")
+		for _, nc := range containers {
+			for _, c := range nc.containers {
+				if c.Stats != nil {
+					p.sample("herbst_container_cpu_percent", c.Stats.CPUPercent, "node", nc.node, "name", c.Name)
+				}
+			}
+		}
+		p.family("herbst_container_memory_usage_bytes", "gauge", "Container memory usage (agent nodes)")
+		for _, nc := range containers {
+			for _, c := range nc.containers {
+				if c.Stats != nil {
+					p.sample("herbst_container_memory_usage_bytes", float64(c.Stats.MemoryUsage), "node", nc.node, "name", c.Name)
+				}
+			}
+		}
+
+		// ---- Agents ----
+		agentNames := make([]string, 0, len(cfg.Docker.Agents))
+		for _, a := range cfg.Docker.Agents {
+			agentNames = append(agentNames, a.Name)
+		}
+		sort.Strings(agentNames)
+
+		p.family("herbst_agent_connected", "gauge", "1 if the agent is connected")
+		for _, name := range agentNames {
+			p.sample("herbst_agent_connected", boolValue(nodes[name].Connected), "node", name)
+		}
+		p.family("herbst_agent_last_seen_seconds", "gauge", "Seconds since the agent was last heard from")
+		for _, name := range agentNames {
+			if ns, ok := nodes[name]; ok && !ns.LastSeen.IsZero() {
+				p.sample("herbst_agent_last_seen_seconds", time.Since(ns.LastSeen).Seconds(), "node", name)
+			}
+		}
+		p.family("herbst_agent_info", "gauge", "Protocol and build version of connected agents")
+		for _, name := range agentNames {
+			if ns, ok := nodes[name]; ok && ns.Connected {
+				p.sample("herbst_agent_info", 1, "node", name, "protocol", strconv.Itoa(ns.Version), "agent_version", ns.AgentVersion)
+			}
+		}
+
+		// ---- Services ----
+		// Services that were not checked yet have no samples
+		services := []health.Status{}
+		for _, st := range checks.Status() {
+			if st.State != health.StatePending {
+				services = append(services, st)
+			}
+		}
+
+		p.family("herbst_service_up", "gauge", "1 if the last health check succeeded")
+		for _, s := range services {
+			p.sample("herbst_service_up", boolValue(s.State == health.StateUp), "id", s.ID, "section", s.Section, "service", s.Name, "url", s.URL)
+		}
+		p.family("herbst_service_latency_seconds", "gauge", "Response time of the last health check")
+		for _, s := range services {
+			p.sample("herbst_service_latency_seconds", s.LatencyMs/1000, "id", s.ID, "section", s.Section, "service", s.Name, "url", s.URL)
+		}
+		p.family("herbst_service_last_check_timestamp_seconds", "gauge", "Unix time of the last health check")
+		for _, s := range services {
+			p.sample("herbst_service_last_check_timestamp_seconds", float64(s.CheckedAt.Unix()), "id", s.ID, "section", s.Section, "service", s.Name, "url", s.URL)
+		}
+		p.family("herbst_service_last_change_timestamp_seconds", "gauge", "Unix time the service last went up or down")
+		for _, s := range services {
+			p.sample("herbst_service_last_change_timestamp_seconds", float64(s.ChangedAt.Unix()), "id", s.ID, "section", s.Section, "service", s.Name, "url", s.URL)
+		}
+
+		// Only HTTPS services have a certificate
+		p.family("herbst_service_tls_expiry_timestamp_seconds", "gauge", "Unix time the earliest certificate in the chain expires")
+		for _, s := range services {
+			if s.TLS != nil {
+				p.sample("herbst_service_tls_expiry_timestamp_seconds", float64(s.TLS.NotAfter.Unix()), "id", s.ID, "service", s.Name, "issuer", s.TLS.Issuer)
+			}
+		}
+		p.family("herbst_service_tls_trusted", "gauge", "1 if the certificate chain is trusted")
+		for _, s := range services {
+			if s.TLS != nil {
+				p.sample("herbst_service_tls_trusted", boolValue(s.TLS.Trusted), "id", s.ID, "service", s.Name)
+			}
+		}
+		p.family("herbst_service_tls_hostname_match", "gauge", "1 if the certificate is valid for the host name")
+		for _, s := range services {
+			if s.TLS != nil {
+				p.sample("herbst_service_tls_hostname_match", boolValue(s.TLS.HostnameMatch), "id", s.ID, "service", s.Name)
+			}
+		}
+
+		// ---- herbst ----
+		p.family("herbst_sse_clients", "gauge", "Connected browser event streams")
+		p.sample("herbst_sse_clients", float64(broker.ClientCount()))
+	}
+}
+
+// hostDisks returns all monitored disks, older agents only report one
+func hostDisks(m proto.HostMetrics) []proto.DiskMetrics {
+	if len(m.Disks) > 0 {
+		return m.Disks
+	}
+	if m.Disk.Total > 0 {
+		return []proto.DiskMetrics{m.Disk}
+	}
+	return nil
+}
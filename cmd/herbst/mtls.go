@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"herbst/internal/agents"
+	"herbst/internal/config"
+	"herbst/internal/pki"
+)
+
+const defaultMTLSListen = ":8443"
+
+// caDir is where the agent CA lives, next to config.toml
+func caDir(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "pki")
+}
+
+// serveAgentTLS runs the mutual TLS listener for agents. It only serves the
+// agent WebSocket; agents must present a certificate issued by ca.
+func serveAgentTLS(mtls config.DockerMTLS, ca *pki.CA, agentServer *agents.Server) {
+	serverCert, err := ca.ServerCertificate(mtls.ServerNames)
+	if err != nil {
+		log.Fatalf("Failed to issue mTLS server certificate: %v", err)
+	}
+
+	addr := mtls.Listen
+	if addr == "" {
+		addr = defaultMTLSListen
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/agents/ws", agentServer.HandleWS)
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    ca.Pool(),
+			MinVersion:   tls.VersionTLS12,
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("Agent mTLS listener running at wss://%s/api/agents/ws", addr)
+	log.Fatal(srv.ListenAndServeTLS("", ""))
+}
+
+// runCertCommand handles "herbst cert ..." for enrolling and revoking agents offline
+func runCertCommand(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, `Usage:
+  herbst cert issue [-out DIR] [-days N] <agent-name>
+  herbst cert revoke <serial>
+  herbst cert list`)
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	cfg, configPath, err := config.EnsureAndLoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	ca, err := pki.LoadOrCreateCA(caDir(configPath))
+	if err != nil {
+		log.Fatalf("Failed to load agent CA: %v", err)
+	}
+
+	switch args[0] {
+	case "issue":
+		fs := flag.NewFlagSet("issue", flag.ExitOnError)
+		out := fs.String("out", ".", "directory for the certificate files")
+		days := fs.Int("days", int(pki.DefaultClientValidity/(24*time.Hour)), "validity in days")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			usage()
+		}
+		name := fs.Arg(0)
+
+		// Same rule as POST /api/agents/certificates: the CN becomes the node name
+		known := false
+		for _, a := range cfg.Docker.Agents {
+			if a.Name == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			log.Fatalf("Unknown agent %q, add it as [[docker.agent]] first", name)
+		}
+
+		certPEM, keyPEM, rec, err := ca.Issue(name, time.Duration(*days)*24*time.Hour)
+		if err != nil {
+			log.Fatalf("Failed to issue certificate: %v", err)
+		}
+
+		files := map[string][]byte{
+			name + ".crt": certPEM,
+			name + ".key": keyPEM,
+			"ca.crt":      ca.CertPEM(),
+		}
+		for file, data := range files {
+			perm := os.FileMode(0o644)
+			if filepath.Ext(file) == ".key" {
+				perm = 0o600
+			}
+			if err := os.WriteFile(filepath.Join(*out, file), data, perm); err != nil {
+				log.Fatalf("Failed to write %s: %v", file, err)
+			}
+		}
+		fmt.Printf("Issued certificate %s for %s (valid until %s)\n", rec.Serial, name, rec.NotAfter.Format("2006-01-02"))
+		fmt.Printf("Wrote %s.crt, %s.key and ca.crt to %s\n", name, name, *out)
+
+	case "revoke":
+		if len(args) != 2 {
+			usage()
+		}
+		rec, err := ca.Revoke(args[1])
+		if err != nil {
+			log.Fatalf("Failed to revoke certificate: %v", err)
+		}
+		fmt.Printf("Revoked certificate %s for %s\n", rec.Serial, rec.Name)
+
+	case "list":
+		list, err := ca.List()
+		if err != nil {
+			log.Fatalf("Failed to read certificates: %v", err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SERIAL\tNAME\tEXPIRES\tSTATUS")
+		for _, rec := range list {
+			status := "valid"
+			if rec.RevokedAt != nil {
+				status = "revoked " + rec.RevokedAt.Format("2006-01-02")
+			} else if time.Now().After(rec.NotAfter) {
+				status = "expired"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", rec.Serial, rec.Name, rec.NotAfter.Format("2006-01-02"), status)
+		}
+		tw.Flush()
+
+	default:
+		usage()
+	}
+}
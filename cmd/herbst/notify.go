@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"herbst/internal/agents"
+	"herbst/internal/alerts"
+	"herbst/internal/config"
+	"herbst/internal/docker"
+	"herbst/internal/health"
+	"herbst/internal/history"
+	"herbst/internal/notify"
+	"herbst/internal/proto"
+)
+
+// agentGrace is how long an agent may be gone before an alert is sent, so
+// restarts and updates of the agent stay quiet
+const agentGrace = 30 * time.Second
+
+// exitCodeRe finds the exit code in a container status like "Exited (137) 5 minutes ago"
+var exitCodeRe = regexp.MustCompile(`^Exited \((\d+)\)`)
+
+// configureNotify hands the [[notify]] channels to the manager
+func configureNotify(alerts *notify.Manager, cfg *config.Config) {
+	channels, err := notify.NewChannels(cfg.Notify)
+	if err != nil {
+		log.Printf("Invalid notify config: %v", err)
+	}
+	alerts.SetChannels(channels)
+}
+
+// configureAlerts hands the [[alert]] rules to the engine
+func configureAlerts(engine *alerts.Engine, cfg *config.Config) {
+	rules, err := alerts.NewRules(cfg.Alerts)
+	if err != nil {
+		log.Printf("Invalid alert config: %v", err)
+	}
+	engine.SetRules(rules)
+}
+
+// serviceAlert fires or resolves the alert of a service that went down or up
+func serviceAlert(alerts *notify.Manager, st health.Status) {
+	key := "service:" + st.ID
+	switch st.State {
+	case health.StateDown:
+		alerts.Fire(notify.Alert{
+			Key:      key,
+			Kind:     notify.KindService,
+			Severity: notify.SeverityCritical,
+			Title:    fmt.Sprintf("Service %s is down", st.Name),
+			Message:  st.Error,
+			Labels:   map[string]string{"service": st.ID, "name": st.Name, "section": st.Section, "url": st.URL},
+			Since:    st.ChangedAt,
+		})
+	case health.StateUp:
+		alerts.Resolve(key, fmt.Sprintf("Service %s is up again", st.Name), "")
+	}
+}
+
+// stateWatcher sends alerts when agents disconnect and containers die, and
+// evaluates the [[alert]] rules. It looks at the current state whenever agents
+// or local containers change (poke) and every 10 seconds, which is also the
+// resolution of rule for-durations; alerts fire on transitions, so containers
+// that were already stopped when herbst started stay quiet.
+type stateWatcher struct {
+	alerts   *notify.Manager
+	engine   *alerts.Engine
+	store    *ConfigStore
+	registry *agents.Registry
+	checks   *health.Scheduler
+	hist     *history.Store
+	poke     chan struct{}
+
+	running map[string]bool // container alert key -> seen running
+}
+
+func newStateWatcher(manager *notify.Manager, engine *alerts.Engine, store *ConfigStore, registry *agents.Registry, checks *health.Scheduler, hist *history.Store) *stateWatcher {
+	return &stateWatcher{
+		alerts:   manager,
+		engine:   engine,
+		store:    store,
+		registry: registry,
+		checks:   checks,
+		hist:     hist,
+		poke:     make(chan struct{}, 1),
+		running:  make(map[string]bool),
+	}
+}
+
+// Poke schedules an evaluation, it never blocks
+func (w *stateWatcher) Poke() {
+	select {
+	case w.poke <- struct{}{}:
+	default:
+	}
+}
+
+func (w *stateWatcher) Run() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		w.evaluate()
+		select {
+		case <-w.poke:
+			// Let a burst of changes settle
+			time.Sleep(time.Second)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *stateWatcher) evaluate() {
+	cfg := w.store.Config()
+	configured := make(map[string]bool, len(cfg.Docker.Agents))
+	for _, a := range cfg.Docker.Agents {
+		configured[a.Name] = true
+	}
+
+	// Containers are only judged on nodes whose list is current
+	seen := make(map[string]bool)
+	evaluated := make(map[string]bool)
+	snap := alerts.Snapshot{
+		Time:       time.Now(),
+		Metrics:    w.hist.Latest(2 * time.Minute),
+		Agents:     make(map[string]bool, len(configured)),
+		Containers: make(map[string][]proto.Container),
+		Services:   w.checks.Status(),
+	}
+	for name := range configured {
+		snap.Agents[name] = false
+	}
+
+	for name, ns := range w.registry.Snapshot() {
+		key := "agent:" + name
+		switch {
+		case !configured[name]:
+			w.alerts.Forget(key)
+		case ns.Connected:
+			w.alerts.Resolve(key, fmt.Sprintf("Agent %s reconnected", name), "")
+		case !ns.LastSeen.IsZero() && time.Since(ns.LastSeen) >= agentGrace:
+			w.alerts.Fire(notify.Alert{
+				Key:      key,
+				Kind:     notify.KindAgent,
+				Severity: notify.SeverityCritical,
+				Title:    fmt.Sprintf("Agent %s disconnected", name),
+				Message:  fmt.Sprintf("Last seen %s", ns.LastSeen.Format("2006-01-02 15:04:05")),
+				Labels:   map[string]string{"node": name},
+				Since:    ns.LastSeen,
+			})
+		}
+
+		if ns.Connected && configured[name] {
+			snap.Agents[name] = true
+			snap.Containers[name] = ns.Containers
+			evaluated[name] = true
+			for _, c := range ns.Containers {
+				seen[w.container(name, c)] = true
+			}
+		}
+	}
+
+	if dockerCfg := w.store.Get().Docker; dockerCfg.Enabled {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		list, err := docker.NewClient(dockerCfg.SocketPath).ListContainers(ctx)
+		cancel()
+		if err == nil {
+			snap.Containers[history.LocalNode] = list
+			evaluated[history.LocalNode] = true
+			for _, c := range list {
+				seen[w.container(history.LocalNode, c)] = true
+			}
+		}
+	}
+
+	// Removed containers are not an outage
+	for key := range w.running {
+		node := containerNode(key)
+		if evaluated[node] && !seen[key] {
+			delete(w.running, key)
+			w.alerts.Forget(key)
+		}
+	}
+
+	// Neither are removed services
+	checked := make(map[string]bool)
+	for _, st := range snap.Services {
+		checked[st.ID] = true
+	}
+	for _, a := range w.alerts.Active() {
+		if a.Kind == notify.KindService && !checked[a.Labels["service"]] {
+			w.alerts.Forget(a.Key)
+		}
+	}
+
+	w.engine.Evaluate(snap)
+}
+
+// container updates the alert of one container and returns its key
+func (w *stateWatcher) container(node string, c proto.Container) string {
+	key := "container:" + node + "/" + c.Name
+	labels := map[string]string{"node": node, "container": c.Name, "image": c.Image}
+
+	switch c.State {
+	case "running":
+		w.running[key] = true
+		w.alerts.Resolve(key, fmt.Sprintf("Container %s on %s is running again", c.Name, node), c.Status)
+	case "restarting":
+		// Crash loops are worth an alert even if herbst never saw the container run
+		w.running[key] = true
+		w.alerts.Fire(notify.Alert{
+			Key:      key,
+			Kind:     notify.KindContainer,
+			Severity: notify.SeverityWarning,
+			Title:    fmt.Sprintf("Container %s on %s is restarting", c.Name, node),
+			Message:  c.Status,
+			Labels:   labels,
+		})
+	case "exited", "dead":
+		if !w.running[key] {
+			return key
+		}
+		// A clean exit (one-shot jobs, docker stop of a well-behaved app) is not an outage
+		if m := exitCodeRe.FindStringSubmatch(c.Status); m != nil && m[1] == "0" {
+			delete(w.running, key)
+			w.alerts.Resolve(key, fmt.Sprintf("Container %s on %s stopped", c.Name, node), c.Status)
+			return key
+		}
+		w.alerts.Fire(notify.Alert{
+			Key:      key,
+			Kind:     notify.KindContainer,
+			Severity: notify.SeverityWarning,
+			Title:    fmt.Sprintf("Container %s on %s died", c.Name, node),
+			Message:  c.Status,
+			Labels:   labels,
+		})
+	}
+	return key
+}
+
+// containerNode returns the node of a container alert key
+func containerNode(key string) string {
+	node, _, _ := strings.Cut(strings.TrimPrefix(key, "container:"), "/")
+	return node
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"herbst/internal/revisions"
+	"herbst/internal/util"
+)
+
+// authorDisk is the author of versions that were not saved through herbst
+const authorDisk = "disk"
+
+// recordFromDisk keeps the current content of path in the revision history,
+// unless it is the newest revision already
+func (cs *ConfigStore) recordFromDisk(path string) error {
+	cs.saveMu.Lock()
+	defer cs.saveMu.Unlock()
+	return cs.recordFromDiskLocked(path)
+}
+
+func (cs *ConfigStore) recordFromDiskLocked(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file := filepath.Base(path)
+	message := "changed on disk"
+	if _, ok := cs.revisions.Latest(file); !ok {
+		message = "initial version"
+	}
+	_, _, err = cs.revisions.Record(file, data, authorDisk, message)
+	return err
+}
+
+// saveRevision writes a config or themes file and keeps it in the revision
+// history. A version that was changed on disk since the last revision is kept
+// first, the file is not written if that fails. Saves are serialized, so
+// concurrent ones cannot record each other's version under the wrong author.
+func (cs *ConfigStore) saveRevision(path string, data []byte, author, message string) (revisions.Revision, error) {
+	cs.saveMu.Lock()
+	defer cs.saveMu.Unlock()
+
+	if err := cs.recordFromDiskLocked(path); err != nil && !os.IsNotExist(err) {
+		return revisions.Revision{}, fmt.Errorf("keeping the previous version: %w", err)
+	}
+	// Through a temporary file, a crash while saving must not truncate the running config
+	if err := util.WriteFileAtomic(path, data, 0o644); err != nil {
+		return revisions.Revision{}, err
+	}
+	// The file is saved at this point, a missing revision is not worth failing for
+	rev, _, err := cs.revisions.Record(filepath.Base(path), data, author, message)
+	if err != nil {
+		log.Printf("Failed to keep %s in the revision history: %v", filepath.Base(path), err)
+	}
+	return rev, nil
+}
+
+// revisionAuthor names who saved a file through the API: the user a trusted
+// reverse proxy authenticated (Remote-User, X-Forwarded-User), else the client
+// address. Anyone can send those headers, so without [api] trusted-proxies
+// they are ignored.
+func revisionAuthor(r *http.Request, trustedProxies []string) string {
+	trusted, _ := util.ParsePrefixes(trustedProxies) // invalid lists trust nobody
+	if util.FromTrustedProxy(r, trusted) {
+		for _, header := range []string{"Remote-User", "X-Forwarded-User"} {
+			if user := strings.TrimSpace(r.Header.Get(header)); user != "" {
+				if len(user) > 64 {
+					user = user[:64]
+				}
+				return user
+			}
+		}
+	}
+	return util.ClientIP(r, trusted)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"herbst/internal/alerts"
+	"herbst/internal/config"
+	"herbst/internal/health"
+	"herbst/internal/notify"
+	"herbst/internal/themes"
+)
+
+// maxConfigSize limits config.toml and themes.toml sent to the API
+const maxConfigSize = 1 << 20
+
+// readConfigBody reads a config file from the request body. Bodies over
+// maxConfigSize are refused with 413, it returns false after writing an error.
+func readConfigBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigSize))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, fmt.Sprintf("File too large (max %d bytes)", maxConfigSize), http.StatusRequestEntityTooLarge)
+		return nil, false
+	case err != nil:
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// validateConfig checks a config.toml before it is saved: strict decoding and
+// the checks of the config package, plus the ones only the packages that use
+// a setting can do (notify channels, alert rules, service checks, storage)
+func validateConfig(data []byte, configDir string) *config.Validation {
+	var themeNames map[string]string
+	if tf, _, err := themes.EnsureAndLoadThemes(); err == nil {
+		themeNames = make(map[string]string, len(tf.Themes))
+		for key, theme := range tf.Themes {
+			themeNames[key] = theme.Name
+		}
+	}
+
+	v := config.Validate(data, themeNames)
+	cfg := v.Config
+	if cfg == nil {
+		return v
+	}
+
+	for i, n := range cfg.Notify {
+		if err := notify.CheckChannel(n); err != nil {
+			v.Error(fmt.Sprintf("notify[%d]", i), "%v", err)
+		}
+	}
+	for i, r := range cfg.Alerts {
+		if err := alerts.CheckRule(r); err != nil {
+			v.Error(fmt.Sprintf("alert[%d]", i), "%v", err)
+		}
+	}
+
+	checkService := func(key, section string, svc config.Service) {
+		if svc.Check == nil {
+			return
+		}
+		if _, err := health.NewTarget(section, svc); err != nil {
+			v.Error(key+".check", "%v", err)
+		}
+	}
+	for i, svc := range cfg.Services {
+		checkService(fmt.Sprintf("service[%d]", i), "", svc)
+	}
+	for i, sec := range cfg.Sections {
+		for j, svc := range sec.Services {
+			checkService(fmt.Sprintf("section[%d].service[%d]", i, j), sec.Title, svc)
+		}
+	}
+
+	// Durations are checked by the config package, storageOptions knows the limits
+	if cfg.Storage.Enabled && v.Valid {
+		if _, err := storageOptions(cfg.Storage, configDir); err != nil {
+			v.Error("storage", "%v", err)
+		}
+	}
+	return v
+}
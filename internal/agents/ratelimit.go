@@ -0,0 +1,82 @@
+// internal/agents/ratelimit.go
+package agents
+
+import (
+	"sync"
+	"time"
+)
+
+// Failed agent logins are limited per client IP and per node name
+const (
+	maxAuthFailures   = 5 // failures allowed within authFailureWindow
+	authFailureWindow = 10 * time.Minute
+	authLockout       = 15 * time.Minute // how long a key stays locked after too many failures
+)
+
+type failureRecord struct {
+	count       int
+	first       time.Time // start of the current window
+	lockedUntil time.Time
+}
+
+// authLimiter tracks failed hello attempts and locks out keys that fail too often
+type authLimiter struct {
+	mu       sync.Mutex
+	failures map[string]*failureRecord
+}
+
+func newAuthLimiter() *authLimiter {
+	return &authLimiter{failures: make(map[string]*failureRecord)}
+}
+
+// locked reports whether key is locked out and for how much longer
+func (l *authLimiter) locked(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec, ok := l.failures[key]
+	if !ok || !now.Before(rec.lockedUntil) {
+		return false, 0
+	}
+	return true, rec.lockedUntil.Sub(now)
+}
+
+// fail records a failed attempt and returns true if key just got locked out
+func (l *authLimiter) fail(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	rec, ok := l.failures[key]
+	if !ok || now.Sub(rec.first) > authFailureWindow {
+		rec = &failureRecord{first: now}
+		l.failures[key] = rec
+	}
+	rec.count++
+
+	if rec.count >= maxAuthFailures && !now.Before(rec.lockedUntil) {
+		rec.lockedUntil = now.Add(authLockout)
+		// Start counting again once the lockout is over
+		rec.count = 0
+		rec.first = rec.lockedUntil
+		return true
+	}
+	return false
+}
+
+// reset forgets all failures of key after a successful login
+func (l *authLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
+
+// prune drops records that are neither locked nor inside their window. l.mu must be held.
+func (l *authLimiter) prune(now time.Time) {
+	for key, rec := range l.failures {
+		if now.After(rec.lockedUntil) && now.Sub(rec.first) > authFailureWindow {
+			delete(l.failures, key)
+		}
+	}
+}
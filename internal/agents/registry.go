@@ -14,6 +14,19 @@ type NodeState struct {
 	Connected  bool              `json:"connected"`
 	LastSeen   time.Time         `json:"lastSeen"`
 	Containers []proto.Container `json:"containers"`
+
+	// Handshake result of the current (or last) connection
+	Version      int      `json:"version"`                // negotiated protocol version
+	Capabilities []string `json:"capabilities"`           // accepted agent capabilities
+	AgentVersion string   `json:"agentVersion,omitempty"` // build version reported by the agent
+	Rejected     string   `json:"rejected,omitempty"`     // why the last connection attempt was refused
+
+	Metrics   *proto.HostMetrics `json:"metrics,omitempty"` // last host metrics, nil if the agent sends none
+	MetricsAt time.Time          `json:"metricsAt,omitempty"`
+
+	seq           uint64 // last applied sequence number (delta mode)
+	synced        bool   // a snapshot was received on the current connection
+	resyncPending bool   // a resync was requested and the snapshot has not arrived yet
 }
 
 type Registry struct {
@@ -32,29 +45,135 @@ func (r *Registry) SetConnected(nodeName string, kind string, connected bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	ns, ok := r.nodes[nodeName]
-	if !ok {
-		ns = &NodeState{Name: nodeName, Containers: []proto.Container{}}
-		r.nodes[nodeName] = ns
-	}
+	ns := r.node(nodeName)
 	ns.Kind = kind
 	ns.Connected = connected
 	ns.LastSeen = time.Now()
+	// Sequence numbers start over with every connection
+	ns.seq = 0
+	ns.synced = false
+	ns.resyncPending = false
 }
 
-func (r *Registry) UpdateContainers(nodeName string, kind string, containers []proto.Container) {
+// SetHandshake records the negotiated protocol of a freshly connected agent
+func (r *Registry) SetHandshake(nodeName string, version int, capabilities []string, agentVersion string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	ns := r.node(nodeName)
+	ns.Version = version
+	ns.Capabilities = capabilities
+	ns.AgentVersion = agentVersion
+	ns.Rejected = ""
+}
+
+// SetRejected records why an authenticated agent was refused (e.g. incompatible protocol version).
+// An already open connection of the same node is not affected.
+func (r *Registry) SetRejected(nodeName string, kind string, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ns := r.node(nodeName)
+	if ns.Kind == "" {
+		ns.Kind = kind
+	}
+	ns.Rejected = reason
+}
+
+// node returns the state for nodeName, creating it if needed. r.mu must be held.
+func (r *Registry) node(nodeName string) *NodeState {
 	ns, ok := r.nodes[nodeName]
 	if !ok {
-		ns = &NodeState{Name: nodeName}
+		ns = &NodeState{Name: nodeName, Containers: []proto.Container{}, Capabilities: []string{}}
 		r.nodes[nodeName] = ns
 	}
+	return ns
+}
+
+// UpdateContainers replaces the container list of a node with a full snapshot
+func (r *Registry) UpdateContainers(nodeName string, kind string, seq uint64, containers []proto.Container) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ns := r.node(nodeName)
+	ns.Kind = kind
+	ns.Connected = true
+	ns.Containers = containers
+	ns.LastSeen = time.Now()
+	ns.seq = seq
+	ns.synced = true
+	ns.resyncPending = false
+}
+
+// ApplyDelta applies added/changed/removed containers to a node.
+// If the delta does not directly follow the last snapshot or delta it is
+// dropped and applied is false; resync is true the first time this happens,
+// telling the caller to request a new snapshot from the agent.
+func (r *Registry) ApplyDelta(nodeName string, kind string, delta proto.ContainersDeltaMessage) (applied, resync bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ns := r.node(nodeName)
+	if !ns.synced || delta.Seq != ns.seq+1 {
+		// Ignore everything until the requested snapshot arrives
+		ns.synced = false
+		resync = !ns.resyncPending
+		ns.resyncPending = true
+		return false, resync
+	}
+
+	removed := make(map[string]bool, len(delta.Removed))
+	for _, id := range delta.Removed {
+		removed[id] = true
+	}
+	changed := make(map[string]proto.Container, len(delta.Changed))
+	for _, c := range delta.Changed {
+		changed[c.ID] = c
+	}
+
+	// Build a new slice, snapshots handed out earlier share the old one
+	containers := make([]proto.Container, 0, len(delta.Added)+len(ns.Containers))
+	containers = append(containers, delta.Added...) // newest first, like docker ps
+	for _, c := range ns.Containers {
+		if removed[c.ID] {
+			continue
+		}
+		if nc, ok := changed[c.ID]; ok {
+			c = nc
+		}
+		containers = append(containers, c)
+	}
+
 	ns.Kind = kind
 	ns.Connected = true
 	ns.Containers = containers
 	ns.LastSeen = time.Now()
+	ns.seq = delta.Seq
+	return true, false
+}
+
+// SetMetrics stores the latest host metrics reported by a node
+func (r *Registry) SetMetrics(nodeName string, kind string, m proto.HostMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ns := r.node(nodeName)
+	ns.Kind = kind
+	ns.Metrics = &m
+	ns.MetricsAt = time.Now()
+	ns.LastSeen = ns.MetricsAt
+}
+
+// Get returns a copy of a single node's state
+func (r *Registry) Get(nodeName string) (NodeState, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ns, ok := r.nodes[nodeName]
+	if !ok {
+		return NodeState{}, false
+	}
+	return *ns, true
 }
 
 func (r *Registry) Snapshot() map[string]NodeState {
@@ -0,0 +1,130 @@
+package agents
+
+import (
+	"slices"
+	"testing"
+
+	"herbst/internal/proto"
+)
+
+func containers(ids ...string) []proto.Container {
+	list := make([]proto.Container, len(ids))
+	for i, id := range ids {
+		list[i] = proto.Container{ID: id, Name: id, State: "running"}
+	}
+	return list
+}
+
+func ids(list []proto.Container) []string {
+	out := []string{}
+	for _, c := range list {
+		out = append(out, c.ID)
+	}
+	return out
+}
+
+func TestApplyDelta(t *testing.T) {
+	// Each step is a reconnect, a snapshot or a delta, applied in order to one node
+	type step struct {
+		connect  bool
+		snapshot []proto.Container
+		seq      uint64
+		delta    *proto.ContainersDeltaMessage
+		applied  bool
+		resync   bool
+		want     []string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "deltas in order",
+			steps: []step{
+				{snapshot: containers("a", "b"), seq: 1, want: []string{"a", "b"}},
+				{delta: &proto.ContainersDeltaMessage{Seq: 2, Added: containers("c")}, applied: true, want: []string{"c", "a", "b"}},
+				{delta: &proto.ContainersDeltaMessage{Seq: 3, Removed: []string{"a"}}, applied: true, want: []string{"c", "b"}},
+				{delta: &proto.ContainersDeltaMessage{Seq: 4, Changed: []proto.Container{{ID: "b", State: "exited"}}}, applied: true, want: []string{"c", "b"}},
+			},
+		},
+		{
+			name: "delta before the first snapshot",
+			steps: []step{
+				{delta: &proto.ContainersDeltaMessage{Seq: 1, Added: containers("a")}, resync: true, want: []string{}},
+				{snapshot: containers("a"), seq: 5, want: []string{"a"}},
+				{delta: &proto.ContainersDeltaMessage{Seq: 6, Added: containers("b")}, applied: true, want: []string{"b", "a"}},
+			},
+		},
+		{
+			name: "gap asks for one resync",
+			steps: []step{
+				{snapshot: containers("a"), seq: 1, want: []string{"a"}},
+				{delta: &proto.ContainersDeltaMessage{Seq: 3, Added: containers("c")}, resync: true, want: []string{"a"}},
+				// Deltas are ignored until the snapshot arrives, without asking again
+				{delta: &proto.ContainersDeltaMessage{Seq: 4, Added: containers("d")}, want: []string{"a"}},
+				{snapshot: containers("c", "d", "a"), seq: 5, want: []string{"c", "d", "a"}},
+				{delta: &proto.ContainersDeltaMessage{Seq: 6, Removed: []string{"d"}}, applied: true, want: []string{"c", "a"}},
+			},
+		},
+		{
+			name: "repeated sequence number",
+			steps: []step{
+				{snapshot: containers("a"), seq: 1, want: []string{"a"}},
+				{delta: &proto.ContainersDeltaMessage{Seq: 2, Added: containers("b")}, applied: true, want: []string{"b", "a"}},
+				{delta: &proto.ContainersDeltaMessage{Seq: 2, Added: containers("b")}, resync: true, want: []string{"b", "a"}},
+			},
+		},
+		{
+			name: "reconnect starts over",
+			steps: []step{
+				{snapshot: containers("a"), seq: 7, want: []string{"a"}},
+				{connect: true, want: []string{"a"}},
+				// The new connection counts from 1 again and needs a snapshot first
+				{delta: &proto.ContainersDeltaMessage{Seq: 8, Added: containers("b")}, resync: true, want: []string{"a"}},
+				{snapshot: containers("a"), seq: 1, want: []string{"a"}},
+				{delta: &proto.ContainersDeltaMessage{Seq: 2, Added: containers("b")}, applied: true, want: []string{"b", "a"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			for i, st := range tt.steps {
+				switch {
+				case st.connect:
+					r.SetConnected("n1", "docker", true)
+				case st.delta != nil:
+					applied, resync := r.ApplyDelta("n1", "docker", *st.delta)
+					if applied != st.applied || resync != st.resync {
+						t.Fatalf("step %d: ApplyDelta() = %v, %v, want %v, %v", i, applied, resync, st.applied, st.resync)
+					}
+				default:
+					r.UpdateContainers("n1", "docker", st.seq, st.snapshot)
+				}
+				ns, _ := r.Get("n1")
+				if got := ids(ns.Containers); !slices.Equal(got, st.want) {
+					t.Fatalf("step %d: containers = %v, want %v", i, got, st.want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyDeltaKeepsSnapshots(t *testing.T) {
+	r := NewRegistry()
+	r.UpdateContainers("n1", "docker", 1, containers("a", "b"))
+	before := r.Snapshot()["n1"].Containers
+
+	r.ApplyDelta("n1", "docker", proto.ContainersDeltaMessage{
+		Seq:     2,
+		Changed: []proto.Container{{ID: "a", State: "exited"}},
+		Removed: []string{"b"},
+	})
+
+	if got := ids(before); !slices.Equal(got, []string{"a", "b"}) || before[0].State != "running" {
+		t.Errorf("earlier snapshot changed to %+v", before)
+	}
+	if ns, _ := r.Get("n1"); ns.Containers[0].State != "exited" {
+		t.Errorf("changed container = %+v, want exited", ns.Containers[0])
+	}
+}
@@ -0,0 +1,167 @@
+// internal/agents/secret.go
+package agents
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"herbst/internal/util"
+)
+
+const (
+	envSecret       = "HERBST_AGENT_SECRET"
+	envSecretFile   = "HERBST_AGENT_SECRET_FILE" // e.g. /run/secrets/herbst_agent_secret
+	secretFilename  = "agent-secret"
+	minSecretLength = 16
+	secretBytes     = 32 // random bytes of a generated secret, stored hex encoded
+)
+
+// ErrSecretFromEnv is returned when rotating a secret that is managed outside of herbst
+var ErrSecretFromEnv = errors.New("agent secret is provided via " + envSecret + " or " + envSecretFile + ", change it there")
+
+// serverSecret is used to generate deterministic tokens for agents.
+// It is loaded from the environment or the config directory by LoadSecret,
+// so generated tokens survive restarts.
+var (
+	secretMu     sync.RWMutex
+	serverSecret []byte
+	secretPath   string // file the secret was loaded from, empty if it came from the environment
+)
+
+func getServerSecret() []byte {
+	secretMu.RLock()
+	secret := serverSecret
+	secretMu.RUnlock()
+	if secret != nil {
+		return secret
+	}
+
+	secretMu.Lock()
+	defer secretMu.Unlock()
+
+	if serverSecret == nil {
+		// LoadSecret was not called: fall back to a secret for the lifetime of the process
+		log.Println("Warning: agent secret not loaded, tokens will change on restart")
+		secret, err := newSecret()
+		if err != nil {
+			log.Printf("Warning: failed to generate secure secret: %v", err)
+			// Fallback to a less secure but functional secret
+			secret = []byte("herbst-fallback-secret-change-me")
+		}
+		serverSecret = secret
+	}
+	return serverSecret
+}
+
+// LoadSecret activates the agent token secret. It is taken from HERBST_AGENT_SECRET,
+// the file named by HERBST_AGENT_SECRET_FILE, or the agent-secret file in dir,
+// which is created with a random secret on first run.
+func LoadSecret(dir string) error {
+	secret, path, err := readSecret(dir)
+	if err != nil {
+		return err
+	}
+
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	serverSecret = secret
+	secretPath = path
+	return nil
+}
+
+func readSecret(dir string) ([]byte, string, error) {
+	if v := os.Getenv(envSecret); v != "" {
+		if len(v) < minSecretLength {
+			return nil, "", fmt.Errorf("%s must be at least %d characters", envSecret, minSecretLength)
+		}
+		log.Printf("Agent secret loaded from %s", envSecret)
+		return []byte(v), "", nil
+	}
+
+	if file := os.Getenv(envSecretFile); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, "", fmt.Errorf("read %s: %w", envSecretFile, err)
+		}
+		v := strings.TrimSpace(string(data))
+		if len(v) < minSecretLength {
+			return nil, "", fmt.Errorf("secret in %s must be at least %d characters", file, minSecretLength)
+		}
+		log.Printf("Agent secret loaded from %s", file)
+		return []byte(v), "", nil
+	}
+
+	path := filepath.Join(dir, secretFilename)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0o077 != 0 {
+			log.Printf("Warning: %s is readable by other users, fixing permissions", path)
+			if err := os.Chmod(path, 0o600); err != nil {
+				log.Printf("Warning: failed to fix permissions of %s: %v", path, err)
+			}
+		}
+		v := strings.TrimSpace(string(data))
+		if len(v) < minSecretLength {
+			return nil, "", fmt.Errorf("secret in %s must be at least %d characters", path, minSecretLength)
+		}
+		log.Printf("Agent secret loaded from %s", path)
+		return []byte(v), path, nil
+
+	case os.IsNotExist(err):
+		secret, err := newSecret()
+		if err != nil {
+			return nil, "", err
+		}
+		if err := writeSecretFile(path, secret); err != nil {
+			return nil, "", err
+		}
+		log.Printf("Agent secret created at %s", path)
+		return secret, path, nil
+
+	default:
+		return nil, "", err
+	}
+}
+
+// RotateSecret replaces the secret file with a new random secret.
+// All generated agent tokens change; configured tokens are not affected.
+func RotateSecret() error {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+
+	if secretPath == "" {
+		return ErrSecretFromEnv
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	if err := writeSecretFile(secretPath, secret); err != nil {
+		return err
+	}
+	serverSecret = secret
+	log.Printf("Agent secret rotated, generated tokens changed")
+	return nil
+}
+
+func newSecret() ([]byte, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+// writeSecretFile atomically writes the secret, readable only by the owner
+func writeSecretFile(path string, secret []byte) error {
+	return util.WriteFileAtomic(path, append(secret, '\n'), 0o600)
+}
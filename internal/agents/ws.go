@@ -5,38 +5,27 @@ import (
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
 	"herbst/internal/config"
+	"herbst/internal/pki"
 	"herbst/internal/proto"
+	"herbst/internal/util"
 
 	"nhooyr.io/websocket"
 )
 
-// serverSecret is used to generate deterministic tokens for agents
-// Generated once at startup, persists for the lifetime of the process
-var (
-	serverSecret     []byte
-	serverSecretOnce sync.Once
-)
-
-func getServerSecret() []byte {
-	serverSecretOnce.Do(func() {
-		serverSecret = make([]byte, 32)
-		if _, err := rand.Read(serverSecret); err != nil {
-			log.Printf("Warning: failed to generate secure secret: %v", err)
-			// Fallback to a less secure but functional secret
-			serverSecret = []byte("herbst-fallback-secret-change-me")
-		}
-	})
-	return serverSecret
-}
-
 // GenerateToken creates a deterministic token for an agent name
 // The token is derived from the agent name + server secret using HMAC-SHA256
 func GenerateToken(agentName string) string {
@@ -45,21 +34,112 @@ func GenerateToken(agentName string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+const (
+	// maxMessageSize is the largest message accepted from an agent
+	maxMessageSize = 8 << 20
+	// helloTimeout is how long a new connection may take to authenticate
+	helloTimeout = 10 * time.Second
+)
+
+var (
+	// ErrNotConnected is returned when a command targets an agent without an open connection
+	ErrNotConnected = errors.New("agent not connected")
+	// ErrUnsupported is returned when the agent did not offer the capability a command needs
+	ErrUnsupported = errors.New("agent does not support this command, update herbst-docker-agent")
+)
+
+// agentConn is a live agent connection that can receive commands
+type agentConn struct {
+	ws      *websocket.Conn
+	caps    []string // accepted capabilities
+	serial  string   // client certificate serial, empty for token auth
+	mu      sync.Mutex
+	pending map[string]chan proto.ResultMessage // correlation ID -> waiting caller
+	streams map[string]chan []proto.LogLine     // correlation ID -> followed log stream
+}
+
 type Server struct {
-	reg     *Registry
-	allowed map[string]string // nodeName -> token
-	mu      sync.RWMutex      // protects allowed map
+	reg         *Registry
+	allowed     map[string]string // nodeName -> token
+	generated   map[string]bool   // nodeNames whose token is derived from the server secret
+	requireCert bool              // token-only agents are refused ([docker.mtls] require)
+	proxies     []netip.Prefix    // trusted reverse proxies ([api] trusted-proxies)
+	mu          sync.RWMutex      // protects allowed, generated, requireCert and proxies
+
+	connsMu sync.RWMutex
+	conns   map[string]*agentConn // nodeName -> live connection
+
+	limiter *authLimiter       // failed login tracking per IP and node name
+	notify  func(event string) // called when node state changes (e.g. SSE broker)
+	version string             // herbst build version sent in the welcome message
+	ca      *pki.CA            // agent CA, nil when mTLS is disabled
 }
 
 func NewServer(cfg *config.Config, reg *Registry) *Server {
 	s := &Server{
 		reg:     reg,
 		allowed: make(map[string]string),
+		conns:   make(map[string]*agentConn),
+		limiter: newAuthLimiter(),
 	}
 	s.ReloadConfig(cfg)
 	return s
 }
 
+// supportedCapabilities are the agent features this server can use (protocol 2+)
+var supportedCapabilities = []string{
+	proto.CapCommands,
+	proto.CapLogsFollow,
+	proto.CapContainersDelta,
+	proto.CapContainerStats,
+	proto.CapMetrics,
+}
+
+// acceptCapabilities returns the agent capabilities the server supports for the negotiated version
+func acceptCapabilities(version int, offered []string) []string {
+	accepted := []string{}
+	if version < 2 {
+		return accepted
+	}
+	for _, c := range offered {
+		if slices.Contains(supportedCapabilities, c) && !slices.Contains(accepted, c) {
+			accepted = append(accepted, c)
+		}
+	}
+	return accepted
+}
+
+// SetServerVersion sets the herbst version reported to agents in the welcome message
+func (s *Server) SetServerVersion(v string) {
+	s.version = v
+}
+
+// SetNotifier registers a callback for node changes. It is called with
+// "nodes" whenever an agent connects, disconnects or is rejected, and with
+// "node-containers" when an agent sends new containers.
+func (s *Server) SetNotifier(fn func(event string)) {
+	s.notify = fn
+}
+
+// SetCA enables client certificate authentication with certificates issued by ca
+func (s *Server) SetCA(ca *pki.CA) {
+	s.ca = ca
+}
+
+func (s *Server) notifyChange() {
+	if s.notify != nil {
+		s.notify("nodes")
+	}
+}
+
+// notifyContainers reports new containers of a node, which only needs the
+// registry to be read again, not the agent list
+func (s *Server) notifyContainers() {
+	if s.notify != nil {
+		s.notify("node-containers")
+	}
+}
+
 // ReloadConfig updates the allowed agents from config
 func (s *Server) ReloadConfig(cfg *config.Config) {
 	s.mu.Lock()
@@ -67,6 +147,13 @@ func (s *Server) ReloadConfig(cfg *config.Config) {
 
 	// Clear and rebuild allowed map
 	s.allowed = make(map[string]string)
+	s.generated = make(map[string]bool)
+	s.requireCert = cfg.Docker.MTLS.Enabled && cfg.Docker.MTLS.Require
+	proxies, err := util.ParsePrefixes(cfg.API.TrustedProxies)
+	if err != nil {
+		log.Printf("Invalid [api] trusted-proxies, X-Forwarded-For is ignored: %v", err)
+	}
+	s.proxies = proxies
 	for _, a := range cfg.Docker.Agents {
 		if a.Token != "" {
 			// Use configured token if provided
@@ -74,12 +161,83 @@ func (s *Server) ReloadConfig(cfg *config.Config) {
 		} else {
 			// Generate token from agent name + server secret
 			s.allowed[a.Name] = GenerateToken(a.Name)
+			s.generated[a.Name] = true
 		}
 	}
 	log.Printf("Agent config reloaded: %d agents configured", len(s.allowed))
 }
 
+// RotateSecret replaces the server secret, so every generated agent token changes.
+// Agents connected with an old generated token are disconnected; agents with a
+// token set in config.toml are not affected.
+func (s *Server) RotateSecret() error {
+	if err := RotateSecret(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	names := make([]string, 0, len(s.generated))
+	for name := range s.generated {
+		s.allowed[name] = GenerateToken(name)
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+
+	s.connsMu.RLock()
+	for _, name := range names {
+		if ac, ok := s.conns[name]; ok {
+			log.Printf("Disconnecting %s: token revoked by secret rotation\n", name)
+			ac.ws.Close(websocket.StatusPolicyViolation, "token revoked")
+		}
+	}
+	s.connsMu.RUnlock()
+	return nil
+}
+
+// RevokeCertificate revokes an agent certificate and closes the
+// connection of the agent currently using it
+func (s *Server) RevokeCertificate(serial string) (pki.IssuedCert, error) {
+	if s.ca == nil {
+		return pki.IssuedCert{}, errors.New("mTLS is not enabled")
+	}
+	rec, err := s.ca.Revoke(serial)
+	if err != nil {
+		return rec, err
+	}
+
+	s.connsMu.RLock()
+	if ac, ok := s.conns[rec.Name]; ok && ac.serial == serial {
+		log.Printf("Disconnecting %s: certificate %s revoked\n", rec.Name, serial)
+		ac.ws.Close(websocket.StatusPolicyViolation, "certificate revoked")
+	}
+	s.connsMu.RUnlock()
+	return rec, nil
+}
+
 func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
+	// Clients with too many failed logins are turned away before the upgrade
+	ipKey := "ip:" + s.clientIP(r)
+	if locked, retry := s.limiter.locked(ipKey, time.Now()); locked {
+		log.Printf("agent login from %s refused: locked out for %s\n", r.RemoteAddr, retry.Round(time.Second))
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+		http.Error(w, "Too many failed attempts", http.StatusTooManyRequests)
+		return
+	}
+
+	// Agents on the mTLS listener are identified by their certificate CN.
+	// The TLS handshake already verified the chain, revocation is checked here.
+	var certName, certSerial string
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && s.ca != nil {
+		leaf := r.TLS.PeerCertificates[0]
+		if err := s.ca.Check(leaf); err != nil {
+			log.Printf("agent certificate %q from %s refused: %v\n", leaf.Subject.CommonName, r.RemoteAddr, err)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		certName = leaf.Subject.CommonName
+		certSerial = leaf.SerialNumber.Text(16)
+	}
+
 	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		// Allow connections from any origin for cross-network access
 		InsecureSkipVerify: true,
@@ -89,6 +247,9 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Container lists and log results easily exceed the 32 KiB default
+	c.SetReadLimit(maxMessageSize)
+
 	// Create a cancellable context for this connection
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -96,9 +257,12 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 	defer c.Close(websocket.StatusNormalClosure, "bye")
 
 	// ---- HELLO lesen ----
-	_, data, err := c.Read(ctx)
+	// Unauthenticated sockets must not stay open, the connection is closed if no hello arrives in time
+	helloCtx, helloCancel := context.WithTimeout(ctx, helloTimeout)
+	_, data, err := c.Read(helloCtx)
+	helloCancel()
 	if err != nil {
-		log.Println("ws read hello:", err)
+		log.Printf("ws read hello from %s: %v\n", r.RemoteAddr, err)
 		return
 	}
 
@@ -108,27 +272,104 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Token-Check
+	if certName != "" {
+		if hello.NodeName != "" && hello.NodeName != certName {
+			log.Printf("agent %s from %s sent node name %q, using certificate CN\n", certName, r.RemoteAddr, hello.NodeName)
+		}
+		hello.NodeName = certName
+	}
+
+	// Token-Check. Failed logins lock the node name too, but not for agents with a
+	// certificate: those cannot guess tokens, and others must not lock them out.
+	nodeKey := "node:" + hello.NodeName
+	if locked, retry := s.limiter.locked(nodeKey, time.Now()); locked && certName == "" {
+		log.Printf("agent login for %s from %s refused: locked out for %s\n", hello.NodeName, r.RemoteAddr, retry.Round(time.Second))
+		c.Close(websocket.StatusPolicyViolation, "too many failed attempts")
+		return
+	}
+
 	s.mu.RLock()
 	expectedToken, ok := s.allowed[hello.NodeName]
+	requireCert := s.requireCert
 	s.mu.RUnlock()
-	if !ok || expectedToken != hello.Token {
-		log.Printf("unauthorized agent: %s\n", hello.NodeName)
+
+	if certName == "" && requireCert {
+		log.Printf("agent %s from %s refused: client certificate required\n", hello.NodeName, r.RemoteAddr)
+		c.Close(websocket.StatusPolicyViolation, "client certificate required")
+		return
+	}
+
+	// A valid certificate replaces the token, the node still has to be configured
+	// Constant-time comparison, so response timing does not reveal how much of a token was right
+	tokenOK := certName != "" || subtle.ConstantTimeCompare([]byte(expectedToken), []byte(hello.Token)) == 1
+	if !ok || !tokenOK {
+		log.Printf("unauthorized agent: %s from %s\n", hello.NodeName, r.RemoteAddr)
+		now := time.Now()
+		if s.limiter.fail(ipKey, now) {
+			log.Printf("too many failed agent logins from %s, locked out for %s\n", s.clientIP(r), authLockout)
+		}
+		// Only configured names are tracked, random names would just fill the map
+		if ok && s.limiter.fail(nodeKey, now) {
+			log.Printf("too many failed logins for agent %s, locked out for %s\n", hello.NodeName, authLockout)
+		}
 		c.Close(websocket.StatusPolicyViolation, "unauthorized")
 		return
 	}
+	s.limiter.reset(ipKey)
+	s.limiter.reset(nodeKey)
+
+	// Protocol-Version aushandeln
+	version, ok := proto.NegotiateVersion(hello.MinVersion, hello.Version)
+	if !ok {
+		reason := fmt.Sprintf("incompatible protocol: agent speaks versions %d-%d, herbst supports %d-%d",
+			max(hello.MinVersion, 1), max(hello.Version, 1), proto.MinProtocolVersion, proto.ProtocolVersion)
+		log.Printf("rejected agent %s: %s\n", hello.NodeName, reason)
 
-	log.Printf("Agent connected: %s (kind=%s)\n", hello.NodeName, hello.Kind)
+		s.reg.SetRejected(hello.NodeName, hello.Kind, reason)
+		s.notifyChange()
+
+		writeJSON(ctx, c, proto.RejectMessage{
+			Type:       "reject",
+			Reason:     reason,
+			MinVersion: proto.MinProtocolVersion,
+			MaxVersion: proto.ProtocolVersion,
+		})
+		c.Close(websocket.StatusPolicyViolation, "incompatible protocol version")
+		return
+	}
+	caps := acceptCapabilities(version, hello.Capabilities)
+
+	log.Printf("Agent connected: %s (kind=%s, protocol=%d, capabilities=%v)\n", hello.NodeName, hello.Kind, version, caps)
 
 	// Mark agent as connected
 	s.reg.SetConnected(hello.NodeName, hello.Kind, true)
+	s.reg.SetHandshake(hello.NodeName, version, caps, hello.AgentVersion)
+	ac := s.addConn(hello.NodeName, c, caps, certSerial)
+	s.notifyChange()
 
-	// Mark agent as disconnected when the connection closes
+	// Mark agent as disconnected when the connection closes, also if the welcome fails
 	defer func() {
 		log.Printf("Agent disconnected: %s\n", hello.NodeName)
-		s.reg.SetConnected(hello.NodeName, hello.Kind, false)
+		if s.removeConn(hello.NodeName, ac) {
+			s.reg.SetConnected(hello.NodeName, hello.Kind, false)
+			s.notifyChange()
+		}
 	}()
 
+	// Agents from before versioning do not read, so only newer ones get a welcome
+	if version >= 2 {
+		err := writeJSON(ctx, c, proto.WelcomeMessage{
+			Type:          "welcome",
+			Version:       version,
+			Capabilities:  caps,
+			ServerVersion: s.version,
+		})
+		if err != nil {
+			log.Printf("failed to send welcome to %s: %v\n", hello.NodeName, err)
+			return
+		}
+	}
+
 	// Set up ping/pong keepalive to prevent proxy timeouts
 	// This sends pings every 5 seconds to keep the connection alive
 	go func() {
@@ -170,9 +411,290 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 				log.Println("invalid containers msg:", err)
 				continue
 			}
-			s.reg.UpdateContainers(hello.NodeName, hello.Kind, cm.Containers)
+			s.reg.UpdateContainers(hello.NodeName, hello.Kind, cm.Seq, cm.Containers)
+			s.notifyContainers()
+		case "containers_delta":
+			var dm proto.ContainersDeltaMessage
+			if err := json.Unmarshal(msg, &dm); err != nil {
+				log.Println("invalid containers_delta msg:", err)
+				continue
+			}
+			applied, resync := s.reg.ApplyDelta(hello.NodeName, hello.Kind, dm)
+			if resync {
+				log.Printf("sequence gap for %s at seq %d, requesting resync\n", hello.NodeName, dm.Seq)
+				if err := writeJSON(ctx, c, proto.ResyncMessage{Type: "resync"}); err != nil {
+					log.Printf("failed to request resync from %s: %v\n", hello.NodeName, err)
+				}
+			}
+			if !applied {
+				continue
+			}
+			s.notifyContainers()
+		case "result":
+			var rm proto.ResultMessage
+			if err := json.Unmarshal(msg, &rm); err != nil {
+				log.Println("invalid result msg:", err)
+				continue
+			}
+			ac.deliver(rm)
+		case "logs":
+			var lm proto.LogsMessage
+			if err := json.Unmarshal(msg, &lm); err != nil {
+				log.Println("invalid logs msg:", err)
+				continue
+			}
+			ac.deliverLogs(lm)
+		case "metrics":
+			var mm proto.MetricsMessage
+			if err := json.Unmarshal(msg, &mm); err != nil {
+				log.Println("invalid metrics msg:", err)
+				continue
+			}
+			s.reg.SetMetrics(hello.NodeName, hello.Kind, mm.Metrics)
 		default:
-			// später: metrics, logs, etc.
+			// später: weitere Nachrichtentypen
+		}
+	}
+}
+
+func (s *Server) addConn(nodeName string, c *websocket.Conn, caps []string, serial string) *agentConn {
+	ac := &agentConn{
+		ws:      c,
+		caps:    caps,
+		serial:  serial,
+		pending: make(map[string]chan proto.ResultMessage),
+		streams: make(map[string]chan []proto.LogLine),
+	}
+
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if old, ok := s.conns[nodeName]; ok {
+		// A reconnecting agent replaces its stale connection
+		old.ws.Close(websocket.StatusPolicyViolation, "replaced by new connection")
+	}
+	s.conns[nodeName] = ac
+	return ac
+}
+
+// removeConn forgets a closed connection. It returns false if the
+// agent already reconnected and ac is no longer the current connection.
+func (s *Server) removeConn(nodeName string, ac *agentConn) bool {
+	s.connsMu.Lock()
+	current := s.conns[nodeName] == ac
+	if current {
+		delete(s.conns, nodeName)
+	}
+	s.connsMu.Unlock()
+
+	ac.failPending()
+	return current
+}
+
+// SendCommand sends a command to a connected agent and waits for its result.
+// The correlation ID is filled in automatically.
+func (s *Server) SendCommand(ctx context.Context, nodeName string, cmd proto.CommandMessage) (*proto.ResultMessage, error) {
+	ac, err := s.conn(nodeName, proto.CapCommands)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Type = "command"
+	cmd.ID = newCorrelationID()
+
+	resCh, _, err := ac.register(cmd.ID, false)
+	if err != nil {
+		return nil, err
+	}
+	defer ac.unregister(cmd.ID)
+
+	if err := writeJSON(ctx, ac.ws, cmd); err != nil {
+		return nil, err
+	}
+
+	select {
+	case res, ok := <-resCh:
+		if !ok {
+			return nil, ErrNotConnected
+		}
+		return &res, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// StreamLogs runs a followed logs command on an agent and calls fn for every batch
+// of lines until ctx is cancelled, the stream ends or fn returns an error.
+// The agent is told to stop streaming when StreamLogs returns early.
+func (s *Server) StreamLogs(ctx context.Context, nodeName string, cmd proto.CommandMessage, fn func([]proto.LogLine) error) error {
+	ac, err := s.conn(nodeName, proto.CapLogsFollow)
+	if err != nil {
+		return err
+	}
+
+	cmd.Type = "command"
+	cmd.ID = newCorrelationID()
+	cmd.Action = "logs"
+	cmd.Follow = true
+
+	resCh, logsCh, err := ac.register(cmd.ID, true)
+	if err != nil {
+		return err
+	}
+	defer ac.unregister(cmd.ID)
+
+	if err := writeJSON(ctx, ac.ws, cmd); err != nil {
+		return err
+	}
+
+	cancelStream := func() {
+		cancelCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		writeJSON(cancelCtx, ac.ws, proto.CancelMessage{Type: "cancel", ID: cmd.ID})
+	}
+
+	for {
+		select {
+		case lines := <-logsCh:
+			if err := fn(lines); err != nil {
+				cancelStream()
+				return err
+			}
+		case res, ok := <-resCh:
+			if !ok {
+				return ErrNotConnected
+			}
+			// Flush lines that arrived right before the result
+		drain:
+			for {
+				select {
+				case lines := <-logsCh:
+					if err := fn(lines); err != nil {
+						return err
+					}
+				default:
+					break drain
+				}
+			}
+			if !res.OK {
+				return errors.New(res.Error)
+			}
+			return nil
+		case <-ctx.Done():
+			cancelStream()
+			return ctx.Err()
 		}
 	}
 }
+
+// conn returns the live connection of an agent that offers capability
+func (s *Server) conn(nodeName string, capability string) (*agentConn, error) {
+	s.connsMu.RLock()
+	defer s.connsMu.RUnlock()
+
+	ac, ok := s.conns[nodeName]
+	if !ok {
+		return nil, ErrNotConnected
+	}
+	if !slices.Contains(ac.caps, capability) {
+		return nil, ErrUnsupported
+	}
+	return ac, nil
+}
+
+// register prepares the channels for the answer to command id
+func (ac *agentConn) register(id string, stream bool) (chan proto.ResultMessage, chan []proto.LogLine, error) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if ac.pending == nil {
+		return nil, nil, ErrNotConnected
+	}
+
+	resCh := make(chan proto.ResultMessage, 1)
+	ac.pending[id] = resCh
+
+	var logsCh chan []proto.LogLine
+	if stream {
+		logsCh = make(chan []proto.LogLine, 64)
+		ac.streams[id] = logsCh
+	}
+	return resCh, logsCh, nil
+}
+
+func (ac *agentConn) unregister(id string) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if ac.pending != nil {
+		delete(ac.pending, id)
+		delete(ac.streams, id)
+	}
+}
+
+// deliver hands a result to the caller waiting for it
+func (ac *agentConn) deliver(res proto.ResultMessage) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	ch, ok := ac.pending[res.ID]
+	if !ok {
+		log.Printf("result for unknown command %s\n", res.ID)
+		return
+	}
+	delete(ac.pending, res.ID)
+	ch <- res
+}
+
+// deliverLogs hands a batch of log lines to a running stream.
+// Batches are dropped if the consumer falls behind, so a slow browser never blocks the agent connection.
+func (ac *agentConn) deliverLogs(msg proto.LogsMessage) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	ch, ok := ac.streams[msg.ID]
+	if !ok {
+		return
+	}
+	select {
+	case ch <- msg.Lines:
+	default:
+		log.Printf("log stream %s is lagging, dropped %d lines\n", msg.ID, len(msg.Lines))
+	}
+}
+
+// failPending wakes up all waiting callers once the connection is gone
+func (ac *agentConn) failPending() {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	for id, ch := range ac.pending {
+		close(ch)
+		delete(ac.pending, id)
+	}
+	ac.pending = nil
+	ac.streams = nil
+}
+
+func writeJSON(ctx context.Context, c *websocket.Conn, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Write(ctx, websocket.MessageText, data)
+}
+
+// clientIP returns the IP address of the agent. Behind a reverse proxy that
+// is the proxy's, so all agents share one lockout, unless it is listed in
+// [api] trusted-proxies and its X-Forwarded-For header is used.
+func (s *Server) clientIP(r *http.Request) string {
+	s.mu.RLock()
+	proxies := s.proxies
+	s.mu.RUnlock()
+	return util.ClientIP(r, proxies)
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,343 @@
+package alerts
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"herbst/internal/health"
+	"herbst/internal/history"
+	"herbst/internal/notify"
+	"herbst/internal/proto"
+	"herbst/internal/util"
+)
+
+// Snapshot is the state the rules are evaluated against
+type Snapshot struct {
+	Time       time.Time
+	Metrics    map[string]float64           // history key (node/metric) -> newest value
+	Agents     map[string]bool              // configured agent -> connected
+	Containers map[string][]proto.Container // node -> containers, only nodes whose list is current
+	Services   []health.Status
+}
+
+// sample is the value of a rule for one instance, e.g. one disk of one node
+type sample struct {
+	instance string
+	subject  string // for titles, e.g. "disk:/data on nas"
+	value    float64
+	labels   map[string]string
+}
+
+// state is a rule instance whose condition holds
+type state struct {
+	rule    string
+	node    string // node of the instance, empty for services
+	since   time.Time
+	firing  bool
+	pending notify.Alert // the alert that fires once the for-duration has passed
+}
+
+// Engine turns rule violations into alerts. A violation first is pending and
+// fires once it held for the rule's for-duration; it resolves when the value is
+// back within the threshold.
+type Engine struct {
+	alerts *notify.Manager
+
+	mu         sync.Mutex
+	rules      []Rule
+	states     map[string]*state         // alert key -> violated instance
+	containers map[string]*containerInfo // node/name -> restart tracking
+}
+
+// NewEngine returns an engine without rules that fires through alerts
+func NewEngine(alerts *notify.Manager) *Engine {
+	return &Engine{
+		alerts:     alerts,
+		states:     make(map[string]*state),
+		containers: make(map[string]*containerInfo),
+	}
+}
+
+// SetRules replaces the rules. Alerts of removed rules are dropped without a recovery message.
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	names := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		names[r.Name] = true
+	}
+	for key, st := range e.states {
+		if !names[st.rule] {
+			delete(e.states, key)
+			e.alerts.Forget(key)
+		}
+	}
+	e.rules = rules
+}
+
+// Pending returns the violations that wait for their for-duration, oldest first
+func (e *Engine) Pending() []notify.Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	list := []notify.Alert{}
+	for _, st := range e.states {
+		if !st.firing {
+			list = append(list, st.pending)
+		}
+	}
+	slices.SortFunc(list, func(a, b notify.Alert) int { return a.Since.Compare(b.Since) })
+	return list
+}
+
+// Evaluate checks every rule against snap
+func (e *Engine) Evaluate(snap Snapshot) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.trackContainers(snap)
+
+	seen := make(map[string]bool)
+	for _, r := range e.rules {
+		for _, s := range e.samples(r, snap) {
+			key := "rule:" + r.Name + ":" + s.instance
+			seen[key] = true
+			e.check(r, key, s, snap.Time)
+		}
+	}
+
+	// Instances that are gone (removed disks, containers, services) are not a recovery.
+	// Firing alerts of nodes without current data (stale metrics, disconnected
+	// agents) are kept until the node reports again; pending ones start over.
+	for key, st := range e.states {
+		if !seen[key] && (!st.firing || e.removed(st, snap)) {
+			delete(e.states, key)
+			if st.firing {
+				e.alerts.Forget(key)
+			}
+		}
+	}
+}
+
+// removed reports whether the instance of st is really gone and not just
+// missing from snap because its node did not report
+func (e *Engine) removed(st *state, snap Snapshot) bool {
+	if st.node != "" && st.node != history.LocalNode {
+		if _, ok := snap.Agents[st.node]; !ok {
+			return true // agent removed from the config
+		}
+	}
+
+	var metric string
+	for _, r := range e.rules {
+		if r.Name == st.rule {
+			metric = r.Metric
+			break
+		}
+	}
+	switch {
+	case metric == "agent-connected", strings.HasPrefix(metric, "service-"):
+		// Agents and services are always complete
+		return true
+	case strings.HasPrefix(metric, "container-"):
+		_, ok := snap.Containers[st.node]
+		return ok
+	}
+	// Host metrics: gone if the node reports others, e.g. an unmounted disk
+	for key := range snap.Metrics {
+		if strings.HasPrefix(key, st.node+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// check updates the state of one rule instance
+func (e *Engine) check(r Rule, key string, s sample, now time.Time) {
+	st := e.states[key]
+	if !r.breached(s.value) {
+		if st != nil {
+			delete(e.states, key)
+			if st.firing {
+				e.alerts.Resolve(key, fmt.Sprintf("%s: %s is back to normal", r.Name, s.subject),
+					fmt.Sprintf("Value %s", formatValue(s.value)))
+			}
+		}
+		return
+	}
+
+	if st == nil {
+		st = &state{rule: r.Name, node: s.labels["node"], since: now}
+		e.states[key] = st
+	}
+	labels := map[string]string{"rule": r.Name, "metric": r.Metric}
+	for k, v := range s.labels {
+		labels[k] = v
+	}
+	message := fmt.Sprintf("Value %s is %s", formatValue(s.value), r.threshold())
+	if r.For > 0 {
+		message += fmt.Sprintf(" for %s", r.For)
+	}
+	st.pending = notify.Alert{
+		Key:      key,
+		Kind:     r.Kind,
+		Severity: r.Severity,
+		Status:   notify.StatusPending,
+		Title:    fmt.Sprintf("%s: %s", r.Name, s.subject),
+		Message:  message,
+		Labels:   labels,
+		Since:    st.since,
+		Time:     now,
+	}
+	if !st.firing && now.Sub(st.since) >= r.For {
+		st.firing = true
+		e.alerts.Fire(st.pending)
+	}
+}
+
+// samples returns the current value of r for every instance it applies to
+func (e *Engine) samples(r Rule, snap Snapshot) []sample {
+	var list []sample
+	switch r.Metric {
+	case "agent-connected":
+		for name, connected := range snap.Agents {
+			if util.MatchGlob(r.Node, name) {
+				list = append(list, sample{name, "agent " + name, boolValue(connected), map[string]string{"node": name}})
+			}
+		}
+
+	case "container-running", "container-restarts", "container-cpu", "container-memory":
+		for node, containers := range snap.Containers {
+			if !util.MatchGlob(r.Node, node) {
+				continue
+			}
+			for _, c := range containers {
+				if !util.MatchGlob(r.Container, c.Name) {
+					continue
+				}
+				var v float64
+				switch r.Metric {
+				case "container-running":
+					v = boolValue(c.State == "running")
+				case "container-restarts":
+					ci := e.containers[node+"/"+c.Name]
+					if ci == nil {
+						continue
+					}
+					v = float64(ci.count(snap.Time.Add(-r.Window), snap.Time.Add(-e.maxWindow())))
+				case "container-cpu", "container-memory":
+					if c.Stats == nil {
+						continue
+					}
+					v = c.Stats.CPUPercent
+					if r.Metric == "container-memory" {
+						v = c.Stats.MemoryPercent
+					}
+				}
+				list = append(list, sample{
+					instance: node + "/" + c.Name,
+					subject:  fmt.Sprintf("container %s on %s", c.Name, node),
+					value:    v,
+					labels:   map[string]string{"node": node, "container": c.Name, "image": c.Image},
+				})
+			}
+		}
+
+	case "service-up", "service-latency", "service-tls-days":
+		for _, st := range snap.Services {
+			if !util.MatchGlob(r.Service, st.ID) || st.State == health.StatePending {
+				continue
+			}
+			var v float64
+			switch r.Metric {
+			case "service-up":
+				v = boolValue(st.State == health.StateUp)
+			case "service-latency":
+				// The latency of a failed check is the time until it gave up
+				if st.State != health.StateUp {
+					continue
+				}
+				v = st.LatencyMs
+			case "service-tls-days":
+				if st.TLS == nil {
+					continue
+				}
+				v = float64(st.TLS.DaysLeft)
+			}
+			list = append(list, sample{
+				instance: st.ID,
+				subject:  "service " + st.Name,
+				value:    v,
+				labels:   map[string]string{"service": st.ID, "name": st.Name, "section": st.Section, "url": st.URL},
+			})
+		}
+
+	default:
+		for key, v := range snap.Metrics {
+			node, metric, ok := strings.Cut(key, "/")
+			if !ok || !util.MatchGlob(r.Node, node) || !util.MatchGlob(r.Metric, metric) {
+				continue
+			}
+			list = append(list, sample{
+				instance: key,
+				subject:  fmt.Sprintf("%s on %s", metric, node),
+				value:    v,
+				labels:   map[string]string{"node": node, "metric": metric},
+			})
+		}
+	}
+	return list
+}
+
+// trackContainers counts container restarts. Containers seen for the first
+// time or recreated with a new ID start without restarts.
+func (e *Engine) trackContainers(snap Snapshot) {
+	for node, containers := range snap.Containers {
+		current := make(map[string]bool, len(containers))
+		for _, c := range containers {
+			key := node + "/" + c.Name
+			current[key] = true
+			ci := e.containers[key]
+			if ci == nil || ci.id != c.ID {
+				ci = &containerInfo{id: c.ID}
+				e.containers[key] = ci
+				ci.running = c.State == "running"
+				ci.uptime, _ = parseUptime(c.Status)
+				continue
+			}
+			ci.observe(c, snap.Time)
+		}
+		for key := range e.containers {
+			if strings.HasPrefix(key, node+"/") && !current[key] {
+				delete(e.containers, key)
+			}
+		}
+	}
+}
+
+// maxWindow is the longest container-restarts window, older restarts are dropped
+func (e *Engine) maxWindow() time.Duration {
+	longest := DefaultWindow
+	for _, r := range e.rules {
+		longest = max(longest, r.Window)
+	}
+	return longest
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// formatValue prints v with at most two decimals
+func formatValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,95 @@
+package alerts
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"herbst/internal/proto"
+)
+
+// upRe finds the uptime in a container status like "Up 5 minutes (healthy)"
+var upRe = regexp.MustCompile(`^Up (Less than a second|About an? \w+|\d+ \w+)`)
+
+// containerInfo is what the engine remembers about a container to count its restarts
+type containerInfo struct {
+	id       string
+	running  bool
+	uptime   time.Duration
+	restarts []time.Time
+}
+
+// observe updates the info with the current state of the container and
+// records a restart if it became running again, or is still running but has
+// been up for a shorter time than at the last observation
+func (ci *containerInfo) observe(c proto.Container, now time.Time) {
+	running := c.State == "running"
+	uptime, _ := parseUptime(c.Status)
+	if running && (!ci.running || uptime < ci.uptime) {
+		ci.restarts = append(ci.restarts, now)
+	}
+	ci.running = running
+	ci.uptime = uptime
+}
+
+// count returns the restarts since from and drops older ones than keep
+func (ci *containerInfo) count(from, keep time.Time) int {
+	drop := 0
+	for drop < len(ci.restarts) && ci.restarts[drop].Before(keep) {
+		drop++
+	}
+	ci.restarts = ci.restarts[drop:]
+
+	n := 0
+	for _, t := range ci.restarts {
+		if !t.Before(from) {
+			n++
+		}
+	}
+	return n
+}
+
+// parseUptime reads the humanized uptime Docker puts in the status of running
+// containers. The result only grows while the container keeps running.
+func parseUptime(status string) (time.Duration, bool) {
+	m := upRe.FindStringSubmatch(status)
+	if m == nil {
+		return 0, false
+	}
+	switch s := m[1]; {
+	case s == "Less than a second":
+		return 0, true
+	case strings.HasPrefix(s, "About"):
+		unit, ok := uptimeUnit(s[strings.LastIndexByte(s, ' ')+1:])
+		return unit, ok
+	default:
+		num, word, _ := strings.Cut(s, " ")
+		n, err := strconv.Atoi(num)
+		unit, ok := uptimeUnit(word)
+		if err != nil || !ok {
+			return 0, false
+		}
+		return time.Duration(n) * unit, true
+	}
+}
+
+func uptimeUnit(word string) (time.Duration, bool) {
+	switch strings.TrimSuffix(word, "s") {
+	case "second":
+		return time.Second, true
+	case "minute":
+		return time.Minute, true
+	case "hour":
+		return time.Hour, true
+	case "day":
+		return 24 * time.Hour, true
+	case "week":
+		return 7 * 24 * time.Hour, true
+	case "month":
+		return 30 * 24 * time.Hour, true
+	case "year":
+		return 365 * 24 * time.Hour, true
+	}
+	return 0, false
+}
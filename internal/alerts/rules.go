@@ -0,0 +1,171 @@
+// Package alerts evaluates the [[alert]] rules against host metrics, agents,
+// containers and services and fires alerts through the notify manager
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"herbst/internal/config"
+	"herbst/internal/notify"
+	"herbst/internal/util"
+)
+
+// DefaultWindow is the time range of container-restarts
+const DefaultWindow = time.Hour
+
+// stateMetrics are the metrics that are not host metrics, by the kind of alert they raise
+var stateMetrics = map[string]string{
+	"agent-connected":    notify.KindAgent,
+	"container-running":  notify.KindContainer,
+	"container-restarts": notify.KindContainer,
+	"container-cpu":      notify.KindContainer,
+	"container-memory":   notify.KindContainer,
+	"service-up":         notify.KindService,
+	"service-latency":    notify.KindService,
+	"service-tls-days":   notify.KindService,
+}
+
+// hostMetrics are the host metrics as stored in the history, "disk" stands for disk:<path>
+var hostMetrics = []string{"cpu", "memory", "swap", "load1", "disk", "net", "temp"}
+
+// Rule is a validated [[alert]]
+type Rule struct {
+	Name      string
+	Metric    string // glob for host metrics
+	Kind      string // host, agent, container or service
+	Node      string // glob, empty = all
+	Container string // glob, empty = all
+	Service   string // glob, empty = all
+	Above     *float64
+	Below     *float64
+	For       time.Duration
+	Window    time.Duration
+	Severity  string
+}
+
+// NewRules validates the configured rules. Invalid entries are skipped and
+// reported in the returned error, the valid ones are returned either way.
+func NewRules(list []config.AlertRule) ([]Rule, error) {
+	var rules []Rule
+	var errs []error
+	used := make(map[string]bool)
+	for i, cfg := range list {
+		r, err := newRule(cfg)
+		if err == nil && used[r.Name] {
+			err = errors.New("duplicate name")
+		}
+		if err != nil {
+			name := fmt.Sprintf("#%d", i+1)
+			if cfg.Name != "" {
+				name += " " + cfg.Name
+			}
+			errs = append(errs, fmt.Errorf("[[alert]] %s: %w", name, err))
+			continue
+		}
+		used[r.Name] = true
+		rules = append(rules, r)
+	}
+	return rules, errors.Join(errs...)
+}
+
+// CheckRule reports what is wrong with an [[alert]] entry, nil if nothing.
+// Duplicate names are not detected, they need the whole list.
+func CheckRule(cfg config.AlertRule) error {
+	_, err := newRule(cfg)
+	return err
+}
+
+func newRule(cfg config.AlertRule) (Rule, error) {
+	r := Rule{
+		Name:      strings.TrimSpace(cfg.Name),
+		Metric:    strings.TrimSpace(cfg.Metric),
+		Node:      cfg.Node,
+		Container: cfg.Container,
+		Service:   cfg.Service,
+		Above:     cfg.Above,
+		Below:     cfg.Below,
+		Window:    DefaultWindow,
+		Severity:  strings.ToLower(cfg.Severity),
+	}
+	if r.Name == "" {
+		return r, errors.New("missing name")
+	}
+	// The name is part of the alert key
+	if strings.ContainsAny(r.Name, ": ") {
+		return r, fmt.Errorf("invalid name %q (no spaces or colons)", r.Name)
+	}
+
+	if r.Metric == "" {
+		return r, errors.New("missing metric")
+	}
+	if kind, ok := stateMetrics[r.Metric]; ok {
+		r.Kind = kind
+	} else if isHostMetric(r.Metric) {
+		r.Kind = notify.KindHost
+	} else {
+		return r, fmt.Errorf("unknown metric %q", r.Metric)
+	}
+	if r.Container != "" && r.Kind != notify.KindContainer {
+		return r, fmt.Errorf("container is only used with container-* metrics")
+	}
+	if r.Service != "" && r.Kind != notify.KindService {
+		return r, fmt.Errorf("service is only used with service-* metrics")
+	}
+
+	if r.Above == nil && r.Below == nil {
+		return r, errors.New("missing above or below")
+	}
+
+	if cfg.For != "" {
+		d, err := util.ParseDuration(cfg.For)
+		if err != nil || d < 0 {
+			return r, fmt.Errorf("invalid for %q", cfg.For)
+		}
+		r.For = d
+	}
+	if cfg.Window != "" {
+		d, err := util.ParseDuration(cfg.Window)
+		if err != nil || d <= 0 {
+			return r, fmt.Errorf("invalid window %q", cfg.Window)
+		}
+		r.Window = d
+	}
+
+	if r.Severity == "" {
+		r.Severity = notify.SeverityWarning
+	} else if !notify.ValidSeverity(r.Severity) {
+		return r, fmt.Errorf("invalid severity %q (use info, warning or critical)", cfg.Severity)
+	}
+	return r, nil
+}
+
+// isHostMetric reports whether pattern can match a host metric, e.g. "cpu" or "disk:*"
+func isHostMetric(pattern string) bool {
+	base, _, _ := strings.Cut(pattern, ":")
+	for _, m := range hostMetrics {
+		if util.MatchGlob(base, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// breached reports whether v violates the rule
+func (r Rule) breached(v float64) bool {
+	return (r.Above != nil && v > *r.Above) || (r.Below != nil && v < *r.Below)
+}
+
+// threshold describes the condition for messages, e.g. "above 90"
+func (r Rule) threshold() string {
+	var parts []string
+	if r.Above != nil {
+		parts = append(parts, "above "+formatValue(*r.Above))
+	}
+	if r.Below != nil {
+		parts = append(parts, "below "+formatValue(*r.Below))
+	}
+	return strings.Join(parts, " or ")
+}
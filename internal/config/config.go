@@ -1,9 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"herbst/internal/util"
 
@@ -30,12 +32,12 @@ type Weather struct {
 	Location string  `toml:"location" json:"location"` // City name, "zip:CODE,COUNTRY", or empty for lat/lon
 	Lat      float64 `toml:"lat"      json:"lat"`
 	Lon      float64 `toml:"lon"      json:"lon"`
-	Units    string  `toml:"units"    json:"units"`
+	Units    string  `toml:"units"    json:"units"` // metric (°C), imperial (°F) or standard (K)
 }
 
 // DockerLocal holds local Docker integration configuration
 type DockerLocal struct {
-	Enabled    *bool  `toml:"enabled"     json:"enabled"` // Pointer to detect if explicitly set
+	Enabled    *bool  `toml:"enabled"     json:"enabled"` // Default: on if the socket exists
 	SocketPath string `toml:"socket-path" json:"socketPath"`
 }
 
@@ -60,18 +62,29 @@ type DockerAgentConfig struct {
 	Token string `toml:"token" json:"token"`
 }
 
+// DockerMTLS configures the mutual TLS listener for remote agents
+type DockerMTLS struct {
+	Enabled     bool     `toml:"enabled"      json:"enabled"`
+	Listen      string   `toml:"listen"       json:"listen"`      // Address of the TLS listener (default: ":8443")
+	ServerNames []string `toml:"server-names" json:"serverNames"` // DNS names / IPs agents use to reach herbst
+	Require     bool     `toml:"require"      json:"require"`     // Refuse token-only agents on the plain listener
+}
+
 // Docker holds all Docker integration configuration
 type Docker struct {
 	Local         DockerLocal         `toml:"local"          json:"local"`         // [docker.local]
 	Host          string              `toml:"host"           json:"host"`          // External host URL for agents (e.g. "192.168.1.100:8080")
 	AgentProtocol string              `toml:"agent-protocol" json:"agentProtocol"` // ws or wss (default: ws)
 	Agents        []DockerAgentConfig `toml:"agent"          json:"agents"`        // [[docker.agent]]
+	MTLS          DockerMTLS          `toml:"mtls"           json:"mtls"`          // [docker.mtls]
 }
 
 // System holds system monitoring configuration
 type System struct {
-	Enabled  bool   `toml:"enabled"   json:"enabled"`
-	DiskPath string `toml:"disk-path" json:"diskPath"` // Which disk/partition to monitor (default: "/" or "C:")
+	Enabled    bool     `toml:"enabled"    json:"enabled"`
+	DiskPath   string   `toml:"disk-path"  json:"diskPath"`   // Which disk/partition to monitor (default: "/" or "C:")
+	Disks      []string `toml:"disks"      json:"disks"`      // Several mount points, or ["all"] for all real filesystems (overrides disk-path)
+	Interfaces []string `toml:"interfaces" json:"interfaces"` // Network interfaces to show (default: all except loopback/virtual)
 }
 
 // IsEnabled returns true if system monitoring is enabled (default: true)
@@ -79,6 +92,86 @@ func (s *System) IsEnabled() bool {
 	return s.Enabled
 }
 
+// DiskPaths returns the mount points to monitor
+func (s *System) DiskPaths() []string {
+	if len(s.Disks) > 0 {
+		return s.Disks
+	}
+	if s.DiskPath != "" {
+		return []string{s.DiskPath}
+	}
+	return []string{"/"}
+}
+
+// API holds settings for the HTTP API
+type API struct {
+	Token          string   `toml:"token"           json:"token"`          // Bearer token for write endpoints (container actions); empty disables them
+	TrustedProxies []string `toml:"trusted-proxies" json:"trustedProxies"` // Reverse proxies (addresses or CIDRs) whose X-Forwarded-For and Remote-User headers are used
+}
+
+// Storage holds settings for the on-disk history (metrics, health checks)
+type Storage struct {
+	Enabled         bool   `toml:"enabled"          json:"enabled"`
+	Path            string `toml:"path"             json:"path"`            // Relative to the config directory (default: "history.log")
+	Retention       string `toml:"retention"        json:"retention"`       // How long samples are kept, e.g. "30d" (default), "0" = forever
+	DownsampleAfter string `toml:"downsample-after" json:"downsampleAfter"` // Older samples are merged into hourly ones (default: "7d", "0" = never)
+	CompactInterval string `toml:"compact-interval" json:"compactInterval"` // How often expired samples are removed (default: "1h")
+}
+
+// Health holds settings for the background service checks
+type Health struct {
+	Interval         string   `toml:"interval"           json:"interval"`         // How often each service with online-badge is checked (default: "30s")
+	Timeout          string   `toml:"timeout"            json:"timeout"`          // Timeout of a single check (default: "5s")
+	TLSExpiryWarning string   `toml:"tls-expiry-warning" json:"tlsExpiryWarning"` // Flag certificates expiring within this (default: "14d")
+	TLSCA            string   `toml:"tls-ca"             json:"tlsCa"`            // PEM file with extra CAs for certificate checks, relative to the config directory
+	MaxConcurrent    int      `toml:"max-concurrent"     json:"maxConcurrent"`    // Checks running at the same time (default: 10)
+	MaxRedirects     *int     `toml:"max-redirects"      json:"maxRedirects"`     // Redirects followed by HTTP checks (default: 5, 0 = none)
+	Schemes          []string `toml:"schemes"            json:"schemes"`          // URL schemes HTTP checks may use (default: ["http", "https"])
+	AllowCIDRs       []string `toml:"allow-cidrs"        json:"allowCidrs"`       // Networks checks may connect to (default: any)
+	DenyCIDRs        []string `toml:"deny-cidrs"         json:"denyCidrs"`        // Networks checks must not connect to, wins over allow-cidrs
+}
+
+// Notify is a channel that alerts are sent to ([[notify]])
+type Notify struct {
+	Name        string   `toml:"name"         json:"name"`        // Shown in logs (default: the type)
+	Type        string   `toml:"type"         json:"type"`        // webhook, ntfy, gotify or email
+	Events      []string `toml:"events"       json:"events"`      // agent, container, service and/or host (default: all)
+	MinSeverity string   `toml:"min-severity" json:"minSeverity"` // info, warning or critical (default: info = everything)
+	Cooldown    string   `toml:"cooldown"     json:"cooldown"`    // Minimum time between two alerts for the same thing (default: "10m")
+	Recovery    *bool    `toml:"recovery"     json:"recovery"`    // Send a message when the condition clears (default: true)
+
+	// webhook, ntfy, gotify
+	URL      string            `toml:"url"      json:"url"`      // Webhook URL, ntfy topic URL or Gotify server URL
+	Method   string            `toml:"method"   json:"method"`   // Webhook HTTP method (default: POST)
+	Headers  map[string]string `toml:"headers"  json:"headers"`  // Extra HTTP request headers
+	Body     string            `toml:"body"     json:"body"`     // Webhook body as Go template (default: the alert as JSON)
+	Token    string            `toml:"token"    json:"token"`    // ntfy access token or Gotify app token
+	Priority int               `toml:"priority" json:"priority"` // ntfy (1-5) or Gotify (0-10) priority of alerts
+
+	// email
+	SMTPHost string   `toml:"smtp-host" json:"smtpHost"`
+	SMTPPort int      `toml:"smtp-port" json:"smtpPort"` // Default: 587 (465 with tls = "tls")
+	TLS      string   `toml:"tls"       json:"tls"`      // starttls (default), tls or none
+	Username string   `toml:"username"  json:"username"`
+	Password string   `toml:"password"  json:"password"`
+	From     string   `toml:"from"      json:"from"`
+	To       []string `toml:"to"        json:"to"`
+}
+
+// AlertRule is a threshold on a metric or state ([[alert]])
+type AlertRule struct {
+	Name      string   `toml:"name"      json:"name"`
+	Metric    string   `toml:"metric"    json:"metric"`    // Host metric (cpu, memory, swap, load1, disk:<path>, net:<iface>:rx|tx, temp:<sensor>, * wildcards) or agent-connected, container-running, container-restarts, container-cpu, container-memory, service-up, service-latency, service-tls-days
+	Node      string   `toml:"node"      json:"node"`      // Node name ("local" or an agent), * wildcards (default: all)
+	Container string   `toml:"container" json:"container"` // Container name, * wildcards (default: all)
+	Service   string   `toml:"service"   json:"service"`   // Service id, * wildcards (default: all)
+	Above     *float64 `toml:"above"     json:"above"`     // Fires while the value is above this
+	Below     *float64 `toml:"below"     json:"below"`     // Fires while the value is below this
+	For       string   `toml:"for"       json:"for"`       // How long the condition must hold before the alert fires (default: right away)
+	Window    string   `toml:"window"    json:"window"`    // Time range of container-restarts (default: "1h")
+	Severity  string   `toml:"severity"  json:"severity"`  // info, warning (default) or critical
+}
+
 // UI holds UI-related configuration
 type UI struct {
 	Background Background `toml:"background" json:"background"`
@@ -94,10 +187,27 @@ type Clock struct {
 
 // Service represents a dashboard service entry
 type Service struct {
+	ID          string `toml:"id"           json:"id"` // Stable identifier, derived from section and name if empty
 	Name        string `toml:"name"         json:"name"`
 	URL         string `toml:"url"          json:"url"`
 	Icon        string `toml:"icon"         json:"icon"`
 	OnlineBadge bool   `toml:"online-badge" json:"onlineBadge"`
+
+	Check *ServiceCheck `toml:"check" json:"-"` // Not sent to the browser, headers may contain secrets
+}
+
+// ServiceCheck configures how a service with online-badge is checked ([section.service.check])
+type ServiceCheck struct {
+	Type         string            `toml:"type"          json:"type"`         // http (default), tcp, dns or icmp
+	Target       string            `toml:"target"        json:"target"`       // URL (http), host:port (tcp) or host name (dns, icmp), default: taken from the service url
+	Timeout      string            `toml:"timeout"       json:"timeout"`      // Overrides [health] timeout
+	Method       string            `toml:"method"        json:"method"`       // HTTP method (default: HEAD with GET fallback, GET when the body is checked)
+	Headers      map[string]string `toml:"headers"       json:"headers"`      // Extra HTTP request headers
+	Status       []string          `toml:"status"        json:"status"`       // Expected HTTP status codes, e.g. ["200-299", "401"] (default: anything below 500)
+	BodyContains string            `toml:"body-contains" json:"bodyContains"` // Text the response body must contain
+	BodyRegex    string            `toml:"body-regex"    json:"bodyRegex"`    // Regular expression the response body must match
+	Server       string            `toml:"server"        json:"server"`       // DNS server to ask (default: system resolver)
+	Expect       []string          `toml:"expect"        json:"expect"`       // Addresses the DNS name must resolve to
 }
 
 // ServiceSection represents a group of services with a title
@@ -109,15 +219,35 @@ type ServiceSection struct {
 // Config is the main configuration structure
 type Config struct {
 	Title    string           `toml:"title"    json:"title"`
-	Theme    string           `toml:"theme"    json:"theme"`
+	Theme    string           `toml:"theme"    json:"theme"` // Key or name of a theme in themes.toml
 	UI       UI               `toml:"ui"       json:"ui"`
 	Weather  Weather          `toml:"weather"  json:"weather"`
 	Docker   Docker           `toml:"docker"   json:"docker"`
 	System   System           `toml:"system"   json:"system"`
+	API      API              `toml:"api"      json:"api"`
+	Storage  Storage          `toml:"storage"  json:"storage"`
+	Health   Health           `toml:"health"   json:"health"`
+	Notify   []Notify         `toml:"notify"   json:"-"`       // [[notify]], not sent to the browser (tokens, passwords)
+	Alerts   []AlertRule      `toml:"alert"    json:"alerts"`  // [[alert]]
 	Services []Service        `toml:"service" json:"services"` // Flat services (legacy)
 	Sections []ServiceSection `toml:"section" json:"sections"` // Grouped services
 }
 
+// Choices are the allowed values of settings with a fixed set, by type and key.
+// Validate and the JSON Schema use them.
+var Choices = map[string][]string{
+	"Clock.time-format":     {"24h", "12h"},
+	"Clock.date-format":     {"short", "numeric"},
+	"Weather.units":         {"standard", "metric", "imperial"},
+	"Docker.agent-protocol": {"ws", "wss"},
+	"ServiceCheck.type":     {"http", "tcp", "dns", "icmp"},
+	"Notify.type":           {"webhook", "ntfy", "gotify", "email"},
+	"Notify.events":         {"agent", "container", "service", "host"},
+	"Notify.min-severity":   {"info", "warning", "critical"},
+	"Notify.tls":            {"starttls", "tls", "none"},
+	"AlertRule.severity":    {"info", "warning", "critical"},
+}
+
 // EnsureAndLoadConfig loads the config file, creating it with defaults if it doesn't exist.
 // Returns the config, the absolute path to the config file, and any error.
 func EnsureAndLoadConfig() (*Config, string, error) {
@@ -152,6 +282,7 @@ func EnsureAndLoadConfig() (*Config, string, error) {
 
 	// Expand environment variables in config values
 	expandEnvVars(&cfg)
+	assignServiceIDs(&cfg)
 
 	absPath, _ := filepath.Abs(configPath)
 	return &cfg, absPath, nil
@@ -179,8 +310,10 @@ func expandEnvVars(cfg *Config) {
 
 	// Expand in Docker config
 	cfg.Docker.Local.SocketPath = expand(cfg.Docker.Local.SocketPath)
-	cfg.Docker.Host = expand(cfg.Docker.Host)
-	cfg.Docker.AgentProtocol = expand(cfg.Docker.AgentProtocol)
+	cfg.Docker.MTLS.Listen = expand(cfg.Docker.MTLS.Listen)
+	for i := range cfg.Docker.MTLS.ServerNames {
+		cfg.Docker.MTLS.ServerNames[i] = expand(cfg.Docker.MTLS.ServerNames[i])
+	}
 
 	// Expand in Docker agent configs
 	for i := range cfg.Docker.Agents {
@@ -188,15 +321,67 @@ func expandEnvVars(cfg *Config) {
 		cfg.Docker.Agents[i].Token = expand(cfg.Docker.Agents[i].Token)
 	}
 
+	// Secrets must not fall back to the literal ${VAR} text when the env var is missing
+	expandSecret := func(s string) string {
+		s = expand(s)
+		if envVarRegex.MatchString(s) {
+			return ""
+		}
+		return s
+	}
+
+	// Expand in API config
+	cfg.API.Token = expandSecret(cfg.API.Token)
+
+	// The default config takes these from the environment, unset means the default
+	cfg.Docker.Host = expandSecret(cfg.Docker.Host)
+	cfg.Docker.AgentProtocol = expandSecret(cfg.Docker.AgentProtocol)
+
+	// Expand in Storage config
+	cfg.Storage.Path = expand(cfg.Storage.Path)
+
+	// Expand in Health config
+	cfg.Health.TLSCA = expand(cfg.Health.TLSCA)
+
+	// Expand in notify channels
+	for i := range cfg.Notify {
+		n := &cfg.Notify[i]
+		n.URL = expandSecret(n.URL) // ntfy topics and webhook URLs often are the secret
+		n.Token = expandSecret(n.Token)
+		n.Password = expandSecret(n.Password)
+		n.Username = expand(n.Username)
+		n.SMTPHost = expand(n.SMTPHost)
+		n.From = expand(n.From)
+		for j := range n.To {
+			n.To[j] = expand(n.To[j])
+		}
+		for k, v := range n.Headers {
+			n.Headers[k] = expandSecret(v)
+		}
+	}
+
 	// Expand in UI config
 	cfg.UI.Background.Image = expand(cfg.UI.Background.Image)
 	cfg.UI.Font = expand(cfg.UI.Font)
 
+	// Headers often carry tokens, so they are treated like secrets
+	expandCheck := func(c *ServiceCheck) {
+		if c == nil {
+			return
+		}
+		c.Target = expand(c.Target)
+		c.Server = expand(c.Server)
+		for k, v := range c.Headers {
+			c.Headers[k] = expandSecret(v)
+		}
+	}
+
 	// Expand in Services
 	for i := range cfg.Services {
 		cfg.Services[i].Name = expand(cfg.Services[i].Name)
 		cfg.Services[i].URL = expand(cfg.Services[i].URL)
 		cfg.Services[i].Icon = expand(cfg.Services[i].Icon)
+		expandCheck(cfg.Services[i].Check)
 	}
 
 	// Expand in Sections
@@ -206,6 +391,7 @@ func expandEnvVars(cfg *Config) {
 			cfg.Sections[i].Services[j].Name = expand(cfg.Sections[i].Services[j].Name)
 			cfg.Sections[i].Services[j].URL = expand(cfg.Sections[i].Services[j].URL)
 			cfg.Sections[i].Services[j].Icon = expand(cfg.Sections[i].Services[j].Icon)
+			expandCheck(cfg.Sections[i].Services[j].Check)
 		}
 	}
 
@@ -213,3 +399,61 @@ func expandEnvVars(cfg *Config) {
 	cfg.Title = expand(cfg.Title)
 	cfg.Theme = expand(cfg.Theme)
 }
+
+// assignServiceIDs gives every service without an explicit id one derived from
+// its section title and name, e.g. "media-jellyfin". Duplicates get a numeric suffix.
+func assignServiceIDs(cfg *Config) {
+	seen := make(map[string]bool)
+	assign := func(svc *Service, section string) {
+		id := svc.ID
+		if id == "" {
+			id = slug(svc.Name)
+			if id == "" {
+				id = "service"
+			}
+			if s := slug(section); s != "" {
+				id = s + "-" + id
+			}
+		}
+		base := id
+		for n := 2; seen[id]; n++ {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+		seen[id] = true
+		svc.ID = id
+	}
+
+	// Explicit ids are claimed first, so derived ones never take them
+	for _, explicit := range []bool{true, false} {
+		for i := range cfg.Services {
+			if (cfg.Services[i].ID != "") == explicit {
+				assign(&cfg.Services[i], "")
+			}
+		}
+		for i := range cfg.Sections {
+			for j := range cfg.Sections[i].Services {
+				if (cfg.Sections[i].Services[j].ID != "") == explicit {
+					assign(&cfg.Sections[i].Services[j], cfg.Sections[i].Title)
+				}
+			}
+		}
+	}
+}
+
+// slug lowercases s and replaces everything except letters and digits with dashes
+func slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
@@ -59,6 +59,7 @@ socket-path = "/var/run/docker.sock"
 #   HERBST_HOST=192.168.1.100:8080
 #   HERBST_AGENT_PROTOCOL=wss  (optional, default: ws)
 
+[docker]
 host = "${HERBST_HOST}"
 agent-protocol = "${HERBST_AGENT_PROTOCOL}"
 
@@ -69,6 +70,14 @@ agent-protocol = "${HERBST_AGENT_PROTOCOL}"
 # [[docker.agent]]
 # name = "raspberry-pi"
 
+# Mutual TLS: herbst runs a small CA and a separate TLS listener for agents.
+# Issue agent certificates with "herbst cert issue <name>" or the API.
+# [docker.mtls]
+# enabled = true
+# listen = ":8443"
+# server-names = ["192.168.1.100", "herbst.lan"]  # Names agents connect to
+# require = false  # true = token-only agents are refused
+
 
 # ┌───────────────────────────────────────────────────────────────────────────┐
 # │  SYSTEM MONITORING                                                        │
@@ -78,6 +87,67 @@ agent-protocol = "${HERBST_AGENT_PROTOCOL}"
 [system]
 enabled = true
 disk-path = "/"  # Path to monitor disk usage (e.g., "/" or "/mnt/data")
+# disks = ["/", "/mnt/data"]  # Several disks instead of disk-path, or ["all"] for every real filesystem
+# interfaces = ["eth0"]       # Network interfaces (default: all except loopback, veth, docker, bridges)
+
+
+# ┌───────────────────────────────────────────────────────────────────────────┐
+# │  API                                                                      │
+# │  Token for write endpoints like starting/stopping containers              │
+# └───────────────────────────────────────────────────────────────────────────┘
+
+[api]
+token = "${HERBST_API_TOKEN}"  # Send as "Authorization: Bearer <token>", empty disables actions
+# trusted-proxies = ["127.0.0.1"]  # Reverse proxies whose X-Forwarded-For and Remote-User headers are used
+
+
+# ┌───────────────────────────────────────────────────────────────────────────┐
+# │  STORAGE                                                                  │
+# │  Keep metrics history on disk so it survives restarts                     │
+# └───────────────────────────────────────────────────────────────────────────┘
+
+[storage]
+enabled = false
+# path = "history.log"       # Relative to this config directory
+# retention = "30d"          # Drop samples older than this
+# downsample-after = "7d"    # Keep older samples at 1 hour resolution
+# compact-interval = "1h"
+
+
+# ┌───────────────────────────────────────────────────────────────────────────┐
+# │  HEALTH CHECKS                                                            │
+# │  Services with online-badge = true are checked in the background          │
+# └───────────────────────────────────────────────────────────────────────────┘
+
+[health]
+interval = "30s"
+timeout = "5s"
+tls-expiry-warning = "14d"   # Flag HTTPS certificates that expire soon
+# tls-ca = "home-ca.pem"     # Trust your own CA for certificate checks
+max-concurrent = 10
+max-redirects = 5
+# allow-cidrs = ["192.168.0.0/16"]   # Only check services in these networks
+# deny-cidrs = ["169.254.0.0/16"]    # Never check services in these networks
+
+
+# ┌───────────────────────────────────────────────────────────────────────────┐
+# │  NOTIFICATIONS                                                            │
+# │  Alerts when agents disconnect, containers die or services go down        │
+# └───────────────────────────────────────────────────────────────────────────┘
+
+# [[notify]]
+# type = "ntfy"                              # webhook, ntfy, gotify or email
+# url = "https://ntfy.sh/${NTFY_TOPIC}"
+# events = ["agent", "container", "service"]
+# cooldown = "10m"                           # Per alert, against flapping
+# recovery = true                            # Message when it is fixed again
+
+# [[alert]]                                  # Threshold rules, sent to the channels above
+# name = "disk-full"
+# metric = "disk:*"                          # cpu, memory, disk:<path>, container-restarts, service-up, ...
+# above = 90
+# for = "5m"
+# severity = "critical"                      # info, warning or critical
 
 
 # ┌───────────────────────────────────────────────────────────────────────────┐
@@ -99,6 +169,9 @@ name = "NAS"
 url = "https://nas.local"
 icon = ""
 online-badge = true
+# [section.service.check]    # Optional, default: HTTP request to url
+# type = "tcp"               # http, tcp, dns or icmp
+# target = "nas.local:445"
 
 # [[section]]
 # title = "Media"
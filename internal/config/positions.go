@@ -0,0 +1,245 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// position is where a key is written in a config file, 1-based
+type position struct {
+	Line   int
+	Column int
+}
+
+// keyIndex knows where the keys of a config file are written. Paths are the
+// dotted keys with the entry of array tables, e.g. "section[1].service[0].url".
+type keyIndex struct {
+	paths map[string]position
+	at    map[position]string // the reverse, for errors that only have a position
+	lines map[int]string      // first key of every line, for errors that point at a value
+}
+
+// indexKeys records the position of every table and key in data. Indexing
+// stops at the first syntax error, the decoder reports that one.
+func indexKeys(data []byte) *keyIndex {
+	idx := &keyIndex{
+		paths: make(map[string]position),
+		at:    make(map[position]string),
+		lines: make(map[int]string),
+	}
+	arrays := make(map[string]int) // array table path -> entries so far
+
+	var p unstable.Parser
+	p.Reset(data)
+	table := ""
+	for p.NextExpression() {
+		n := p.Expression()
+		switch n.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			parts, first := keyParts(n.Key())
+			if len(parts) == 0 {
+				continue
+			}
+			// Keys inside array tables belong to their last entry
+			path := ""
+			for i, part := range parts {
+				path = joinKey(path, part)
+				if n.Kind == unstable.ArrayTable && i == len(parts)-1 {
+					entry := arrays[path]
+					arrays[path]++
+					path = fmt.Sprintf("%s[%d]", path, entry)
+				} else if count := arrays[path]; count > 0 {
+					path = fmt.Sprintf("%s[%d]", path, count-1)
+				}
+			}
+			table = path
+			idx.add(path, p.Shape(first.Raw).Start)
+
+		case unstable.KeyValue:
+			idx.keyValue(&p, table, n)
+		}
+	}
+	return idx
+}
+
+// keyValue records a key and, for inline tables and arrays of them, the keys inside
+func (idx *keyIndex) keyValue(p *unstable.Parser, table string, n *unstable.Node) {
+	parts, first := keyParts(n.Key())
+	if len(parts) == 0 {
+		return
+	}
+	path := table
+	for _, part := range parts {
+		path = joinKey(path, part)
+	}
+	idx.add(path, p.Shape(first.Raw).Start)
+
+	value := n.Value()
+	switch value.Kind {
+	case unstable.InlineTable:
+		it := value.Children()
+		for it.Next() {
+			idx.keyValue(p, path, it.Node())
+		}
+	case unstable.Array:
+		i := 0
+		it := value.Children()
+		for it.Next() {
+			if child := it.Node(); child.Kind == unstable.InlineTable {
+				entry := fmt.Sprintf("%s[%d]", path, i)
+				kv := child.Children()
+				for kv.Next() {
+					idx.keyValue(p, entry, kv.Node())
+				}
+			}
+			i++
+		}
+	}
+}
+
+func (idx *keyIndex) add(path string, pos unstable.Position) {
+	at := position{Line: pos.Line, Column: pos.Column}
+	if _, ok := idx.paths[path]; !ok {
+		idx.paths[path] = at
+	}
+	if _, ok := idx.at[at]; !ok {
+		idx.at[at] = path
+	}
+	if _, ok := idx.lines[at.Line]; !ok {
+		idx.lines[at.Line] = path
+	}
+}
+
+// pathAt returns the key written at line and column, or the first one on that line
+func (idx *keyIndex) pathAt(line, column int) string {
+	if path, ok := idx.at[position{Line: line, Column: column}]; ok {
+		return path
+	}
+	return idx.lines[line]
+}
+
+// find returns the position of path, or of the closest table above it
+func (idx *keyIndex) find(path string) (position, bool) {
+	for path != "" {
+		if pos, ok := idx.paths[path]; ok {
+			return pos, true
+		}
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+	return position{}, false
+}
+
+// keyParts returns the parts of a dotted key and the node of the first one
+func keyParts(it unstable.Iterator) ([]string, *unstable.Node) {
+	var parts []string
+	var first *unstable.Node
+	for it.Next() {
+		if first == nil {
+			first = it.Node()
+		}
+		parts = append(parts, string(it.Node().Data))
+	}
+	return parts, first
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggestKey returns the known key that the unknown last part of key was
+// probably meant to be, e.g. "online-badge" for "onlinebadge", or ""
+func suggestKey(key []string) string {
+	if len(key) == 0 {
+		return ""
+	}
+	t := reflect.TypeOf(Config{})
+	for _, part := range key[:len(key)-1] {
+		field, ok := tomlField(t, part)
+		if !ok {
+			return ""
+		}
+		t = field.Type
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+	}
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+
+	unknown := normalizeKey(key[len(key)-1])
+	best, bestDist := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		name := tomlName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		if d := editDistance(unknown, normalizeKey(name)); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	// Short keys are too close to everything
+	if bestDist > 0 && len(unknown) < 5 {
+		return ""
+	}
+	return best
+}
+
+// tomlField finds the field of struct t that is decoded from key
+func tomlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	if t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if tomlName(t.Field(i)) == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// tomlName is the key of a struct field, "" for fields that are not decoded
+func tomlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+	if name == "-" || !f.IsExported() {
+		return ""
+	}
+	return name
+}
+
+// normalizeKey makes "online_badge", "onlineBadge" and "online-badge" equal
+func normalizeKey(s string) string {
+	s = strings.ToLower(s)
+	return strings.NewReplacer("-", "", "_", "").Replace(s)
+}
+
+// editDistance is the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
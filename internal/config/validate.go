@@ -0,0 +1,274 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"herbst/internal/util"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Issue is a problem found in a config file, with the position editors underline
+type Issue struct {
+	Key     string `json:"key,omitempty"` // e.g. "section[1].service[0].url", entries count from 0
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"` // 1-based, 0 = unknown
+	Column  int    `json:"column,omitempty"`
+}
+
+// Validation is the result of Validate. Errors keep a file from being saved,
+// warnings point out settings that are accepted but probably not intended.
+type Validation struct {
+	Valid    bool    `json:"valid"`
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+
+	Config *Config `json:"-"` // the decoded config with environment variables expanded, nil if it does not decode
+
+	keys *keyIndex
+}
+
+// Validate decodes data strictly, so unknown keys are errors, and checks the
+// values. themes maps the keys of the available themes to their display names,
+// either may be used as theme; nil skips the theme check. Callers can add their
+// own issues with Error and Warn.
+func Validate(data []byte, themes map[string]string) *Validation {
+	v := &Validation{
+		Valid:    true,
+		Errors:   []Issue{},
+		Warnings: []Issue{},
+		keys:     indexKeys(data),
+	}
+
+	var cfg Config
+	dec := toml.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&cfg)
+
+	var strictErr *toml.StrictMissingError
+	var decodeErr *toml.DecodeError
+	switch {
+	case err == nil:
+	case errors.As(err, &strictErr):
+		// Everything else was decoded, so the other checks still run
+		for _, e := range strictErr.Errors {
+			line, column := e.Position()
+			key := e.Key()
+			path := v.keys.pathAt(line, column)
+			if path == "" {
+				path = strings.Join(key, ".")
+			}
+			msg := fmt.Sprintf("unknown key %q", key[len(key)-1])
+			if s := suggestKey(key); s != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", s)
+			}
+			v.add(&v.Errors, Issue{Key: path, Message: msg, Line: line, Column: column})
+		}
+	case errors.As(err, &decodeErr):
+		line, column := decodeErr.Position()
+		msg := strings.TrimPrefix(decodeErr.Error(), "toml: ")
+		v.add(&v.Errors, Issue{Key: v.keys.pathAt(line, column), Message: msg, Line: line, Column: column})
+		return v
+	default:
+		v.Error("", "%v", err)
+		return v
+	}
+
+	v.check(&cfg, themes)
+	expandEnvVars(&cfg)
+	assignServiceIDs(&cfg)
+	v.Config = &cfg
+	return v
+}
+
+// Error adds an error about key
+func (v *Validation) Error(key, format string, args ...any) {
+	v.add(&v.Errors, v.issue(key, format, args...))
+}
+
+// Warn adds a warning about key
+func (v *Validation) Warn(key, format string, args ...any) {
+	v.add(&v.Warnings, v.issue(key, format, args...))
+}
+
+// Err returns the errors as one error, nil if the config is valid
+func (v *Validation) Err() error {
+	var errs []error
+	for _, is := range v.Errors {
+		errs = append(errs, errors.New(is.String()))
+	}
+	return errors.Join(errs...)
+}
+
+func (v *Validation) issue(key, format string, args ...any) Issue {
+	is := Issue{Key: key, Message: fmt.Sprintf(format, args...)}
+	if pos, ok := v.keys.find(key); ok {
+		is.Line, is.Column = pos.Line, pos.Column
+	}
+	return is
+}
+
+func (v *Validation) add(list *[]Issue, is Issue) {
+	*list = append(*list, is)
+	v.Valid = len(v.Errors) == 0
+}
+
+// String formats the issue like "line 12: section[0].service[1]: missing url"
+func (is Issue) String() string {
+	var b strings.Builder
+	if is.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", is.Line)
+	}
+	if is.Key != "" {
+		b.WriteString(is.Key + ": ")
+	}
+	b.WriteString(is.Message)
+	return b.String()
+}
+
+// check runs the semantic checks on the decoded, not yet expanded config
+func (v *Validation) check(cfg *Config, themes map[string]string) {
+	if cfg.Theme != "" && themes != nil && !strings.Contains(cfg.Theme, "${") {
+		known := false
+		for key, name := range themes {
+			if cfg.Theme == key || strings.EqualFold(cfg.Theme, name) {
+				known = true
+			}
+		}
+		if !known {
+			keys := slices.Sorted(maps.Keys(themes))
+			v.Error("theme", "unknown theme %q (use %s)", cfg.Theme, strings.Join(keys, ", "))
+		}
+	}
+	v.oneOf("ui.clock.time-format", cfg.UI.Clock.TimeFormat, Choices["Clock.time-format"]...)
+	v.oneOf("ui.clock.date-format", cfg.UI.Clock.DateFormat, Choices["Clock.date-format"]...)
+
+	v.oneOf("weather.units", cfg.Weather.Units, Choices["Weather.units"]...)
+	if cfg.Weather.Enabled {
+		if cfg.Weather.APIKey == "" {
+			v.Warn("weather", "weather is enabled but api-key is missing")
+		}
+		if cfg.Weather.Location == "" && cfg.Weather.Lat == 0 && cfg.Weather.Lon == 0 {
+			v.Warn("weather", "weather is enabled but neither location nor lat/lon is set")
+		}
+	}
+
+	v.oneOf("docker.agent-protocol", cfg.Docker.AgentProtocol, Choices["Docker.agent-protocol"]...)
+	agents := make(map[string]bool)
+	for i, a := range cfg.Docker.Agents {
+		key := fmt.Sprintf("docker.agent[%d]", i)
+		switch {
+		case a.Name == "":
+			v.Error(key, "missing name")
+		case agents[a.Name]:
+			v.Error(key+".name", "duplicate agent name %q", a.Name)
+		}
+		agents[a.Name] = true
+	}
+
+	v.prefixes("api.trusted-proxies", cfg.API.TrustedProxies)
+
+	v.duration("storage.retention", cfg.Storage.Retention, true)
+	v.duration("storage.downsample-after", cfg.Storage.DownsampleAfter, true)
+	if d, ok := v.duration("storage.compact-interval", cfg.Storage.CompactInterval, false); ok && d < time.Minute {
+		v.Error("storage.compact-interval", "must be at least 1m")
+	}
+
+	v.duration("health.interval", cfg.Health.Interval, false)
+	v.duration("health.timeout", cfg.Health.Timeout, false)
+	v.duration("health.tls-expiry-warning", cfg.Health.TLSExpiryWarning, false)
+	if cfg.Health.MaxConcurrent < 0 {
+		v.Error("health.max-concurrent", "must not be negative")
+	}
+	if cfg.Health.MaxRedirects != nil && *cfg.Health.MaxRedirects < 0 {
+		v.Error("health.max-redirects", "must not be negative")
+	}
+	v.prefixes("health.allow-cidrs", cfg.Health.AllowCIDRs)
+	v.prefixes("health.deny-cidrs", cfg.Health.DenyCIDRs)
+
+	// Explicit service ids must be unique, derived ones are made unique
+	ids := make(map[string]bool)
+	service := func(key string, svc Service) {
+		if svc.ID != "" {
+			if ids[svc.ID] {
+				v.Error(key+".id", "duplicate service id %q", svc.ID)
+			}
+			ids[svc.ID] = true
+		}
+		if svc.Name == "" {
+			v.Warn(key, "missing name")
+		}
+		if svc.URL == "" && svc.Check == nil {
+			v.Warn(key, "missing url")
+		}
+		if svc.Check != nil && !svc.OnlineBadge {
+			v.Warn(key+".check", "the check is only used with online-badge = true")
+		}
+		if svc.Check != nil && svc.Check.Timeout != "" {
+			v.duration(key+".check.timeout", svc.Check.Timeout, false)
+		}
+	}
+	for i, svc := range cfg.Services {
+		service(fmt.Sprintf("service[%d]", i), svc)
+	}
+	for i, sec := range cfg.Sections {
+		for j, svc := range sec.Services {
+			service(fmt.Sprintf("section[%d].service[%d]", i, j), svc)
+		}
+	}
+
+	rules := make(map[string]bool)
+	for i, r := range cfg.Alerts {
+		if r.Name != "" && rules[r.Name] {
+			v.Error(fmt.Sprintf("alert[%d].name", i), "duplicate alert name %q", r.Name)
+		}
+		rules[r.Name] = true
+	}
+}
+
+// oneOf reports an error if value is set and not one of allowed (case-insensitive).
+// Values taken from environment variables are only known at load time.
+func (v *Validation) oneOf(key, value string, allowed ...string) {
+	if value == "" || allowed == nil || strings.Contains(value, "${") {
+		return
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return
+		}
+	}
+	v.Error(key, "unknown value %q (use %s)", value, strings.Join(allowed, ", "))
+}
+
+// prefixes reports the entries of list that are neither a network like
+// "10.0.0.0/8" nor a single address, parsed the way herbst uses them
+func (v *Validation) prefixes(key string, list []string) {
+	for _, c := range list {
+		if strings.Contains(c, "${") {
+			continue
+		}
+		if _, err := util.ParsePrefixes([]string{c}); err != nil {
+			v.Error(key, "invalid address or network %q", c)
+		}
+	}
+}
+
+// duration reports an error if value is set and not a duration like "30s" or
+// "7d". zero allows "0", which usually means never or forever.
+func (v *Validation) duration(key, value string, zero bool) (time.Duration, bool) {
+	if value == "" || strings.Contains(value, "${") {
+		return 0, false
+	}
+	d, err := util.ParseDuration(value)
+	if err != nil || d < 0 || (d == 0 && !zero) {
+		v.Error(key, "invalid duration %q (e.g. \"30s\", \"5m\", \"7d\")", value)
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePositions(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		key     string
+		line    int
+		column  int
+		message string // part of the message
+		warning bool
+	}{
+		{
+			name:    "syntax error",
+			config:  "title = \n",
+			line:    1,
+			column:  9,
+			message: "incomplete number",
+		},
+		{
+			name:    "unknown key",
+			config:  "[[section]]\ntitle = \"Home\"\n\n[[section.service]]\nname = \"HA\"\n  urll = \"https://ha.local\"\n",
+			key:     "section[0].service[0].urll",
+			line:    6,
+			column:  3,
+			message: `unknown key "urll"`,
+		},
+		{
+			name:    "invalid duration",
+			config:  "title = \"x\"\n\n[health]\n  interval = \"soon\"\n",
+			key:     "health.interval",
+			line:    4,
+			column:  3,
+			message: `invalid duration "soon"`,
+		},
+		{
+			name:    "second entry of an array of tables",
+			config:  "[[docker.agent]]\nname = \"n1\"\n\n[[docker.agent]]\n  name = \"n1\"\n",
+			key:     "docker.agent[1].name",
+			line:    5,
+			column:  3,
+			message: `duplicate agent name "n1"`,
+		},
+		{
+			name:    "invalid network",
+			config:  "[api]\ntoken = \"x\"\ntrusted-proxies = [\"10.0.0.0/33\"]\n",
+			key:     "api.trusted-proxies",
+			line:    3,
+			column:  1,
+			message: `invalid address or network "10.0.0.0/33"`,
+		},
+		{
+			name:    "unknown choice",
+			config:  "[ui.clock]\ntime-format = \"25h\"\n",
+			key:     "ui.clock.time-format",
+			line:    2,
+			column:  1,
+			message: `unknown value "25h"`,
+		},
+		{
+			name:    "warning on a table header",
+			config:  "[[section]]\ntitle = \"Home\"\n\n[[section.service]]\nname = \"HA\"\n",
+			key:     "section[0].service[0]",
+			line:    4,
+			column:  3,
+			message: "missing url",
+			warning: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := Validate([]byte(tt.config), nil)
+			issues := v.Errors
+			if tt.warning {
+				issues = v.Warnings
+				if !v.Valid {
+					t.Errorf("warnings must not make the config invalid: %v", v.Errors)
+				}
+			} else if v.Valid {
+				t.Error("config is valid")
+			}
+			if len(issues) != 1 {
+				t.Fatalf("got %d issues, want 1: %+v", len(issues), issues)
+			}
+			is := issues[0]
+			if is.Key != tt.key || is.Line != tt.line || is.Column != tt.column || !strings.Contains(is.Message, tt.message) {
+				t.Errorf("got %q at %d:%d %q, want %q at %d:%d containing %q",
+					is.Key, is.Line, is.Column, is.Message, tt.key, tt.line, tt.column, tt.message)
+			}
+		})
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	config := `title = "Home"
+
+[api]
+token = "${HERBST_API_TOKEN}"
+trusted-proxies = ["10.0.0.0/8", "192.168.1.1"]
+
+[storage]
+retention = "30d"
+
+[[section]]
+title = "Media"
+
+[[section.service]]
+name = "Jellyfin"
+url = "https://jellyfin.local"
+`
+	v := Validate([]byte(config), nil)
+	if !v.Valid || len(v.Warnings) != 0 {
+		t.Fatalf("Validate() = %+v, %+v, want no issues", v.Errors, v.Warnings)
+	}
+	if v.Config == nil || v.Config.Sections[0].Services[0].Name != "Jellyfin" {
+		t.Errorf("config was not decoded: %+v", v.Config)
+	}
+}
+
+func TestIssueString(t *testing.T) {
+	tests := []struct {
+		issue Issue
+		want  string
+	}{
+		{Issue{Key: "section[0].service[1]", Message: "missing url", Line: 12, Column: 1}, "line 12: section[0].service[1]: missing url"},
+		{Issue{Key: "theme", Message: "unknown theme"}, "theme: unknown theme"},
+		{Issue{Message: "incomplete number", Line: 3}, "line 3: incomplete number"},
+	}
+	for _, tt := range tests {
+		if got := tt.issue.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// internal/docker/client.go
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"herbst/internal/proto"
+)
+
+// DefaultSocketPath is used when no socket path is configured
+const DefaultSocketPath = "/var/run/docker.sock"
+
+// Container actions supported by ContainerAction
+const (
+	ActionStart   = "start"
+	ActionStop    = "stop"
+	ActionRestart = "restart"
+	ActionPause   = "pause"
+	ActionUnpause = "unpause"
+)
+
+// IsValidAction reports whether action is one of the supported container actions
+func IsValidAction(action string) bool {
+	switch action {
+	case ActionStart, ActionStop, ActionRestart, ActionPause, ActionUnpause:
+		return true
+	}
+	return false
+}
+
+// Client talks to the Docker Engine API over a Unix socket
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client for the Docker socket at socketPath
+func NewClient(socketPath string) *Client {
+	if socketPath == "" {
+		socketPath = DefaultSocketPath
+	}
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// APIError is returned when the Docker API answers with an error status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("docker API %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("docker API %d: %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// do performs a request against the Docker API and returns the response.
+// Error statuses are converted to *APIError and the body is closed.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	u := "http://docker" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var body struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(data, &body) != nil {
+			body.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: body.Message}
+	}
+
+	return resp, nil
+}
+
+// withTimeout applies a default timeout unless the context already has a deadline
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// ListContainers returns all containers (running and stopped)
+func (c *Client) ListContainers(ctx context.Context) ([]proto.Container, error) {
+	ctx, cancel := withTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/json", url.Values{"all": {"true"}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var raw []struct {
+		ID      string   `json:"Id"`
+		Names   []string `json:"Names"`
+		Image   string   `json:"Image"`
+		State   string   `json:"State"`
+		Status  string   `json:"Status"`
+		Created int64    `json:"Created"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	out := make([]proto.Container, 0, len(raw))
+	for _, c := range raw {
+		name := ShortID(c.ID)
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		out = append(out, proto.Container{
+			ID:      c.ID,
+			Name:    name,
+			Image:   c.Image,
+			State:   c.State,
+			Status:  c.Status,
+			Created: c.Created,
+		})
+	}
+
+	return out, nil
+}
+
+// InspectContainer returns the current state of a container
+func (c *Client) InspectContainer(ctx context.Context, id string) (*proto.ContainerState, error) {
+	ctx, cancel := withTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var raw struct {
+		ID    string `json:"Id"`
+		Name  string `json:"Name"`
+		State struct {
+			Status     string `json:"Status"`
+			Running    bool   `json:"Running"`
+			Paused     bool   `json:"Paused"`
+			Restarting bool   `json:"Restarting"`
+			ExitCode   int    `json:"ExitCode"`
+			StartedAt  string `json:"StartedAt"`
+			FinishedAt string `json:"FinishedAt"`
+		} `json:"State"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	return &proto.ContainerState{
+		ID:         raw.ID,
+		Name:       strings.TrimPrefix(raw.Name, "/"),
+		State:      raw.State.Status,
+		Running:    raw.State.Running,
+		Paused:     raw.State.Paused,
+		Restarting: raw.State.Restarting,
+		ExitCode:   raw.State.ExitCode,
+		StartedAt:  raw.State.StartedAt,
+		FinishedAt: raw.State.FinishedAt,
+	}, nil
+}
+
+// ContainerAction runs start/stop/restart/pause/unpause on a container
+// and returns the container state afterwards
+func (c *Client) ContainerAction(ctx context.Context, id, action string) (*proto.ContainerState, error) {
+	if !IsValidAction(action) {
+		return nil, fmt.Errorf("unsupported container action %q", action)
+	}
+
+	// stop and restart wait for the container to exit (default grace period is 10s)
+	actionCtx, cancel := withTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	resp, err := c.do(actionCtx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/"+action, nil)
+	if err != nil {
+		return nil, err
+	}
+	// 304 (already started/stopped) is fine, the inspect below reports the state
+	resp.Body.Close()
+
+	return c.InspectContainer(ctx, id)
+}
+
+// ShortID returns the 12 character short form of a container ID
+func ShortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,127 @@
+// internal/docker/events.go
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a container event from the Docker event stream
+type Event struct {
+	Action string `json:"Action"` // e.g. start, die, destroy, pause, health_status: healthy
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"` // name, image, exitCode, ...
+	} `json:"Actor"`
+	Time int64 `json:"time"`
+}
+
+// ContainerID returns the ID of the container the event is about
+func (e Event) ContainerID() string {
+	return e.Actor.ID
+}
+
+// ChangesState reports whether the event can change what a container list shows.
+// exec_* and attach events fire constantly (healthchecks) and are ignored.
+func (e Event) ChangesState() bool {
+	switch e.Action {
+	case "create", "start", "restart", "stop", "die", "kill", "destroy",
+		"pause", "unpause", "rename", "update", "oom":
+		return true
+	}
+	// "health_status: healthy" etc. change the status text
+	return strings.HasPrefix(e.Action, "health_status")
+}
+
+// Events subscribes to container events and calls fn for each one.
+// It blocks until ctx is cancelled, the stream breaks or fn returns an error.
+func (c *Client) Events(ctx context.Context, fn func(Event) error) error {
+	filters, _ := json.Marshal(map[string][]string{"type": {"container"}})
+
+	resp, err := c.do(ctx, http.MethodGet, "/events", url.Values{"filters": {string(filters)}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev Event
+		if err := dec.Decode(&ev); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// maxWaitFactor bounds the debounce: while events keep arriving, onChange still
+// runs at the latest maxWaitFactor × debounce after the oldest pending event.
+const maxWaitFactor = 4
+
+// WatchContainers calls onChange whenever containers change state. Bursts of events
+// (e.g. "docker compose up") are coalesced into one call after the debounce delay.
+// The event stream is reconnected after errors; WatchContainers returns when ctx is cancelled.
+func (c *Client) WatchContainers(ctx context.Context, debounce time.Duration, onChange func()) {
+	var (
+		mu      sync.Mutex
+		timer   *time.Timer
+		pending time.Time // oldest event not reported yet
+	)
+	fire := func() {
+		mu.Lock()
+		pending = time.Time{}
+		mu.Unlock()
+		onChange()
+	}
+	defer func() {
+		mu.Lock()
+		if timer != nil {
+			timer.Stop()
+		}
+		mu.Unlock()
+	}()
+
+	for {
+		err := c.Events(ctx, func(ev Event) error {
+			if !ev.ChangesState() {
+				return nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			now := time.Now()
+			if pending.IsZero() {
+				pending = now
+			}
+			delay := min(debounce, pending.Add(maxWaitFactor*debounce).Sub(now))
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(delay, fire)
+			return nil
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("docker event stream ended: %v (reconnecting in 5s)", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+
+		// Events may have been missed while disconnected
+		onChange()
+	}
+}
@@ -0,0 +1,179 @@
+// internal/docker/logs.go
+package docker
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"herbst/internal/proto"
+)
+
+// LogOptions controls which part of a container log is returned
+type LogOptions struct {
+	Follow     bool  // keep streaming new lines until ctx is cancelled
+	Tail       int   // number of lines from the end (0 = all)
+	Since      int64 // unix timestamp, only lines after this time (0 = no limit)
+	Timestamps bool  // prefix every line with an RFC3339Nano timestamp
+}
+
+// ContainerLogs reads the logs of a container and calls fn for every line.
+// With Follow set it blocks until ctx is cancelled, the container stops or fn returns an error.
+func (c *Client) ContainerLogs(ctx context.Context, id string, opts LogOptions, fn func(proto.LogLine) error) error {
+	// TTY containers send raw output, all others use Docker's multiplexed stream format
+	tty, err := c.containerTTY(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{
+		"stdout": {"true"},
+		"stderr": {"true"},
+	}
+	if opts.Follow {
+		q.Set("follow", "true")
+	}
+	if opts.Tail > 0 {
+		q.Set("tail", strconv.Itoa(opts.Tail))
+	}
+	if opts.Since > 0 {
+		q.Set("since", strconv.FormatInt(opts.Since, 10))
+	}
+	if opts.Timestamps {
+		q.Set("timestamps", "true")
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs", q)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if tty {
+		return scanLines(resp.Body, "stdout", fn)
+	}
+	return demuxLines(resp.Body, fn)
+}
+
+func (c *Client) containerTTY(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var raw struct {
+		Config struct {
+			Tty bool `json:"Tty"`
+		} `json:"Config"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return false, err
+	}
+	return raw.Config.Tty, nil
+}
+
+// maxLineSize limits a single log line, longer lines are truncated (raw TTY)
+// or split (multiplexed streams) so output without newlines cannot grow unbounded
+const maxLineSize = 1024 * 1024
+
+// scanLines splits a raw TTY stream into lines, dropping everything after
+// maxLineSize bytes of a line.
+func scanLines(r io.Reader, stream string, fn func(proto.LogLine) error) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var line []byte
+	for {
+		chunk, isPrefix, err := br.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if n := maxLineSize - len(line); n > 0 {
+			line = append(line, chunk[:min(n, len(chunk))]...)
+		}
+		if isPrefix {
+			continue
+		}
+		if err := fn(proto.LogLine{Stream: stream, Line: strings.TrimSuffix(string(line), "\r")}); err != nil {
+			return err
+		}
+		line = line[:0]
+	}
+}
+
+// demuxLines splits Docker's multiplexed log stream into lines.
+// Every frame starts with an 8 byte header: [stream, 0, 0, 0, size (uint32 big endian)].
+func demuxLines(r io.Reader, fn func(proto.LogLine) error) error {
+	var (
+		header  [8]byte
+		partial = map[string]string{} // unterminated line per stream
+	)
+
+	emit := func(stream, data string) error {
+		data = partial[stream] + data
+		for {
+			i := strings.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			if err := fn(proto.LogLine{Stream: stream, Line: strings.TrimSuffix(data[:i], "\r")}); err != nil {
+				return err
+			}
+			data = data[i+1:]
+		}
+		// Progress bars and the like never end a line, emit them once the cap is reached
+		for len(data) >= maxLineSize {
+			if err := fn(proto.LogLine{Stream: stream, Line: data[:maxLineSize]}); err != nil {
+				return err
+			}
+			data = data[maxLineSize:]
+		}
+		partial[stream] = data
+		return nil
+	}
+
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+
+		stream := "stdout"
+		if header[0] == 2 {
+			stream = "stderr"
+		}
+
+		size := binary.BigEndian.Uint32(header[4:])
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return err
+		}
+		if err := emit(stream, string(frame)); err != nil {
+			return err
+		}
+	}
+
+	// Flush lines without a trailing newline
+	for _, stream := range []string{"stdout", "stderr"} {
+		if rest := partial[stream]; rest != "" {
+			if err := fn(proto.LogLine{Stream: stream, Line: rest}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// internal/docker/stats.go
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"herbst/internal/proto"
+)
+
+// maxParallelStats limits concurrent stats requests against the Docker socket
+const maxParallelStats = 8
+
+// ContainerStats returns a single resource usage sample for a running container.
+// Docker measures CPU over about one second, so this call takes at least that long.
+func (c *Client) ContainerStats(ctx context.Context, id string) (*proto.ContainerStats, error) {
+	ctx, cancel := withTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/stats", url.Values{"stream": {"false"}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var raw struct {
+		CPUStats    cpuStats `json:"cpu_stats"`
+		PreCPUStats cpuStats `json:"precpu_stats"`
+		MemoryStats struct {
+			Usage uint64            `json:"usage"`
+			Limit uint64            `json:"limit"`
+			Stats map[string]uint64 `json:"stats"`
+		} `json:"memory_stats"`
+		Networks map[string]struct {
+			RxBytes uint64 `json:"rx_bytes"`
+			TxBytes uint64 `json:"tx_bytes"`
+		} `json:"networks"`
+		BlkioStats struct {
+			IOServiceBytesRecursive []struct {
+				Op    string `json:"op"`
+				Value uint64 `json:"value"`
+			} `json:"io_service_bytes_recursive"`
+		} `json:"blkio_stats"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	stats := &proto.ContainerStats{
+		CPUPercent:  cpuPercent(raw.CPUStats, raw.PreCPUStats),
+		MemoryLimit: raw.MemoryStats.Limit,
+	}
+
+	// Same calculation as "docker stats": page cache does not count as used memory
+	// (cgroup v1 reports it as "total_inactive_file", cgroup v2 as "inactive_file")
+	usage := raw.MemoryStats.Usage
+	cache := raw.MemoryStats.Stats["inactive_file"]
+	if v, ok := raw.MemoryStats.Stats["total_inactive_file"]; ok {
+		cache = v
+	}
+	if cache < usage {
+		usage -= cache
+	}
+	stats.MemoryUsage = usage
+	if stats.MemoryLimit > 0 {
+		stats.MemoryPercent = float64(usage) / float64(stats.MemoryLimit) * 100
+	}
+
+	for _, n := range raw.Networks {
+		stats.NetRx += n.RxBytes
+		stats.NetTx += n.TxBytes
+	}
+
+	for _, e := range raw.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			stats.BlockRead += e.Value
+		case "write":
+			stats.BlockWrite += e.Value
+		}
+	}
+
+	return stats, nil
+}
+
+type cpuStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  uint32 `json:"online_cpus"`
+}
+
+func cpuPercent(cur, pre cpuStats) float64 {
+	cpuDelta := float64(cur.CPUUsage.TotalUsage) - float64(pre.CPUUsage.TotalUsage)
+	systemDelta := float64(cur.SystemUsage) - float64(pre.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	cpus := float64(cur.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(cur.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * cpus * 100
+}
+
+// AttachStats fills in Stats for all running containers, querying several in parallel.
+// Containers whose stats cannot be read are left without stats.
+func (c *Client) AttachStats(ctx context.Context, containers []proto.Container) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxParallelStats)
+
+	for i := range containers {
+		if containers[i].State != "running" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(ct *proto.Container) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			stats, err := c.ContainerStats(ctx, ct.ID)
+			if err != nil {
+				log.Printf("failed to read stats for %s: %v", ct.Name, err)
+				return
+			}
+			ct.Stats = stats
+		}(&containers[i])
+	}
+
+	wg.Wait()
+}
+
+// StatsCache keeps the latest stats of the running containers. Sampling takes
+// about a second per container, so it runs in the background through Refresh
+// and container lists only attach the cached values.
+type StatsCache struct {
+	mu       sync.Mutex
+	stats    map[string]*proto.ContainerStats // by container ID
+	lastUsed time.Time
+}
+
+// NewStatsCache returns an empty cache
+func NewStatsCache() *StatsCache {
+	return &StatsCache{stats: make(map[string]*proto.ContainerStats)}
+}
+
+// Refresh samples the stats of all running containers and replaces the cached ones
+func (sc *StatsCache) Refresh(ctx context.Context, c *Client) error {
+	containers, err := c.ListContainers(ctx)
+	if err != nil {
+		return err
+	}
+	c.AttachStats(ctx, containers)
+
+	stats := make(map[string]*proto.ContainerStats, len(containers))
+	for _, ct := range containers {
+		if ct.Stats != nil {
+			stats[ct.ID] = ct.Stats
+		}
+	}
+
+	sc.mu.Lock()
+	sc.stats = stats
+	sc.mu.Unlock()
+	return nil
+}
+
+// Attach fills in the cached stats of the running containers
+func (sc *StatsCache) Attach(containers []proto.Container) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.lastUsed = time.Now()
+	for i := range containers {
+		if containers[i].State == "running" {
+			containers[i].Stats = sc.stats[containers[i].ID]
+		}
+	}
+}
+
+// Idle reports whether no stats were attached for the duration d
+func (sc *StatsCache) Idle(d time.Duration) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return time.Since(sc.lastUsed) > d
+}
+
+// Reset drops the cached stats, e.g. when they are no longer refreshed
+func (sc *StatsCache) Reset() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	clear(sc.stats)
+}
@@ -0,0 +1,154 @@
+// Package health checks whether dashboard services are reachable
+package health
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// State is the health of a service
+type State string
+
+const (
+	StatePending State = "pending" // not checked yet
+	StateUp      State = "up"
+	StateDown    State = "down"
+)
+
+const (
+	// DefaultInterval is how often each service is checked
+	DefaultInterval = 30 * time.Second
+	// DefaultTimeout limits a single check
+	DefaultTimeout = 5 * time.Second
+	// DefaultTLSWarning flags certificates that expire within two weeks
+	DefaultTLSWarning = 14 * 24 * time.Hour
+	// DefaultMaxConcurrent limits how many checks run at the same time
+	DefaultMaxConcurrent = 10
+)
+
+// Options are the settings shared by all checks ([health])
+type Options struct {
+	Interval   time.Duration
+	Timeout    time.Duration  // used when a check does not set its own
+	TLSWarning time.Duration  // certificates expiring within this are flagged
+	TLSRoots   *x509.CertPool // CAs certificates are verified against, nil = system roots
+
+	Policy        Policy // where checks may connect to
+	MaxConcurrent int    // checks running at the same time, across all services
+}
+
+func (o Options) withDefaults() Options {
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+	if o.TLSWarning <= 0 {
+		o.TLSWarning = DefaultTLSWarning
+	}
+	if o.MaxConcurrent <= 0 {
+		o.MaxConcurrent = DefaultMaxConcurrent
+	}
+	return o
+}
+
+// Check types
+const (
+	TypeHTTP = "http"
+	TypeTCP  = "tcp"
+	TypeDNS  = "dns"
+	TypeICMP = "icmp"
+)
+
+// Spec describes how a target is checked
+type Spec struct {
+	Type    string        // http, tcp, dns or icmp
+	Target  string        // URL (http), host:port (tcp) or host name (dns, icmp)
+	Timeout time.Duration // 0 = scheduler timeout
+
+	// HTTP
+	Method       string            // empty = HEAD with GET fallback
+	Headers      map[string]string // extra request headers
+	Status       []StatusRange     // expected status codes, empty = anything below 500
+	BodyContains string
+	BodyRegex    string
+
+	// DNS
+	Server string   // host:port of the DNS server, empty = system resolver
+	Expect []string // addresses the name must resolve to
+
+	invalid string // config error, reported as the check result
+}
+
+// Target is a service checked by the scheduler
+type Target struct {
+	ID      string `json:"id"`
+	Section string `json:"section,omitempty"`
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Type    string `json:"type,omitempty"`
+	Spec    Spec   `json:"-"`
+}
+
+// Result is the outcome of the last check of a service
+type Result struct {
+	State     State     `json:"state"`
+	LatencyMs float64   `json:"latencyMs"`
+	Error     string    `json:"error,omitempty"` // why the check failed
+	TLS       *TLSInfo  `json:"tls,omitempty"`   // certificate of HTTPS services
+	CheckedAt time.Time `json:"checkedAt,omitzero"`
+	ChangedAt time.Time `json:"changedAt,omitzero"` // when State last changed
+}
+
+// Status is a target together with its last result
+type Status struct {
+	Target
+	Result
+}
+
+// Check runs spec once
+func Check(ctx context.Context, spec Spec, opts Options) Result {
+	opts = opts.withDefaults()
+	timeout := opts.Timeout
+	if spec.Timeout > 0 {
+		timeout = spec.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	var tlsInfo *TLSInfo
+	switch spec.Type {
+	case "":
+		err = fmt.Errorf("invalid check: %s", spec.invalid)
+	case TypeHTTP:
+		tlsInfo, err = checkHTTP(ctx, spec, opts)
+	case TypeTCP:
+		err = checkTCP(ctx, spec, opts)
+	case TypeDNS:
+		err = checkDNS(ctx, spec, opts)
+	case TypeICMP:
+		err = checkICMP(ctx, spec, opts)
+	default:
+		err = fmt.Errorf("unknown check type %q", spec.Type)
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("no answer within %s", timeout)
+	}
+
+	res := Result{
+		State:     StateUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		TLS:       tlsInfo,
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		res.State = StateDown
+		res.Error = err.Error()
+	}
+	return res
+}
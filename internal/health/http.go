@@ -0,0 +1,190 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBody is how much of a response body is searched for body-contains / body-regex
+const maxBody = 1 << 20
+
+// newClient returns the HTTP client for one check. Self-signed certificates are
+// common in homelabs, so a bad certificate does not make a service unreachable;
+// the chain is verified on its own and reported separately. Keep-alives are off
+// so every check opens a new connection.
+func newClient(opts Options) *http.Client {
+	policy := opts.Policy
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:       policy.dialer().DialContext,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > policy.MaxRedirects {
+				return fmt.Errorf("too many redirects (max-redirects = %d)", policy.MaxRedirects)
+			}
+			return policy.checkScheme(req.URL.Scheme)
+		},
+	}
+}
+
+// StatusRange is an inclusive range of HTTP status codes
+type StatusRange struct {
+	Min, Max int
+}
+
+func (r StatusRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// ParseStatusRange parses "200", "200-299" or "2xx"
+func ParseStatusRange(s string) (StatusRange, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") {
+		if n, err := strconv.Atoi(s[:1]); err == nil && n >= 1 && n <= 5 {
+			return StatusRange{n * 100, n*100 + 99}, nil
+		}
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	min, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return StatusRange{}, fmt.Errorf("invalid status %q", s)
+	}
+	max := min
+	if isRange {
+		if max, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+			return StatusRange{}, fmt.Errorf("invalid status %q", s)
+		}
+	}
+	if min < 100 || max > 599 || min > max {
+		return StatusRange{}, fmt.Errorf("invalid status %q", s)
+	}
+	return StatusRange{min, max}, nil
+}
+
+// checkHTTP requests the target and compares the response with the expectations.
+// For HTTPS, the certificate chain the server presented is returned as well.
+func checkHTTP(ctx context.Context, spec Spec, opts Options) (*TLSInfo, error) {
+	var bodyRe *regexp.Regexp
+	if spec.BodyRegex != "" {
+		re, err := regexp.Compile(spec.BodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body-regex: %w", err)
+		}
+		bodyRe = re
+	}
+	checkBody := spec.BodyContains != "" || bodyRe != nil
+
+	target, err := neturl.Parse(spec.Target)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Policy.checkScheme(target.Scheme); err != nil {
+		return nil, err
+	}
+
+	client := newClient(opts)
+	var resp *http.Response
+	switch {
+	case spec.Method != "":
+		resp, err = request(ctx, client, spec.Method, spec)
+	case checkBody:
+		resp, err = request(ctx, client, http.MethodGet, spec)
+	default:
+		resp, err = request(ctx, client, http.MethodHead, spec)
+		// Some servers do not implement HEAD
+		if err != nil || resp.StatusCode == http.StatusMethodNotAllowed {
+			if err == nil {
+				resp.Body.Close()
+			}
+			resp, err = request(ctx, client, http.MethodGet, spec)
+		}
+	}
+	if err != nil {
+		// The URL is known, only keep the reason
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tlsInfo *TLSInfo
+	if resp.TLS != nil {
+		// After redirects, this is the certificate of the last host
+		tlsInfo = inspectTLS(resp.TLS.PeerCertificates, resp.Request.URL.Hostname(), time.Now(), opts)
+	}
+	return tlsInfo, checkResponse(resp, spec, bodyRe)
+}
+
+// checkResponse compares status and body with the expectations of spec
+func checkResponse(resp *http.Response, spec Spec, bodyRe *regexp.Regexp) error {
+	if !statusOK(resp.StatusCode, spec.Status) {
+		if len(spec.Status) == 0 {
+			return fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		expected := make([]string, len(spec.Status))
+		for i, r := range spec.Status {
+			expected[i] = r.String()
+		}
+		return fmt.Errorf("HTTP %d, expected %s", resp.StatusCode, strings.Join(expected, ", "))
+	}
+
+	if spec.BodyContains == "" && bodyRe == nil {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return fmt.Errorf("reading body: %w", err)
+	}
+	if spec.BodyContains != "" && !strings.Contains(string(body), spec.BodyContains) {
+		return fmt.Errorf("body does not contain %q", spec.BodyContains)
+	}
+	if bodyRe != nil && !bodyRe.Match(body) {
+		return fmt.Errorf("body does not match %q", spec.BodyRegex)
+	}
+	return nil
+}
+
+// statusOK reports whether code is expected, without ranges anything below 500 is fine
+func statusOK(code int, ranges []StatusRange) bool {
+	if len(ranges) == 0 {
+		return code < 500
+	}
+	for _, r := range ranges {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+func request(ctx context.Context, client *http.Client, method string, spec Spec) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, spec.Target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range spec.Headers {
+		// Host is not a regular header in net/http
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,146 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync/atomic"
+)
+
+// ICMP message types
+const (
+	icmpv4EchoRequest = 8
+	icmpv4EchoReply   = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+var icmpSeq atomic.Uint32
+
+// checkICMP sends one echo request and waits for the matching reply.
+// Unprivileged ping sockets are used where the OS allows them,
+// otherwise a raw socket (root or CAP_NET_RAW).
+func checkICMP(ctx context.Context, spec Spec, opts Options) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, spec.Target)
+	if err != nil {
+		return err
+	}
+	ip := addrs[0].IP
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			ip = a.IP
+			break
+		}
+	}
+	v6 := ip.To4() == nil
+	if addr, ok := netip.AddrFromSlice(ip); ok {
+		if err := opts.Policy.checkAddr(addr); err != nil {
+			return err
+		}
+	}
+
+	conn, raw, err := listenICMP(v6)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Ping sockets replace the ID with their own, raw sockets see every reply and filter by it
+	id := uint16(os.Getpid())
+	seq := uint16(icmpSeq.Add(1))
+	payload := make([]byte, 16)
+	rand.Read(payload)
+
+	msg := make([]byte, 8+len(payload))
+	msg[0], msg[1] = icmpv4EchoRequest, 0
+	if v6 {
+		msg[0] = icmpv6EchoRequest
+	}
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	copy(msg[8:], payload)
+	if !v6 {
+		// The kernel fills in the ICMPv6 checksum itself
+		binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	if raw {
+		dst = &net.IPAddr{IP: ip}
+	}
+	if _, err := conn.WriteTo(msg, dst); err != nil {
+		return err
+	}
+
+	reply := byte(icmpv4EchoReply)
+	if v6 {
+		reply = icmpv6EchoReply
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return fmt.Errorf("no echo reply from %s", ip)
+			}
+			return err
+		}
+		b := buf[:n]
+		// Some systems (macOS) deliver IPv4 replies with the IP header
+		if !v6 && len(b) >= 20 && b[0]>>4 == 4 {
+			b = b[int(b[0]&0x0f)*4:]
+		}
+		if len(b) < 8 || b[0] != reply {
+			continue
+		}
+		if raw && binary.BigEndian.Uint16(b[4:]) != id {
+			continue
+		}
+		if binary.BigEndian.Uint16(b[6:]) != seq || !bytes.Equal(b[8:], payload) {
+			continue
+		}
+		return nil
+	}
+}
+
+// listenICMP opens an unprivileged ping socket, or a raw socket if those are not allowed
+func listenICMP(v6 bool) (conn net.PacketConn, raw bool, err error) {
+	if conn, err := listenUnprivileged(v6); err == nil {
+		return conn, false, nil
+	}
+
+	network, addr := "ip4:icmp", "0.0.0.0"
+	if v6 {
+		network, addr = "ip6:ipv6-icmp", "::"
+	}
+	conn, err = net.ListenPacket(network, addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot open ICMP socket, allow unprivileged ping (sysctl net.ipv4.ping_group_range) or run with CAP_NET_RAW: %w", err)
+	}
+	return conn, true, nil
+}
+
+// icmpChecksum is the internet checksum (RFC 1071) of an ICMPv4 message
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package health
+
+import (
+	"errors"
+	"net"
+)
+
+// listenUnprivileged is not available on this platform, checks fall back to raw sockets
+func listenUnprivileged(v6 bool) (net.PacketConn, error) {
+	return nil, errors.ErrUnsupported
+}
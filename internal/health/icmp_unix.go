@@ -0,0 +1,25 @@
+//go:build linux || darwin
+
+package health
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenUnprivileged opens a datagram ICMP socket ("ping socket"). Linux allows
+// them for groups in net.ipv4.ping_group_range, macOS for everyone.
+func listenUnprivileged(v6 bool) (net.PacketConn, error) {
+	family, proto := syscall.AF_INET, syscall.IPPROTO_ICMP
+	if v6 {
+		family, proto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM, proto)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
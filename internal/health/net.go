@@ -0,0 +1,53 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// checkTCP succeeds if a TCP connection to host:port can be opened
+func checkTCP(ctx context.Context, spec Spec, opts Options) error {
+	conn, err := opts.Policy.dialer().DialContext(ctx, "tcp", spec.Target)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// checkDNS resolves the target name, optionally with a specific server,
+// and compares the answer with the expected addresses
+func checkDNS(ctx context.Context, spec Spec, opts Options) error {
+	resolver := net.DefaultResolver
+	if spec.Server != "" {
+		server := spec.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return opts.Policy.dialer().DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	addrs, err := resolver.LookupHost(ctx, spec.Target)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, want := range spec.Expect {
+		if !slices.Contains(addrs, want) {
+			missing = append(missing, want)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("resolved to %s, expected %s", strings.Join(addrs, ", "), strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package health
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// DefaultMaxRedirects is how many redirects an HTTP check follows
+const DefaultMaxRedirects = 5
+
+// Policy limits where checks may connect to. Addresses are checked when the
+// connection is made, so names that resolve to a blocked address (or change
+// their address later) and redirects are covered as well.
+type Policy struct {
+	Schemes      []string       // URL schemes HTTP checks may use, empty = http and https
+	Allow        []netip.Prefix // addresses checks may connect to, empty = any
+	Deny         []netip.Prefix // addresses checks must not connect to, wins over Allow
+	MaxRedirects int            // redirects an HTTP check follows, 0 = none
+}
+
+// checkScheme returns an error if HTTP checks must not use scheme
+func (p Policy) checkScheme(scheme string) error {
+	allowed := p.Schemes
+	if len(allowed) == 0 {
+		allowed = []string{"http", "https"}
+	}
+	if !slices.Contains(allowed, strings.ToLower(scheme)) {
+		return fmt.Errorf("scheme %q is not allowed by [health] schemes", scheme)
+	}
+	return nil
+}
+
+// checkAddr returns an error if checks must not connect to ip
+func (p Policy) checkAddr(ip netip.Addr) error {
+	// Zoned addresses never match a prefix
+	ip = ip.Unmap().WithZone("")
+	for _, d := range p.Deny {
+		if d.Contains(ip) {
+			return fmt.Errorf("%s is blocked by [health] deny-cidrs", ip)
+		}
+	}
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	for _, a := range p.Allow {
+		if a.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not in [health] allow-cidrs", ip)
+}
+
+// dialer returns a dialer that refuses connections to blocked addresses
+func (p Policy) dialer() *net.Dialer {
+	return &net.Dialer{
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			return p.checkAddr(ip)
+		},
+	}
+}
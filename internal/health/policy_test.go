@@ -0,0 +1,97 @@
+package health
+
+import (
+	"net"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func prefixes(list ...string) []netip.Prefix {
+	var out []netip.Prefix
+	for _, s := range list {
+		out = append(out, netip.MustParsePrefix(s))
+	}
+	return out
+}
+
+func TestPolicyCheckAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		addr    string
+		allowed bool
+	}{
+		{"empty policy allows all", Policy{}, "10.0.0.1", true},
+		{"deny", Policy{Deny: prefixes("169.254.0.0/16")}, "169.254.169.254", false},
+		{"outside deny", Policy{Deny: prefixes("169.254.0.0/16")}, "10.0.0.1", true},
+		{"allow", Policy{Allow: prefixes("192.168.0.0/16")}, "192.168.1.10", true},
+		{"outside allow", Policy{Allow: prefixes("192.168.0.0/16")}, "10.0.0.1", false},
+		{"deny wins over allow", Policy{Allow: prefixes("10.0.0.0/8"), Deny: prefixes("10.1.0.0/16")}, "10.1.2.3", false},
+		{"mapped IPv4", Policy{Deny: prefixes("127.0.0.0/8")}, "::ffff:127.0.0.1", false},
+		{"zoned IPv6", Policy{Deny: prefixes("fe80::/10")}, "fe80::1%eth0", false},
+		{"IPv6 allow", Policy{Allow: prefixes("fd00::/8")}, "fd12::1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.checkAddr(netip.MustParseAddr(tt.addr))
+			if (err == nil) != tt.allowed {
+				t.Errorf("checkAddr(%s) = %v, want allowed=%v", tt.addr, err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckScheme(t *testing.T) {
+	tests := []struct {
+		schemes []string
+		scheme  string
+		allowed bool
+	}{
+		{nil, "http", true},
+		{nil, "HTTPS", true},
+		{nil, "file", false},
+		{[]string{"https"}, "http", false},
+		{[]string{"https"}, "https", true},
+	}
+	for _, tt := range tests {
+		err := Policy{Schemes: tt.schemes}.checkScheme(tt.scheme)
+		if (err == nil) != tt.allowed {
+			t.Errorf("checkScheme(%q) with %v = %v, want allowed=%v", tt.scheme, tt.schemes, err, tt.allowed)
+		}
+	}
+}
+
+func TestPolicyDialer(t *testing.T) {
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		allowed bool
+	}{
+		{"allowed", Policy{Allow: prefixes("127.0.0.0/8")}, true},
+		{"denied", Policy{Deny: prefixes("127.0.0.0/8")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := tt.policy.dialer().Dial("tcp", addr)
+			if err == nil {
+				conn.Close()
+			}
+			if (err == nil) != tt.allowed {
+				t.Errorf("Dial(%s) = %v, want allowed=%v", addr, err, tt.allowed)
+			}
+		})
+	}
+
+	// Names are checked after they resolve
+	_, port, _ := net.SplitHostPort(addr)
+	conn, err := Policy{Deny: prefixes("127.0.0.0/8", "::1/128")}.dialer().Dial("tcp", net.JoinHostPort("localhost", port))
+	if err == nil {
+		conn.Close()
+		t.Error("Dial(localhost) was not blocked")
+	}
+}
@@ -0,0 +1,249 @@
+package health
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// minRecheck is how old a result must be before CheckNow probes again
+const minRecheck = 5 * time.Second
+
+// Scheduler checks all targets in the background and keeps their last result,
+// so browsers read cached states instead of probing services themselves
+type Scheduler struct {
+	mu      sync.RWMutex
+	opts    Options
+	targets []Target
+	results map[string]Result    // target ID -> last result
+	next    map[string]time.Time // target ID -> when the next check is due
+	running map[string]bool      // target ID -> check in progress
+	sem     chan struct{}        // one slot per running check, caps outbound probes
+
+	notify    func(event string)            // called when a service changes state (e.g. SSE broker)
+	listeners []func(st Status, prev State) // called with the new status when a service goes up or down
+}
+
+func NewScheduler() *Scheduler {
+	opts := Options{Policy: Policy{MaxRedirects: DefaultMaxRedirects}}.withDefaults()
+	return &Scheduler{
+		opts:    opts,
+		sem:     make(chan struct{}, opts.MaxConcurrent),
+		results: make(map[string]Result),
+		next:    make(map[string]time.Time),
+		running: make(map[string]bool),
+	}
+}
+
+// SetNotifier registers a callback that is called with "health"
+// whenever a service goes up or down or its certificate state changes
+func (s *Scheduler) SetNotifier(fn func(event string)) {
+	s.notify = fn
+}
+
+// OnChange registers a callback that is called whenever a service changes state,
+// including its first result after startup or a config change (prev is StatePending).
+// Callbacks run on the checking goroutine and must not block.
+func (s *Scheduler) OnChange(fn func(st Status, prev State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// SetTargets replaces the checked services. Results of services whose check did not
+// change are kept, new services are checked right away.
+func (s *Scheduler) SetTargets(targets []Target, opts Options) {
+	opts = opts.withDefaults()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := make(map[string]Target, len(s.targets))
+	for _, t := range s.targets {
+		old[t.ID] = t
+	}
+
+	results := make(map[string]Result, len(targets))
+	next := make(map[string]time.Time, len(targets))
+	for _, t := range targets {
+		if prev, ok := old[t.ID]; ok && sameCheck(prev, t) {
+			results[t.ID] = s.results[t.ID]
+			next[t.ID] = s.next[t.ID]
+			if opts.Interval < s.opts.Interval {
+				next[t.ID] = s.next[t.ID].Add(opts.Interval - s.opts.Interval)
+			}
+			continue
+		}
+		results[t.ID] = Result{State: StatePending}
+	}
+
+	// Checks that are still running release their slot in the old channel
+	if opts.MaxConcurrent != s.opts.MaxConcurrent {
+		s.sem = make(chan struct{}, opts.MaxConcurrent)
+	}
+
+	s.targets = targets
+	s.results = results
+	s.next = next
+	s.opts = opts
+}
+
+// Run checks every target once per interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		s.checkDue(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkDue starts a check for every target whose next check is due
+func (s *Scheduler) checkDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.targets {
+		if s.running[t.ID] || now.Before(s.next[t.ID]) {
+			continue
+		}
+		s.running[t.ID] = true
+		s.next[t.ID] = now.Add(s.opts.Interval)
+		go s.check(ctx, t, s.opts)
+	}
+}
+
+// CheckNow checks the target with id right away and stores the result. A result
+// younger than minRecheck is returned as is, so callers cannot flood a service with probes.
+func (s *Scheduler) CheckNow(ctx context.Context, id string) (Status, bool) {
+	st, ok := s.Get(id)
+	if !ok || time.Since(st.CheckedAt) < minRecheck {
+		return st, ok
+	}
+
+	s.mu.Lock()
+	opts := s.opts
+	running := s.running[id]
+	if !running {
+		s.running[id] = true
+		s.next[id] = time.Now().Add(opts.Interval)
+	}
+	s.mu.Unlock()
+	if running {
+		return st, true
+	}
+
+	// A client that goes away must not turn into a failed check
+	s.check(context.WithoutCancel(ctx), st.Target, opts)
+	return s.Get(id)
+}
+
+// run executes one check, waiting while MaxConcurrent checks are already running
+func (s *Scheduler) run(ctx context.Context, spec Spec, opts Options) Result {
+	s.mu.RLock()
+	sem := s.sem
+	s.mu.RUnlock()
+
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-ctx.Done():
+		return Result{State: StateDown, Error: ctx.Err().Error(), CheckedAt: time.Now()}
+	}
+	return Check(ctx, spec, opts)
+}
+
+func (s *Scheduler) check(ctx context.Context, t Target, opts Options) {
+	res := s.run(ctx, t.Spec, opts)
+
+	s.mu.Lock()
+	delete(s.running, t.ID)
+	prev, ok := s.results[t.ID]
+	if !ok || !s.hasTarget(t) {
+		// Removed or changed by a config reload while the check was running
+		s.mu.Unlock()
+		return
+	}
+	changed := res.State != prev.State
+	res.ChangedAt = prev.ChangedAt
+	if changed {
+		res.ChangedAt = res.CheckedAt
+	}
+	tlsChanged := res.TLS.problems() != prev.TLS.problems()
+	s.results[t.ID] = res
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	if tlsChanged && ctx.Err() == nil {
+		if p := res.TLS.problems(); p != "" {
+			log.Printf("Certificate of %s: %s", t.Name, p)
+		}
+		if !changed && s.notify != nil {
+			s.notify("health")
+		}
+	}
+
+	if changed && ctx.Err() == nil {
+		// The first result after startup or a config change is not worth a log line
+		switch {
+		case prev.State == StatePending:
+		case res.Error != "":
+			log.Printf("Service %s is %s: %s", t.Name, res.State, res.Error)
+		default:
+			log.Printf("Service %s is %s", t.Name, res.State)
+		}
+		for _, fn := range listeners {
+			fn(Status{Target: t, Result: res}, prev.State)
+		}
+		if s.notify != nil {
+			s.notify("health")
+		}
+	}
+}
+
+// hasTarget reports whether t is still checked the same way, s.mu must be held
+func (s *Scheduler) hasTarget(t Target) bool {
+	for _, cur := range s.targets {
+		if cur.ID == t.ID {
+			return sameCheck(cur, t)
+		}
+	}
+	return false
+}
+
+// sameCheck reports whether two targets are checked the same way, so a result of one is valid for the other
+func sameCheck(a, b Target) bool {
+	return a.URL == b.URL && reflect.DeepEqual(a.Spec, b.Spec)
+}
+
+// Status returns the last result of every target in config order
+func (s *Scheduler) Status() []Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Status, 0, len(s.targets))
+	for _, t := range s.targets {
+		list = append(list, Status{Target: t, Result: s.results[t.ID]})
+	}
+	return list
+}
+
+// Get returns the last result of the target with id
+func (s *Scheduler) Get(id string) (Status, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.targets {
+		if t.ID == id {
+			return Status{Target: t, Result: s.results[t.ID]}, true
+		}
+	}
+	return Status{}, false
+}
@@ -0,0 +1,130 @@
+package health
+
+import (
+	"fmt"
+	"net"
+	neturl "net/url"
+	"regexp"
+	"strings"
+
+	"herbst/internal/config"
+	"herbst/internal/util"
+)
+
+// NewTarget builds the check of a configured service. Without a
+// [section.service.check] block the service URL is probed over HTTP.
+// On a config error the target is still usable, its checks fail with the error.
+func NewTarget(section string, svc config.Service) (Target, error) {
+	t := Target{ID: svc.ID, Section: section, Name: svc.Name, URL: svc.URL}
+	spec, err := newSpec(svc)
+	if err != nil {
+		t.Spec = Spec{invalid: err.Error()}
+		return t, err
+	}
+	t.Type = spec.Type
+	t.Spec = spec
+	return t, nil
+}
+
+func newSpec(svc config.Service) (Spec, error) {
+	c := svc.Check
+	if c == nil {
+		c = &config.ServiceCheck{}
+	}
+
+	spec := Spec{
+		Type:         strings.ToLower(c.Type),
+		Target:       c.Target,
+		Method:       strings.ToUpper(c.Method),
+		Headers:      c.Headers,
+		BodyContains: c.BodyContains,
+		BodyRegex:    c.BodyRegex,
+		Server:       c.Server,
+		Expect:       c.Expect,
+	}
+	if spec.Type == "" {
+		spec.Type = TypeHTTP
+	}
+
+	if c.Timeout != "" {
+		d, err := util.ParseDuration(c.Timeout)
+		if err != nil || d <= 0 {
+			return spec, fmt.Errorf("invalid timeout %q", c.Timeout)
+		}
+		spec.Timeout = d
+	}
+
+	// Without a target, the check is derived from the service url
+	var u *neturl.URL
+	if spec.Target == "" {
+		parsed, err := neturl.Parse(svc.URL)
+		if err != nil || parsed.Host == "" {
+			return spec, fmt.Errorf("check needs a target, the service url %q has no host", svc.URL)
+		}
+		u = parsed
+	}
+
+	switch spec.Type {
+	case TypeHTTP:
+		if u != nil {
+			spec.Target = svc.URL
+		}
+		for _, s := range c.Status {
+			r, err := ParseStatusRange(s)
+			if err != nil {
+				return spec, err
+			}
+			spec.Status = append(spec.Status, r)
+		}
+		if spec.BodyRegex != "" {
+			if _, err := regexp.Compile(spec.BodyRegex); err != nil {
+				return spec, fmt.Errorf("invalid body-regex: %w", err)
+			}
+		}
+	case TypeTCP:
+		if u != nil {
+			port := u.Port()
+			if port == "" {
+				port = defaultPort(u.Scheme)
+			}
+			if port == "" {
+				return spec, fmt.Errorf("tcp check needs a port, set target = \"host:port\"")
+			}
+			spec.Target = net.JoinHostPort(u.Hostname(), port)
+		}
+		if _, _, err := net.SplitHostPort(spec.Target); err != nil {
+			return spec, fmt.Errorf("tcp target %q must be host:port", spec.Target)
+		}
+	case TypeDNS, TypeICMP:
+		if u != nil {
+			spec.Target = u.Hostname()
+		}
+		for _, a := range spec.Expect {
+			if net.ParseIP(a) == nil {
+				return spec, fmt.Errorf("expect: %q is not an IP address", a)
+			}
+		}
+	default:
+		return spec, fmt.Errorf("unknown check type %q (http, tcp, dns or icmp)", c.Type)
+	}
+	return spec, nil
+}
+
+// defaultPort returns the well-known port of a URL scheme
+func defaultPort(scheme string) string {
+	switch strings.ToLower(scheme) {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	case "ssh", "sftp":
+		return "22"
+	case "ftp":
+		return "21"
+	case "smb":
+		return "445"
+	case "rdp":
+		return "3389"
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package health
+
+import (
+	"crypto/x509"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// TLSInfo describes the certificate chain an HTTPS service presented.
+// Expiry, trust and hostname are reported separately, a service with a
+// bad certificate is still up.
+type TLSInfo struct {
+	Subject       string     `json:"subject"`
+	Issuer        string     `json:"issuer"`
+	DNSNames      []string   `json:"dnsNames,omitempty"`
+	NotAfter      time.Time  `json:"notAfter"` // earliest expiry in the chain, usually the leaf
+	DaysLeft      int        `json:"daysLeft"` // negative once expired
+	Expiring      bool       `json:"expiring"` // expires within [health] tls-expiry-warning
+	Expired       bool       `json:"expired"`
+	Trusted       bool       `json:"trusted"` // chain verifies against the system roots or tls-ca
+	TrustError    string     `json:"trustError,omitempty"`
+	HostnameMatch bool       `json:"hostnameMatch"`
+	Chain         []CertInfo `json:"chain"`
+}
+
+// CertInfo is one certificate of a presented chain, leaf first
+type CertInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	Serial    string    `json:"serial"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// inspectTLS checks the presented chain for host at now
+func inspectTLS(certs []*x509.Certificate, host string, now time.Time, opts Options) *TLSInfo {
+	if len(certs) == 0 {
+		return nil
+	}
+	leaf := certs[0]
+
+	info := &TLSInfo{
+		Subject:  certName(leaf.Subject.CommonName, leaf.Subject.String()),
+		Issuer:   certName(leaf.Issuer.CommonName, leaf.Issuer.String()),
+		DNSNames: leaf.DNSNames,
+		NotAfter: leaf.NotAfter,
+	}
+	for _, c := range certs {
+		info.Chain = append(info.Chain, CertInfo{
+			Subject:   certName(c.Subject.CommonName, c.Subject.String()),
+			Issuer:    certName(c.Issuer.CommonName, c.Issuer.String()),
+			Serial:    c.SerialNumber.Text(16),
+			NotBefore: c.NotBefore,
+			NotAfter:  c.NotAfter,
+		})
+		// An expiring intermediate breaks the service just like the leaf
+		if c.NotAfter.Before(info.NotAfter) {
+			info.NotAfter = c.NotAfter
+		}
+	}
+
+	left := info.NotAfter.Sub(now)
+	info.DaysLeft = int(math.Floor(left.Hours() / 24))
+	info.Expired = left <= 0
+	info.Expiring = !info.Expired && left <= opts.TLSWarning
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         opts.TLSRoots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	info.Trusted = err == nil
+	if err != nil {
+		info.TrustError = err.Error()
+	}
+	info.HostnameMatch = leaf.VerifyHostname(host) == nil
+
+	return info
+}
+
+// problems summarizes what is wrong with the certificate, empty if nothing is.
+// The scheduler logs and pushes a change whenever this text changes.
+func (t *TLSInfo) problems() string {
+	if t == nil {
+		return ""
+	}
+	var p []string
+	switch {
+	case t.Expired:
+		p = append(p, "expired")
+	case t.Expiring:
+		p = append(p, fmt.Sprintf("expires on %s", t.NotAfter.Format(time.DateOnly)))
+	}
+	if !t.Trusted && !t.Expired {
+		p = append(p, "not trusted")
+	}
+	if !t.HostnameMatch {
+		p = append(p, "hostname mismatch")
+	}
+	return strings.Join(p, ", ")
+}
+
+// certName prefers the common name, certificates without one show the full name
+func certName(cn, full string) string {
+	if cn != "" {
+		return cn
+	}
+	return full
+}
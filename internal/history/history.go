@@ -0,0 +1,403 @@
+// internal/history/history.go
+package history
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Point is one aggregated sample: the average and the peak within its step
+type Point struct {
+	T   int64   `json:"t"` // unix seconds, start of the step
+	V   float64 `json:"v"`
+	Max float64 `json:"max"`
+}
+
+// Resolution describes one ring buffer: Size points of Step each
+type Resolution struct {
+	Step time.Duration
+	Size int
+}
+
+// Span is the time range a resolution covers
+func (r Resolution) Span() time.Duration {
+	return r.Step * time.Duration(r.Size)
+}
+
+// DefaultResolutions keep 1 minute at 1s, 1 hour at 10s and 24 hours at 1 minute
+var DefaultResolutions = []Resolution{
+	{Step: time.Second, Size: 60},
+	{Step: 10 * time.Second, Size: 360},
+	{Step: time.Minute, Size: 1440},
+}
+
+// Backend persists the points of the coarsest resolution, so history
+// survives restarts and reaches further back than the ring buffers
+type Backend interface {
+	Append(key string, p Point) error
+	Query(keys []string, from, to int64) (map[string][]Point, error)
+}
+
+// Store keeps metric series in fixed-size ring buffers at several resolutions.
+// Memory use is bounded by the number of series, not by uptime.
+type Store struct {
+	mu          sync.RWMutex
+	resolutions []Resolution
+	series      map[string]*series
+	backend     Backend // optional, nil keeps everything in memory
+}
+
+func NewStore(resolutions []Resolution) *Store {
+	return &Store{
+		resolutions: resolutions,
+		series:      make(map[string]*series),
+	}
+}
+
+// SetBackend enables persistence. Call it before the first Record.
+func (s *Store) SetBackend(b Backend) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backend = b
+}
+
+// Restore puts a persisted point back into the coarsest ring buffer (e.g. at startup).
+// Points must be restored oldest first.
+func (s *Store) Restore(key string, p Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sr, ok := s.series[key]
+	if !ok {
+		sr = newSeries(s.resolutions)
+		s.series[key] = sr
+	}
+	sr.tiers[len(sr.tiers)-1].restore(p)
+	if p.T >= sr.last {
+		sr.last = p.T
+		sr.value = p.V
+	}
+}
+
+// Key builds the series key for a metric of a node ("local" is herbst's own host)
+func Key(node, metric string) string {
+	return node + "/" + metric
+}
+
+// Record adds a sample to a series, creating it on first use
+func (s *Store) Record(key string, t time.Time, v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sr, ok := s.series[key]
+	if !ok {
+		sr = newSeries(s.resolutions)
+		s.series[key] = sr
+	}
+
+	// Steps finished in the coarsest resolution are handed to the backend
+	coarsest := sr.tiers[len(sr.tiers)-1]
+	before := coarsest.count
+	sr.add(t.Unix(), v)
+	if s.backend != nil && coarsest.count != before {
+		if err := s.backend.Append(key, coarsest.newest()); err != nil {
+			log.Printf("history: failed to persist %s: %v", key, err)
+		}
+	}
+}
+
+// Query returns the samples of the last window of every series in keys, from
+// the finest resolution that covers it, downsampled to at most maxPoints
+// (0 = no limit). The step of the returned points is reported as well. Windows
+// longer than the ring buffers are read from the backend, without holding the
+// lock, so recording goes on meanwhile.
+func (s *Store) Query(keys []string, window time.Duration, maxPoints int) (map[string][]Point, time.Duration) {
+	idx := s.resolutionFor(window)
+	step := s.resolutions[idx].Step
+	from := time.Now().Add(-window).Unix()
+
+	// since copies the points, the ring buffers are not used after unlocking
+	series := make(map[string][]Point, len(keys))
+	s.mu.RLock()
+	for _, key := range keys {
+		if sr, ok := s.series[key]; ok {
+			series[key] = sr.since(idx, from)
+		}
+	}
+	backend := s.backend
+	s.mu.RUnlock()
+
+	if backend != nil && window > s.MaxWindow() {
+		step = s.resolutions[len(s.resolutions)-1].Step
+		stored, err := backend.Query(keys, from, time.Now().Unix())
+		if err != nil {
+			log.Printf("history: failed to read %s: %v", strings.Join(keys, ", "), err)
+		}
+		for _, key := range keys {
+			// Only the step in progress is not persisted yet
+			points := series[key]
+			if n := len(stored[key]); n > 0 {
+				for len(points) > 0 && points[0].T <= stored[key][n-1].T {
+					points = points[1:]
+				}
+			}
+			series[key] = append(stored[key], points...)
+		}
+	}
+
+	// All series share one step, so they line up in charts
+	downsample := false
+	if maxPoints > 0 {
+		if width := int64(window/time.Second) / int64(maxPoints); width > int64(step/time.Second) {
+			step = time.Duration(width) * time.Second
+			downsample = true
+		}
+	}
+	for _, key := range keys {
+		points := series[key]
+		if points == nil {
+			points = []Point{}
+		}
+		if downsample {
+			points = Downsample(points, int64(step/time.Second))
+		}
+		series[key] = points
+	}
+	return series, step
+}
+
+// Keys returns all series keys starting with prefix, sorted
+func (s *Store) Keys(prefix string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []string{}
+	for k := range s.series {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Latest returns the newest sample of every series that got one within maxAge, by key
+func (s *Store) Latest(maxAge time.Duration) map[string]float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cutoff := time.Now().Add(-maxAge).Unix()
+	values := make(map[string]float64)
+	for k, sr := range s.series {
+		if sr.last >= cutoff {
+			values[k] = sr.value
+		}
+	}
+	return values
+}
+
+// MaxWindow is the longest window the store can answer
+func (s *Store) MaxWindow() time.Duration {
+	var longest time.Duration
+	for _, r := range s.resolutions {
+		longest = max(longest, r.Span())
+	}
+	return longest
+}
+
+// Prune drops series without samples for longer than the longest resolution
+// (e.g. removed agents or network interfaces)
+func (s *Store) Prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := now.Add(-s.MaxWindow()).Unix()
+	for k, sr := range s.series {
+		if sr.last < cutoff {
+			delete(s.series, k)
+		}
+	}
+}
+
+// resolutionFor picks the finest resolution whose span covers window
+func (s *Store) resolutionFor(window time.Duration) int {
+	best := 0
+	for i, r := range s.resolutions {
+		if r.Span() >= window {
+			return i
+		}
+		if r.Span() > s.resolutions[best].Span() {
+			best = i
+		}
+	}
+	return best
+}
+
+// Downsample merges points into buckets of step seconds
+func Downsample(points []Point, step int64) []Point {
+	if step <= 1 || len(points) == 0 {
+		return points
+	}
+
+	out := []Point{}
+	var cur Point
+	var sum float64
+	var n int
+	for _, p := range points {
+		start := p.T - p.T%step
+		if n > 0 && start != cur.T {
+			cur.V = sum / float64(n)
+			out = append(out, cur)
+			n = 0
+		}
+		if n == 0 {
+			cur = Point{T: start, Max: p.Max}
+			sum = 0
+		}
+		sum += p.V
+		cur.Max = max(cur.Max, p.Max)
+		n++
+	}
+	cur.V = sum / float64(n)
+	return append(out, cur)
+}
+
+// series holds one metric at every resolution
+type series struct {
+	tiers []*tier
+	last  int64   // time of the newest sample
+	value float64 // newest sample
+}
+
+func newSeries(resolutions []Resolution) *series {
+	sr := &series{tiers: make([]*tier, len(resolutions))}
+	for i, r := range resolutions {
+		sr.tiers[i] = &tier{
+			step:   int64(r.Step / time.Second),
+			points: make([]Point, 0, r.Size),
+			size:   r.Size,
+		}
+	}
+	return sr
+}
+
+// since returns the points from time from on at resolution idx. Where that
+// resolution does not reach back far enough (e.g. after a restart), the gap
+// is filled from coarser resolutions.
+func (sr *series) since(idx int, from int64) []Point {
+	points := sr.tiers[idx].since(from)
+	for i := idx + 1; i < len(sr.tiers); i++ {
+		if len(points) > 0 && points[0].T <= from+sr.tiers[idx].step {
+			break
+		}
+		older := sr.tiers[i].since(from)
+		if len(points) > 0 {
+			cut := len(older)
+			for cut > 0 && older[cut-1].T+sr.tiers[i].step > points[0].T {
+				cut--
+			}
+			older = older[:cut]
+		}
+		points = append(older, points...)
+	}
+	return points
+}
+
+func (sr *series) add(t int64, v float64) {
+	for _, tr := range sr.tiers {
+		tr.add(t, v)
+	}
+	if t >= sr.last {
+		sr.last = t
+		sr.value = v
+	}
+}
+
+// tier is a ring buffer of finished steps plus the step currently being filled
+type tier struct {
+	step   int64
+	points []Point
+	size   int
+	next   int // write position once the buffer is full
+	count  int // finished steps so far, to notice flushes
+
+	cur Point // step in progress
+	sum float64
+	n   int
+}
+
+func (tr *tier) add(t int64, v float64) {
+	start := t - t%tr.step
+	if tr.n > 0 && start != tr.cur.T {
+		if start < tr.cur.T {
+			return // older than the step in progress, e.g. clock jump
+		}
+		tr.flush()
+	}
+	if tr.n == 0 {
+		tr.cur = Point{T: start, Max: v}
+		tr.sum = 0
+	}
+	tr.sum += v
+	tr.cur.Max = max(tr.cur.Max, v)
+	tr.n++
+}
+
+func (tr *tier) flush() {
+	p := tr.cur
+	p.V = tr.sum / float64(tr.n)
+	tr.push(p)
+	tr.n = 0
+}
+
+func (tr *tier) push(p Point) {
+	if len(tr.points) < tr.size {
+		tr.points = append(tr.points, p)
+	} else {
+		tr.points[tr.next] = p
+		tr.next = (tr.next + 1) % tr.size
+	}
+	tr.count++
+}
+
+// restore adds a finished step loaded from the backend
+func (tr *tier) restore(p Point) {
+	if tr.n > 0 && p.T >= tr.cur.T {
+		return // already collecting this step live
+	}
+	if last := tr.newest(); len(tr.points) > 0 && p.T <= last.T {
+		return
+	}
+	tr.push(p)
+}
+
+// newest returns the most recently finished step
+func (tr *tier) newest() Point {
+	if len(tr.points) == 0 {
+		return Point{}
+	}
+	if len(tr.points) < tr.size {
+		return tr.points[len(tr.points)-1]
+	}
+	return tr.points[(tr.next+tr.size-1)%tr.size]
+}
+
+// since returns the points from time from on, oldest first, including the unfinished step
+func (tr *tier) since(from int64) []Point {
+	out := make([]Point, 0, len(tr.points)+1)
+	for i := range tr.points {
+		p := tr.points[(tr.next+i)%len(tr.points)]
+		if p.T >= from {
+			out = append(out, p)
+		}
+	}
+	if tr.n > 0 && tr.cur.T >= from {
+		p := tr.cur
+		p.V = tr.sum / float64(tr.n)
+		out = append(out, p)
+	}
+	return out
+}
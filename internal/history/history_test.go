@@ -0,0 +1,187 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDownsample(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []Point
+		step   int64
+		want   []Point
+	}{
+		{
+			name:   "empty",
+			points: []Point{},
+			step:   60,
+			want:   []Point{},
+		},
+		{
+			name:   "step of one second keeps the points",
+			points: []Point{{T: 1, V: 1, Max: 1}, {T: 2, V: 3, Max: 3}},
+			step:   1,
+			want:   []Point{{T: 1, V: 1, Max: 1}, {T: 2, V: 3, Max: 3}},
+		},
+		{
+			name:   "average and peak per bucket",
+			points: []Point{{T: 0, V: 1, Max: 2}, {T: 10, V: 3, Max: 8}, {T: 60, V: 5, Max: 5}},
+			step:   60,
+			want:   []Point{{T: 0, V: 2, Max: 8}, {T: 60, V: 5, Max: 5}},
+		},
+		{
+			name:   "buckets start at multiples of step",
+			points: []Point{{T: 70, V: 4, Max: 4}, {T: 110, V: 2, Max: 6}, {T: 130, V: 1, Max: 1}},
+			step:   60,
+			want:   []Point{{T: 60, V: 3, Max: 6}, {T: 120, V: 1, Max: 1}},
+		},
+		{
+			name:   "gaps stay gaps",
+			points: []Point{{T: 0, V: 1, Max: 1}, {T: 600, V: 2, Max: 2}},
+			step:   60,
+			want:   []Point{{T: 0, V: 1, Max: 1}, {T: 600, V: 2, Max: 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Downsample(tt.points, tt.step); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Downsample() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolutionFor(t *testing.T) {
+	s := NewStore(DefaultResolutions)
+	tests := []struct {
+		window time.Duration
+		want   int
+	}{
+		{30 * time.Second, 0},
+		{time.Minute, 0},
+		{5 * time.Minute, 1},
+		{time.Hour, 1},
+		{2 * time.Hour, 2},
+		{24 * time.Hour, 2},
+		{7 * 24 * time.Hour, 2}, // longer than any ring buffer: the longest one
+	}
+	for _, tt := range tests {
+		if got := s.resolutionFor(tt.window); got != tt.want {
+			t.Errorf("resolutionFor(%s) = %d, want %d", tt.window, got, tt.want)
+		}
+	}
+}
+
+func TestTiers(t *testing.T) {
+	sr := newSeries([]Resolution{
+		{Step: time.Second, Size: 5},
+		{Step: 10 * time.Second, Size: 3},
+	})
+	// One sample per second for 40 seconds, value = second
+	for i := int64(0); i < 40; i++ {
+		sr.add(i, float64(i))
+	}
+
+	tests := []struct {
+		name string
+		idx  int
+		from int64
+		want []Point
+	}{
+		{
+			name: "fine tier keeps its last steps and the one in progress",
+			idx:  0,
+			from: 34,
+			want: []Point{{34, 34, 34}, {35, 35, 35}, {36, 36, 36}, {37, 37, 37}, {38, 38, 38}, {39, 39, 39}},
+		},
+		{
+			name: "coarse tier averages its steps",
+			idx:  1,
+			from: 0,
+			want: []Point{{0, 4.5, 9}, {10, 14.5, 19}, {20, 24.5, 29}, {30, 34.5, 39}},
+		},
+		{
+			name: "from cuts older steps",
+			idx:  1,
+			from: 15,
+			want: []Point{{20, 24.5, 29}, {30, 34.5, 39}},
+		},
+		{
+			name: "gap in the fine tier is filled from the coarse one",
+			idx:  0,
+			from: 0,
+			want: []Point{{0, 4.5, 9}, {10, 14.5, 19}, {20, 24.5, 29}, {34, 34, 34}, {35, 35, 35}, {36, 36, 36}, {37, 37, 37}, {38, 38, 38}, {39, 39, 39}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sr.since(tt.idx, tt.from); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("since(%d, %d) = %v, want %v", tt.idx, tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTierIgnoresOlderSamples(t *testing.T) {
+	tr := &tier{step: 10, size: 10}
+	tr.add(25, 1)
+	tr.add(5, 100) // clock jumped back
+	tr.add(27, 3)
+	if got, want := tr.since(0), []Point{{20, 2, 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("since() = %v, want %v", got, want)
+	}
+}
+
+type memBackend struct {
+	appended map[string][]Point
+}
+
+func (b *memBackend) Append(key string, p Point) error {
+	b.appended[key] = append(b.appended[key], p)
+	return nil
+}
+
+func (b *memBackend) Query(keys []string, from, to int64) (map[string][]Point, error) {
+	out := make(map[string][]Point)
+	for _, k := range keys {
+		for _, p := range b.appended[k] {
+			if p.T >= from && p.T <= to {
+				out[k] = append(out[k], p)
+			}
+		}
+	}
+	return out, nil
+}
+
+func TestBackend(t *testing.T) {
+	s := NewStore([]Resolution{{Step: time.Second, Size: 10}, {Step: time.Minute, Size: 10}})
+	b := &memBackend{appended: make(map[string][]Point)}
+	s.SetBackend(b)
+
+	// Only finished steps of the coarsest tier are persisted
+	start := time.Now().Truncate(time.Minute).Add(-30 * time.Minute)
+	for i := range 3 * 60 {
+		s.Record("local/cpu", start.Add(time.Duration(i)*time.Second), 10)
+	}
+	if got := len(b.appended["local/cpu"]); got != 2 {
+		t.Fatalf("persisted %d points, want 2", got)
+	}
+
+	// Older points come from the backend, the step in progress from memory
+	b.appended["local/cpu"] = append([]Point{{T: start.Add(-time.Hour).Unix(), V: 5, Max: 5}}, b.appended["local/cpu"]...)
+	got, step := s.Query([]string{"local/cpu"}, 2*time.Hour, 0)
+	if step != time.Minute {
+		t.Errorf("step = %s, want 1m", step)
+	}
+	want := []Point{
+		{T: start.Add(-time.Hour).Unix(), V: 5, Max: 5},
+		{T: start.Unix(), V: 10, Max: 10},
+		{T: start.Add(time.Minute).Unix(), V: 10, Max: 10},
+		{T: start.Add(2 * time.Minute).Unix(), V: 10, Max: 10},
+	}
+	if !reflect.DeepEqual(got["local/cpu"], want) {
+		t.Errorf("Query() = %v, want %v", got["local/cpu"], want)
+	}
+}
@@ -0,0 +1,39 @@
+// internal/history/host.go
+package history
+
+import (
+	"time"
+
+	"herbst/internal/proto"
+)
+
+// LocalNode is the node name used for herbst's own host
+const LocalNode = "local"
+
+// RecordHost stores the values of a host metrics sample as separate series:
+// cpu, memory, swap, load1, disk:<path>, net:<iface>:rx|tx and temp:<sensor>
+func (s *Store) RecordHost(node string, t time.Time, m proto.HostMetrics) {
+	s.Record(Key(node, "cpu"), t, m.CPU.Percent)
+	s.Record(Key(node, "memory"), t, m.Memory.Percent)
+	if m.Swap.Total > 0 {
+		s.Record(Key(node, "swap"), t, m.Swap.Percent)
+	}
+	s.Record(Key(node, "load1"), t, m.Load.Load1)
+
+	disks := m.Disks
+	if len(disks) == 0 && m.Disk.Total > 0 {
+		disks = []proto.DiskMetrics{m.Disk} // older agents
+	}
+	for _, d := range disks {
+		s.Record(Key(node, "disk:"+d.Path), t, d.Percent)
+	}
+
+	for _, n := range m.Network {
+		s.Record(Key(node, "net:"+n.Interface+":rx"), t, n.RxRate)
+		s.Record(Key(node, "net:"+n.Interface+":tx"), t, n.TxRate)
+	}
+
+	for _, temp := range m.Temperatures {
+		s.Record(Key(node, "temp:"+temp.Sensor), t, temp.Celsius)
+	}
+}
@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"herbst/internal/config"
+)
+
+// email sends alerts over SMTP
+type email struct {
+	addr     string // host:port
+	host     string
+	mode     string // starttls, tls or none
+	username string
+	password string
+	from     *mail.Address
+	to       []string
+}
+
+func newEmail(cfg config.Notify) (*email, error) {
+	if cfg.SMTPHost == "" {
+		return nil, errors.New("missing smtp-host")
+	}
+	e := &email{
+		host:     cfg.SMTPHost,
+		mode:     strings.ToLower(cfg.TLS),
+		username: cfg.Username,
+		password: cfg.Password,
+	}
+	port := cfg.SMTPPort
+	switch e.mode {
+	case "", "starttls":
+		e.mode = "starttls"
+		port = orDefault(port, 587)
+	case "tls":
+		port = orDefault(port, 465)
+	case "none":
+		port = orDefault(port, 25)
+	default:
+		return nil, fmt.Errorf("invalid tls %q (use starttls, tls or none)", cfg.TLS)
+	}
+	e.addr = net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port))
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from %q", cfg.From)
+	}
+	e.from = from
+	if len(cfg.To) == 0 {
+		return nil, errors.New("missing to")
+	}
+	for _, to := range cfg.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to %q", to)
+		}
+		e.to = append(e.to, addr.Address)
+	}
+	return e, nil
+}
+
+// orDefault returns v, or def if v is not set
+func orDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+func (e *email) send(ctx context.Context, a Alert) error {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// net/smtp has no context support
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := &tls.Config{ServerName: e.host}
+	if e.mode == "tls" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if e.mode == "starttls" {
+		// Never fall back to plain text, the password would be sent in the clear
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS (set tls = \"tls\" or \"none\")")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if e.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(e.from.Address); err != nil {
+		return err
+	}
+	for _, to := range e.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(e.message(a)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message builds the mail with headers and a quoted-printable text body
+func (e *email) message(a Alert) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[herbst] "+a.Title))
+	fmt.Fprintf(&b, "Date: %s\r\n", a.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	b.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(strings.ReplaceAll(messageText(a), "\n", "\r\n")))
+	qp.Close()
+	return b.Bytes()
+}
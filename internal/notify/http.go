@@ -0,0 +1,231 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"herbst/internal/config"
+)
+
+var client = &http.Client{Timeout: sendTimeout}
+
+// templateFuncs are available in webhook body templates
+var templateFuncs = template.FuncMap{
+	// json encodes a value, so strings in the body are always quoted and escaped
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// webhook posts the alert as JSON, or a body rendered from a template
+type webhook struct {
+	url     string
+	method  string
+	headers map[string]string
+	body    *template.Template // nil = the alert as JSON
+}
+
+func newWebhook(cfg config.Notify) (*webhook, error) {
+	if err := checkURL(cfg.URL); err != nil {
+		return nil, err
+	}
+	w := &webhook{url: cfg.URL, method: strings.ToUpper(cfg.Method), headers: cfg.Headers}
+	if w.method == "" {
+		w.method = http.MethodPost
+	}
+	if cfg.Body != "" {
+		tmpl, err := template.New("body").Funcs(templateFuncs).Option("missingkey=error").Parse(cfg.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body template: %w", err)
+		}
+		w.body = tmpl
+	}
+	return w, nil
+}
+
+func (w *webhook) send(ctx context.Context, a Alert) error {
+	var body []byte
+	if w.body == nil {
+		body, _ = json.Marshal(a)
+	} else {
+		var buf bytes.Buffer
+		if err := w.body.Execute(&buf, a); err != nil {
+			return fmt.Errorf("body template: %w", err)
+		}
+		body = buf.Bytes()
+		// A custom Content-Type means the body is not meant to be JSON
+		if !hasHeader(w.headers, "Content-Type") && !json.Valid(body) {
+			return errors.New("body template did not produce valid JSON (use the json function to quote values)")
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, w.method, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setHeaders(req, w.headers)
+	return do(req)
+}
+
+// ntfy publishes to an ntfy topic URL, e.g. https://ntfy.sh/my-homelab
+type ntfy struct {
+	url      string
+	token    string
+	priority int
+	headers  map[string]string
+}
+
+func newNtfy(cfg config.Notify) (*ntfy, error) {
+	if err := checkURL(cfg.URL); err != nil {
+		return nil, err
+	}
+	if cfg.Priority < 0 || cfg.Priority > 5 {
+		return nil, fmt.Errorf("invalid priority %d (ntfy uses 1-5)", cfg.Priority)
+	}
+	return &ntfy{url: cfg.URL, token: cfg.Token, priority: cfg.Priority, headers: cfg.Headers}, nil
+}
+
+func (n *ntfy) send(ctx context.Context, a Alert) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(messageText(a)))
+	if err != nil {
+		return err
+	}
+	// Header values must be ASCII, ntfy decodes RFC 2047 encoded titles
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", a.Title))
+	if a.Status == StatusResolved {
+		req.Header.Set("Tags", "white_check_mark")
+	} else {
+		req.Header.Set("Tags", "rotating_light")
+		if n.priority > 0 {
+			req.Header.Set("Priority", strconv.Itoa(n.priority))
+		}
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	setHeaders(req, n.headers)
+	return do(req)
+}
+
+// gotify sends to the message API of a Gotify server with an app token
+type gotify struct {
+	url      string
+	token    string
+	priority int
+	headers  map[string]string
+}
+
+func newGotify(cfg config.Notify) (*gotify, error) {
+	if err := checkURL(cfg.URL); err != nil {
+		return nil, err
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("missing token (Gotify app token)")
+	}
+	if cfg.Priority < 0 || cfg.Priority > 10 {
+		return nil, fmt.Errorf("invalid priority %d (Gotify uses 0-10)", cfg.Priority)
+	}
+	return &gotify{
+		url:      strings.TrimSuffix(cfg.URL, "/") + "/message",
+		token:    cfg.Token,
+		priority: cfg.Priority,
+		headers:  cfg.Headers,
+	}, nil
+}
+
+func (g *gotify) send(ctx context.Context, a Alert) error {
+	msg := map[string]interface{}{
+		"title":   a.Title,
+		"message": messageText(a),
+	}
+	if a.Status == StatusFiring && g.priority > 0 {
+		msg["priority"] = g.priority
+	}
+	body, _ := json.Marshal(msg)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.token)
+	setHeaders(req, g.headers)
+	return do(req)
+}
+
+// messageText is the body of push and email messages
+func messageText(a Alert) string {
+	var b strings.Builder
+	if a.Message != "" {
+		b.WriteString(a.Message)
+		b.WriteString("\n\n")
+	}
+	if a.Status == StatusResolved {
+		fmt.Fprintf(&b, "Resolved after %s (since %s)", a.Duration(), a.Since.Format("2006-01-02 15:04:05"))
+	} else {
+		fmt.Fprintf(&b, "Since %s", a.Since.Format("2006-01-02 15:04:05"))
+	}
+	return b.String()
+}
+
+func checkURL(s string) error {
+	if s == "" {
+		return errors.New("missing url")
+	}
+	u, err := neturl.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid url, expected http(s)://host/...")
+	}
+	return nil
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func setHeaders(req *http.Request, headers map[string]string) {
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// do sends req and turns error responses into errors
+func do(req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL may contain a secret (ntfy topic, webhook token), only keep the reason
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		if msg := strings.TrimSpace(string(text)); msg != "" {
+			return fmt.Errorf("HTTP %d: %s", resp.StatusCode, msg)
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return nil
+}
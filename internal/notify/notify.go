@@ -0,0 +1,478 @@
+// Package notify keeps track of alerts about agents, containers, services and
+// hosts and sends them to webhooks, push services and email
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"herbst/internal/config"
+	"herbst/internal/util"
+)
+
+// Alert kinds, also used in the events filter of a channel
+const (
+	KindAgent     = "agent"
+	KindContainer = "container"
+	KindService   = "service"
+	KindHost      = "host"
+)
+
+// Severities, from least to most urgent
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// severityRank orders severities, unknown ones rank like critical so they are never dropped
+func severityRank(s string) int {
+	switch s {
+	case SeverityInfo:
+		return 0
+	case SeverityWarning:
+		return 1
+	}
+	return 2
+}
+
+// ValidSeverity reports whether s is info, warning or critical
+func ValidSeverity(s string) bool {
+	return s == SeverityInfo || s == SeverityWarning || s == SeverityCritical
+}
+
+// Alert statuses
+const (
+	StatusPending  = "pending" // an alert rule waits for its for-duration
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+const (
+	// DefaultCooldown is the minimum time between two alerts for the same condition
+	DefaultCooldown = 10 * time.Minute
+	// sendTimeout limits a single delivery
+	sendTimeout = 15 * time.Second
+	// maxResolved is how many resolved alerts are kept for /api/alerts
+	maxResolved = 100
+)
+
+// Alert is a message about a condition that started or cleared
+type Alert struct {
+	Key      string            `json:"key"`                // identifies the condition, e.g. "service:media-jellyfin"
+	Kind     string            `json:"kind"`               // agent, container, service or host
+	Severity string            `json:"severity"`           // info, warning or critical
+	Status   string            `json:"status"`             // pending, firing or resolved
+	Silenced bool              `json:"silenced,omitempty"` // a silence matches, nothing is sent
+	Title    string            `json:"title"`              // one line, e.g. "Service Jellyfin is down"
+	Message  string            `json:"message"`            // details, e.g. the check error
+	Labels   map[string]string `json:"labels,omitempty"`   // node, container, service, ...
+	Since    time.Time         `json:"since"`              // when the condition started
+	Time     time.Time         `json:"time"`               // when this message was created
+}
+
+// Duration returns how long the condition lasted (resolved) or lasts so far (firing)
+func (a Alert) Duration() time.Duration {
+	return a.Time.Sub(a.Since).Round(time.Second)
+}
+
+// sender delivers an alert to one destination
+type sender interface {
+	send(ctx context.Context, a Alert) error
+}
+
+// Channel is a configured [[notify]] destination
+type Channel struct {
+	Name        string
+	Type        string
+	events      []string // kinds sent to this channel, empty = all
+	minSeverity int
+	cooldown    time.Duration
+	recovery    bool
+	sender      sender
+}
+
+// NewChannels builds the configured channels. Invalid entries are skipped and
+// reported in the returned error, the valid ones are returned either way.
+func NewChannels(list []config.Notify) ([]*Channel, error) {
+	var channels []*Channel
+	var errs []error
+	used := make(map[string]int)
+	for i, cfg := range list {
+		ch, err := newChannel(cfg)
+		if err != nil {
+			name := fmt.Sprintf("#%d", i+1)
+			if cfg.Name != "" {
+				name += " " + cfg.Name
+			}
+			errs = append(errs, fmt.Errorf("[[notify]] %s: %w", name, err))
+			continue
+		}
+		// Cooldowns are tracked by name, so every channel needs its own
+		used[ch.Name]++
+		if n := used[ch.Name]; n > 1 {
+			ch.Name = fmt.Sprintf("%s-%d", ch.Name, n)
+		}
+		channels = append(channels, ch)
+	}
+	return channels, errors.Join(errs...)
+}
+
+// CheckChannel reports what is wrong with a [[notify]] entry, nil if nothing
+func CheckChannel(cfg config.Notify) error {
+	_, err := newChannel(cfg)
+	return err
+}
+
+func newChannel(cfg config.Notify) (*Channel, error) {
+	ch := &Channel{
+		Name:     cfg.Name,
+		Type:     strings.ToLower(cfg.Type),
+		cooldown: DefaultCooldown,
+		recovery: cfg.Recovery == nil || *cfg.Recovery,
+	}
+	if ch.Name == "" {
+		ch.Name = ch.Type
+	}
+
+	for _, e := range cfg.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e != KindAgent && e != KindContainer && e != KindService && e != KindHost {
+			return nil, fmt.Errorf("unknown event %q (use agent, container, service or host)", e)
+		}
+		ch.events = append(ch.events, e)
+	}
+
+	if cfg.MinSeverity != "" {
+		sev := strings.ToLower(cfg.MinSeverity)
+		if !ValidSeverity(sev) {
+			return nil, fmt.Errorf("invalid min-severity %q (use info, warning or critical)", cfg.MinSeverity)
+		}
+		ch.minSeverity = severityRank(sev)
+	}
+
+	if cfg.Cooldown != "" {
+		d, err := util.ParseDuration(cfg.Cooldown)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid cooldown %q", cfg.Cooldown)
+		}
+		ch.cooldown = d
+	}
+
+	var err error
+	switch ch.Type {
+	case "webhook":
+		ch.sender, err = newWebhook(cfg)
+	case "ntfy":
+		ch.sender, err = newNtfy(cfg)
+	case "gotify":
+		ch.sender, err = newGotify(cfg)
+	case "email":
+		ch.sender, err = newEmail(cfg)
+	case "":
+		err = errors.New("missing type (webhook, ntfy, gotify or email)")
+	default:
+		err = fmt.Errorf("unknown type %q (use webhook, ntfy, gotify or email)", cfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// wants reports whether the channel receives a
+func (c *Channel) wants(a Alert) bool {
+	if severityRank(a.Severity) < c.minSeverity {
+		return false
+	}
+	return len(c.events) == 0 || slices.Contains(c.events, a.Kind)
+}
+
+// Manager keeps track of firing alerts and sends every change to the channels once.
+// An alert that fires again within the cooldown of a channel is held back until
+// the cooldown ends, and only sent if it is still firing then, so a flapping
+// service does not flood anyone. Silenced alerts are held back the same way.
+type Manager struct {
+	mu       sync.Mutex
+	channels []*Channel
+	active   map[string]Alert     // key -> firing alert
+	resolved []Alert              // recently resolved alerts, oldest first
+	sent     map[string]time.Time // channel name + key -> when the last alert was sent
+	notified map[string]bool      // channel name + key -> the firing alert was sent
+
+	silences    []Silence
+	silencePath string // file the silences are kept in, empty = memory only
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		active:   make(map[string]Alert),
+		sent:     make(map[string]time.Time),
+		notified: make(map[string]bool),
+	}
+}
+
+// SetChannels replaces the channels, e.g. after a config reload.
+// Firing alerts and cooldowns of channels with the same name are kept.
+func (m *Manager) SetChannels(channels []*Channel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.channels = channels
+}
+
+// Channels returns the names of the configured channels
+func (m *Manager) Channels() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, len(m.channels))
+	for i, ch := range m.channels {
+		names[i] = ch.Name
+	}
+	return names
+}
+
+// Fire reports that the condition a.Key is present. Nothing is sent while the
+// same condition is already firing.
+func (m *Manager) Fire(a Alert) {
+	now := time.Now()
+	a.Status = StatusFiring
+	a.Time = now
+	if a.Since.IsZero() {
+		a.Since = now
+	}
+	if a.Severity == "" {
+		a.Severity = SeverityCritical
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.active[a.Key]; ok {
+		return
+	}
+	m.active[a.Key] = a
+	m.dispatch(a, now, true)
+}
+
+// dispatch sends a firing alert to every channel that wants it and did not get it yet.
+// Channels in their cooldown are skipped, Run tries again later. The alert counts
+// as sent right away so it is not sent twice; deliverFiring undoes that if the
+// delivery fails. m.mu must be held.
+func (m *Manager) dispatch(a Alert, now time.Time, first bool) {
+	if m.silencedLocked(a, now) {
+		if first {
+			log.Printf("notify: %q is silenced", a.Title)
+		}
+		return
+	}
+	for _, ch := range m.channels {
+		key := ch.Name + "\x00" + a.Key
+		if !ch.wants(a) || m.notified[key] {
+			continue
+		}
+		if last, ok := m.sent[key]; ok && now.Sub(last) < ch.cooldown {
+			if first {
+				log.Printf("notify: %q held back for %s (cooldown until %s)", a.Title, ch.Name, last.Add(ch.cooldown).Format(time.TimeOnly))
+			}
+			continue
+		}
+		prev, hadPrev := m.sent[key]
+		m.sent[key] = now
+		m.notified[key] = true
+		go m.deliverFiring(ch, a, key, prev, hadPrev)
+	}
+}
+
+// deliverFiring sends a firing alert. If that fails while the alert is still
+// firing, the channel is marked as not notified and its previous send time is
+// restored, so Run retries without a cooldown getting in the way.
+func (m *Manager) deliverFiring(ch *Channel, a Alert, key string, prev time.Time, hadPrev bool) {
+	if m.deliver(ch, a) == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur, ok := m.active[a.Key]; !ok || !cur.Since.Equal(a.Since) || !m.notified[key] {
+		return
+	}
+	delete(m.notified, key)
+	if hadPrev {
+		m.sent[key] = prev
+	} else {
+		delete(m.sent, key)
+	}
+}
+
+// pruneSentLocked drops send times whose cooldown has passed, they no longer
+// hold anything back. m.mu must be held.
+func (m *Manager) pruneSentLocked(now time.Time) {
+	cooldowns := make(map[string]time.Duration, len(m.channels))
+	for _, ch := range m.channels {
+		cooldowns[ch.Name] = ch.cooldown
+	}
+	for key, last := range m.sent {
+		name, _, _ := strings.Cut(key, "\x00")
+		cooldown, ok := cooldowns[name]
+		if !ok || now.Sub(last) >= cooldown {
+			delete(m.sent, key)
+		}
+	}
+}
+
+// Run sends alerts that were held back by a cooldown or silence or whose delivery
+// failed, and drops expired silences and cooldowns, until ctx ends
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		m.mu.Lock()
+		for _, a := range m.active {
+			a.Time = now
+			m.dispatch(a, now, false)
+		}
+		m.expireSilencesLocked(now)
+		m.pruneSentLocked(now)
+		m.mu.Unlock()
+	}
+}
+
+// Resolve reports that the condition key has cleared. Channels that got the
+// alert receive a recovery message with title and message.
+func (m *Manager) Resolve(key, title, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.active[key]
+	if !ok {
+		return
+	}
+	delete(m.active, key)
+
+	a.Status = StatusResolved
+	a.Title = title
+	a.Message = message
+	a.Time = time.Now()
+
+	m.resolved = append(m.resolved, a)
+	if n := len(m.resolved); n > maxResolved {
+		m.resolved = slices.Clone(m.resolved[n-maxResolved:])
+	}
+
+	for _, ch := range m.channels {
+		k := ch.Name + "\x00" + key
+		if !m.notified[k] {
+			continue
+		}
+		delete(m.notified, k)
+		if ch.recovery {
+			go m.deliver(ch, a)
+		}
+	}
+}
+
+// Forget drops the condition key without a recovery message, e.g. when the
+// container or service it was about was removed
+func (m *Manager) Forget(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.active, key)
+	for _, ch := range m.channels {
+		delete(m.notified, ch.Name+"\x00"+key)
+		delete(m.sent, ch.Name+"\x00"+key)
+	}
+}
+
+// Active returns the firing alerts, oldest first
+func (m *Manager) Active() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	list := make([]Alert, 0, len(m.active))
+	for _, a := range m.active {
+		a.Silenced = m.silencedLocked(a, now)
+		list = append(list, a)
+	}
+	slices.SortFunc(list, func(a, b Alert) int {
+		if c := a.Since.Compare(b.Since); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return list
+}
+
+// Resolved returns the recently resolved alerts, newest first
+func (m *Manager) Resolved() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := slices.Clone(m.resolved)
+	slices.Reverse(list)
+	if list == nil {
+		list = []Alert{}
+	}
+	return list
+}
+
+// Test sends a test alert to every channel and waits for the results.
+// The map has an entry for every channel, nil if the delivery worked.
+func (m *Manager) Test(ctx context.Context) map[string]error {
+	m.mu.Lock()
+	channels := slices.Clone(m.channels)
+	m.mu.Unlock()
+
+	now := time.Now()
+	a := Alert{
+		Key:      "test",
+		Kind:     "test",
+		Severity: SeverityInfo,
+		Status:   StatusFiring,
+		Title:    "Test alert from herbst",
+		Message:  "If you can read this, the channel works.",
+		Since:    now,
+		Time:     now,
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]error, len(channels))
+	for _, ch := range channels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+			defer cancel()
+			err := ch.sender.send(ctx, a)
+			mu.Lock()
+			results[ch.Name] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (m *Manager) deliver(ch *Channel, a Alert) error {
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	if err := ch.sender.send(ctx, a); err != nil {
+		log.Printf("notify: sending %q to %s failed: %v", a.Title, ch.Name, err)
+		return err
+	}
+	log.Printf("notify: sent %q to %s", a.Title, ch.Name)
+	return nil
+}
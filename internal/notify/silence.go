@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"herbst/internal/util"
+)
+
+// Silence mutes the alerts whose labels match all matchers between StartsAt
+// and EndsAt. Matchers are globs on labels, plus the pseudo-labels key, kind
+// and severity, e.g. {"rule": "disk-*", "node": "nas"}.
+type Silence struct {
+	ID        string            `json:"id"`
+	Matchers  map[string]string `json:"matchers"`
+	StartsAt  time.Time         `json:"startsAt"`
+	EndsAt    time.Time         `json:"endsAt"`
+	Comment   string            `json:"comment,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// Active reports whether the silence applies at t
+func (s Silence) Active(t time.Time) bool {
+	return !t.Before(s.StartsAt) && t.Before(s.EndsAt)
+}
+
+// Matches reports whether the silence applies to a, regardless of time
+func (s Silence) Matches(a Alert) bool {
+	for name, pattern := range s.Matchers {
+		var value string
+		switch name {
+		case "key":
+			value = a.Key
+		case "kind":
+			value = a.Kind
+		case "severity":
+			value = a.Severity
+		default:
+			v, ok := a.Labels[name]
+			if !ok {
+				return false
+			}
+			value = v
+		}
+		if !util.MatchGlob(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadSilences reads the silences kept at path and stores later changes there.
+// A missing file is not an error.
+func (m *Manager) LoadSilences(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.silencePath = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []Silence
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	m.silences = list
+	m.expireSilencesLocked(time.Now())
+	return nil
+}
+
+// AddSilence validates s, gives it an ID and stores it
+func (m *Manager) AddSilence(s Silence) (Silence, error) {
+	now := time.Now()
+	if len(s.Matchers) == 0 {
+		return s, errors.New("a silence needs at least one matcher")
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	if !s.EndsAt.After(s.StartsAt) || !s.EndsAt.After(now) {
+		return s, errors.New("a silence must end in the future and after it starts")
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return s, err
+	}
+	s.ID = hex.EncodeToString(id)
+	s.CreatedAt = now
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.silences = append(m.silences, s)
+	m.saveSilencesLocked()
+	return s, nil
+}
+
+// DeleteSilence removes the silence with id. Alerts it held back are sent on the next Run.
+func (m *Manager) DeleteSilence(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.silences)
+	m.silences = slices.DeleteFunc(m.silences, func(s Silence) bool { return s.ID == id })
+	if len(m.silences) == n {
+		return false
+	}
+	m.saveSilencesLocked()
+	return true
+}
+
+// Silences returns the silences that are active or start later, by end time
+func (m *Manager) Silences() []Silence {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := slices.Clone(m.silences)
+	slices.SortFunc(list, func(a, b Silence) int { return a.EndsAt.Compare(b.EndsAt) })
+	if list == nil {
+		list = []Silence{}
+	}
+	return list
+}
+
+// silencedLocked reports whether an active silence matches a, m.mu must be held
+func (m *Manager) silencedLocked(a Alert, now time.Time) bool {
+	for _, s := range m.silences {
+		if s.Active(now) && s.Matches(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// expireSilencesLocked drops silences that ended, m.mu must be held
+func (m *Manager) expireSilencesLocked(now time.Time) {
+	n := len(m.silences)
+	m.silences = slices.DeleteFunc(m.silences, func(s Silence) bool { return !now.Before(s.EndsAt) })
+	if len(m.silences) != n {
+		m.saveSilencesLocked()
+	}
+}
+
+// saveSilencesLocked atomically writes the silences file, m.mu must be held
+func (m *Manager) saveSilencesLocked() {
+	if m.silencePath == "" {
+		return
+	}
+	if err := writeSilences(m.silencePath, m.silences); err != nil {
+		log.Printf("notify: failed to save silences: %v", err)
+	}
+}
+
+func writeSilences(path string, list []Silence) error {
+	if list == nil {
+		list = []Silence{}
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,391 @@
+// internal/pki/ca.go
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"herbst/internal/util"
+)
+
+const (
+	caCertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+	indexFile  = "issued.json"
+
+	caValidity     = 10 * 365 * 24 * time.Hour
+	serverValidity = 365 * 24 * time.Hour
+
+	// DefaultClientValidity is the lifetime of agent certificates
+	DefaultClientValidity = 2 * 365 * 24 * time.Hour
+)
+
+var (
+	// ErrRevoked is returned for certificates that were revoked
+	ErrRevoked = errors.New("certificate revoked")
+	// ErrUnknownCertificate is returned for certificates this CA has no record of
+	ErrUnknownCertificate = errors.New("certificate not issued by this herbst instance")
+)
+
+// IssuedCert is the record of a client certificate issued to an agent
+type IssuedCert struct {
+	Serial    string     `json:"serial"`
+	Name      string     `json:"name"` // agent node name (certificate CN)
+	NotBefore time.Time  `json:"notBefore"`
+	NotAfter  time.Time  `json:"notAfter"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// CA is a small certificate authority for agent client certificates.
+// Everything lives in one directory: the CA key pair and a JSON index of
+// issued certificates, which also records revocations.
+type CA struct {
+	dir     string
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	index    []IssuedCert
+	indexMod time.Time // mtime of the index file when it was last read
+}
+
+// LoadOrCreateCA loads the CA from dir, creating a new one on first use
+func LoadOrCreateCA(dir string) (*CA, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	ca := &CA{dir: dir}
+	certPath := filepath.Join(dir, caCertFile)
+	keyPath := filepath.Join(dir, caKeyFile)
+
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		if err := ca.create(certPath, keyPath); err != nil {
+			return nil, fmt.Errorf("create CA: %w", err)
+		}
+	}
+
+	if err := ca.load(certPath, keyPath); err != nil {
+		return nil, fmt.Errorf("load CA: %w", err)
+	}
+	return ca, nil
+}
+
+func (ca *CA) create(certPath, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "herbst agent CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+}
+
+func (ca *CA) load(certPath, keyPath string) error {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return fmt.Errorf("%s: no PEM certificate", certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return fmt.Errorf("%s: no PEM key", keyPath)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	ca.cert = cert
+	ca.certPEM = certPEM
+	ca.key = key
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.loadIndex()
+}
+
+// CertPEM returns the CA certificate agents pin to verify herbst
+func (ca *CA) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// Pool returns a cert pool containing only this CA
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// Issue creates a client certificate and key for the agent name.
+// The name becomes the certificate CN, which herbst uses as node identity.
+func (ca *CA) Issue(name string, validity time.Duration) (certPEM, keyPEM []byte, rec IssuedCert, err error) {
+	if name == "" {
+		return nil, nil, rec, errors.New("agent name is required")
+	}
+	if validity <= 0 {
+		validity = DefaultClientValidity
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, rec, err
+	}
+
+	der, serial, err := ca.sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &key.PublicKey, validity)
+	if err != nil {
+		return nil, nil, rec, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, rec, err
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	rec = IssuedCert{
+		Serial:    serial,
+		Name:      name,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if err := ca.loadIndex(); err != nil {
+		return nil, nil, rec, err
+	}
+	ca.index = append(ca.index, rec)
+	if err := ca.saveIndex(); err != nil {
+		return nil, nil, rec, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		rec, nil
+}
+
+// ServerCertificate issues a TLS server certificate for the agent listener.
+// It is not persisted; agents trust it through the pinned CA.
+func (ca *CA) ServerCertificate(names []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "herbst"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, n := range append(names, "localhost") {
+		if ip := net.ParseIP(n); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if n != "" {
+			tmpl.DNSNames = append(tmpl.DNSNames, n)
+		}
+	}
+	tmpl.IPAddresses = append(tmpl.IPAddresses, net.IPv4(127, 0, 0, 1), net.IPv6loopback)
+
+	der, _, err := ca.sign(tmpl, &key.PublicKey, serverValidity)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+	}, nil
+}
+
+func (ca *CA) sign(tmpl *x509.Certificate, pub *ecdsa.PublicKey, validity time.Duration) ([]byte, string, error) {
+	serial, err := newSerial()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore = now.Add(-time.Hour) // tolerate some clock skew
+	tmpl.NotAfter = now.Add(validity)
+	if tmpl.NotAfter.After(ca.cert.NotAfter) {
+		tmpl.NotAfter = ca.cert.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, pub, ca.key)
+	if err != nil {
+		return nil, "", err
+	}
+	return der, serial.Text(16), nil
+}
+
+// Revoke marks a certificate as revoked. Connections using it are refused from now on.
+func (ca *CA) Revoke(serial string) (IssuedCert, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if err := ca.loadIndex(); err != nil {
+		return IssuedCert{}, err
+	}
+
+	for i := range ca.index {
+		if ca.index[i].Serial != serial {
+			continue
+		}
+		if ca.index[i].RevokedAt == nil {
+			now := time.Now()
+			ca.index[i].RevokedAt = &now
+			if err := ca.saveIndex(); err != nil {
+				return IssuedCert{}, err
+			}
+		}
+		return ca.index[i], nil
+	}
+	return IssuedCert{}, ErrUnknownCertificate
+}
+
+// List returns all issued certificates, newest first
+func (ca *CA) List() ([]IssuedCert, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if err := ca.loadIndex(); err != nil {
+		return nil, err
+	}
+
+	out := make([]IssuedCert, len(ca.index))
+	copy(out, ca.index)
+	sort.Slice(out, func(i, j int) bool { return out[i].NotBefore.After(out[j].NotBefore) })
+	return out, nil
+}
+
+// Check verifies that a client certificate (already validated against Pool by
+// the TLS handshake) was issued by this CA and has not been revoked
+func (ca *CA) Check(cert *x509.Certificate) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	// Revocations may have been made by the CLI in another process
+	if err := ca.loadIndex(); err != nil {
+		return err
+	}
+
+	serial := cert.SerialNumber.Text(16)
+	for _, rec := range ca.index {
+		if rec.Serial == serial {
+			if rec.RevokedAt != nil {
+				return ErrRevoked
+			}
+			return nil
+		}
+	}
+	return ErrUnknownCertificate
+}
+
+// loadIndex re-reads the index file if it changed on disk. ca.mu must be held.
+func (ca *CA) loadIndex() error {
+	path := filepath.Join(ca.dir, indexFile)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		ca.index = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(ca.indexMod) && ca.index != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var index []IssuedCert
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	ca.index = index
+	ca.indexMod = info.ModTime()
+	return nil
+}
+
+// saveIndex writes the index file. ca.mu must be held.
+func (ca *CA) saveIndex() error {
+	data, err := json.MarshalIndent(ca.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(ca.dir, indexFile)
+	if err := util.WriteFileAtomic(path, data, 0o600); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		ca.indexMod = info.ModTime()
+	}
+	return nil
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,109 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+)
+
+func parseCert(t *testing.T, certPEM []byte) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatal("no PEM block")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestRevokeAndCheck(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(name string) (*x509.Certificate, IssuedCert) {
+		certPEM, _, rec, err := ca.Issue(name, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parseCert(t, certPEM), rec
+	}
+	valid, _ := issue("nas")
+	revoked, revokedRec := issue("pi")
+	// Revoked through a second instance, like the CLI in another process
+	otherCert, otherRec := issue("nuc")
+
+	if _, err := ca.Revoke(revokedRec.Serial); err != nil {
+		t.Fatal(err)
+	}
+	cli, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.Revoke(otherRec.Serial); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := ca.ServerCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := x509.ParseCertificate(server.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want error
+	}{
+		{"valid", valid, nil},
+		{"revoked", revoked, ErrRevoked},
+		{"revoked by another process", otherCert, ErrRevoked},
+		{"not in the index", unknown, ErrUnknownCertificate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ca.Check(tt.cert); !errors.Is(err, tt.want) {
+				t.Errorf("Check() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ca, err := LoadOrCreateCA(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, rec, err := ca.Issue("nas", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := ca.Revoke(rec.Serial)
+	if err != nil || first.RevokedAt == nil {
+		t.Fatalf("Revoke() = %+v, %v", first, err)
+	}
+	// Revoking again keeps the original time
+	again, err := ca.Revoke(rec.Serial)
+	if err != nil || !again.RevokedAt.Equal(*first.RevokedAt) {
+		t.Errorf("second Revoke() = %+v, %v, want revoked at %s", again, err, first.RevokedAt)
+	}
+	if _, err := ca.Revoke("deadbeef"); !errors.Is(err, ErrUnknownCertificate) {
+		t.Errorf("Revoke(unknown) = %v, want %v", err, ErrUnknownCertificate)
+	}
+
+	list, err := ca.List()
+	if err != nil || len(list) != 1 || list[0].RevokedAt == nil {
+		t.Errorf("List() = %+v, %v, want one revoked certificate", list, err)
+	}
+}
@@ -1,24 +1,234 @@
 // internal/proto/proto.go
 package proto
 
+// ProtocolVersion is the newest agent protocol version this build speaks.
+//
+//	1: hello + containers snapshots (agents without a version field)
+//	2: welcome/reject handshake, commands, log streaming, container deltas
+const ProtocolVersion = 2
+
+// MinProtocolVersion is the oldest agent protocol version still accepted
+const MinProtocolVersion = 1
+
+// Capabilities an agent can offer in its hello message
+const (
+	CapCommands        = "commands"         // container actions and logs via CommandMessage
+	CapLogsFollow      = "logs-follow"      // followed log streams via LogsMessage
+	CapContainersDelta = "containers-delta" // ContainersDeltaMessage after the first snapshot
+	CapContainerStats  = "container-stats"  // Container.Stats is filled in
+	CapMetrics         = "metrics"          // host metrics via MetricsMessage
+)
+
 type HelloMessage struct {
-	Type     string `json:"type"` // "hello"
-	NodeName string `json:"nodeName"`
-	Token    string `json:"token"`
-	Kind     string `json:"kind"` // z.B. "docker"
+	Type         string   `json:"type"` // "hello"
+	NodeName     string   `json:"nodeName"`
+	Token        string   `json:"token"`
+	Kind         string   `json:"kind"`                   // z.B. "docker"
+	Version      int      `json:"version,omitempty"`      // highest protocol version of the agent (0 = 1)
+	MinVersion   int      `json:"minVersion,omitempty"`   // lowest protocol version the agent accepts
+	Capabilities []string `json:"capabilities,omitempty"` // features the agent offers
+	AgentVersion string   `json:"agentVersion,omitempty"` // build version, informational
+}
+
+// WelcomeMessage is the server's answer to an accepted hello (protocol 2+)
+type WelcomeMessage struct {
+	Type          string   `json:"type"`          // "welcome"
+	Version       int      `json:"version"`       // negotiated protocol version
+	Capabilities  []string `json:"capabilities"`  // accepted subset of the agent's capabilities
+	ServerVersion string   `json:"serverVersion"` // herbst build version, informational
+}
+
+// RejectMessage is sent before the server closes a connection it cannot accept
+type RejectMessage struct {
+	Type       string `json:"type"` // "reject"
+	Reason     string `json:"reason"`
+	MinVersion int    `json:"minVersion"` // protocol versions the server supports
+	MaxVersion int    `json:"maxVersion"`
+}
+
+// NegotiateVersion picks the highest protocol version both sides support.
+// ok is false if the ranges [agentMin, agentMax] and [MinProtocolVersion, ProtocolVersion] do not overlap.
+func NegotiateVersion(agentMin, agentMax int) (version int, ok bool) {
+	if agentMax <= 0 {
+		agentMax = 1 // agents from before versioning
+	}
+	if agentMin <= 0 {
+		agentMin = 1
+	}
+
+	version = min(agentMax, ProtocolVersion)
+	return version, version >= max(agentMin, MinProtocolVersion)
 }
 
 type Container struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Image   string `json:"image"`
-	State   string `json:"state"`
-	Status  string `json:"status"`
-	Created int64  `json:"created"`
+	ID      string          `json:"id"`
+	Name    string          `json:"name"`
+	Image   string          `json:"image"`
+	State   string          `json:"state"`
+	Status  string          `json:"status"`
+	Created int64           `json:"created"`
+	Stats   *ContainerStats `json:"stats,omitempty"` // only set for running containers
+}
+
+// ContainerStats holds resource usage of a running container
+type ContainerStats struct {
+	CPUPercent    float64 `json:"cpuPercent"`    // 100% = one full core
+	MemoryUsage   uint64  `json:"memoryUsage"`   // bytes, without page cache
+	MemoryLimit   uint64  `json:"memoryLimit"`   // bytes
+	MemoryPercent float64 `json:"memoryPercent"` // usage / limit
+	NetRx         uint64  `json:"netRx"`         // bytes received on all interfaces
+	NetTx         uint64  `json:"netTx"`         // bytes sent on all interfaces
+	BlockRead     uint64  `json:"blockRead"`     // bytes
+	BlockWrite    uint64  `json:"blockWrite"`    // bytes
 }
 
+// ContainersMessage is a full snapshot of all containers on a node
 type ContainersMessage struct {
 	Type       string      `json:"type"` // "containers"
 	NodeName   string      `json:"nodeName"`
+	Seq        uint64      `json:"seq,omitempty"` // sequence number in delta mode
 	Containers []Container `json:"containers"`
 }
+
+// ContainersDeltaMessage carries the changes since the previous message.
+// Seq must be exactly one higher than the last snapshot or delta, otherwise
+// herbst answers with a ResyncMessage and the agent sends a new snapshot.
+type ContainersDeltaMessage struct {
+	Type     string      `json:"type"` // "containers_delta"
+	NodeName string      `json:"nodeName"`
+	Seq      uint64      `json:"seq"`
+	Added    []Container `json:"added,omitempty"`
+	Changed  []Container `json:"changed,omitempty"`
+	Removed  []string    `json:"removed,omitempty"` // container IDs
+}
+
+// ResyncMessage asks an agent to send a full ContainersMessage snapshot
+type ResyncMessage struct {
+	Type string `json:"type"` // "resync"
+}
+
+// ContainerState is the inspected state of a single container
+type ContainerState struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	Running    bool   `json:"running"`
+	Paused     bool   `json:"paused"`
+	Restarting bool   `json:"restarting"`
+	ExitCode   int    `json:"exitCode"`
+	StartedAt  string `json:"startedAt"`
+	FinishedAt string `json:"finishedAt"`
+}
+
+// CommandMessage is sent from herbst to an agent to run an action.
+// The agent answers with a ResultMessage carrying the same ID.
+type CommandMessage struct {
+	Type        string `json:"type"`   // "command"
+	ID          string `json:"id"`     // correlation ID
+	Action      string `json:"action"` // start, stop, restart, pause, unpause, logs
+	ContainerID string `json:"containerId"`
+	Tail        int    `json:"tail,omitempty"`   // logs: number of lines from the end (0 = all)
+	Since       int64  `json:"since,omitempty"`  // logs: unix timestamp, only newer lines
+	Follow      bool   `json:"follow,omitempty"` // logs: stream LogsMessages until cancelled
+}
+
+// CancelMessage stops a running command (e.g. a followed log stream)
+type CancelMessage struct {
+	Type string `json:"type"` // "cancel"
+	ID   string `json:"id"`   // correlation ID of the command
+}
+
+// LogLine is a single line of container output
+type LogLine struct {
+	Stream string `json:"stream"` // "stdout" or "stderr"
+	Line   string `json:"line"`
+}
+
+// LogsMessage carries a batch of log lines for a followed logs command
+type LogsMessage struct {
+	Type  string    `json:"type"` // "logs"
+	ID    string    `json:"id"`   // correlation ID of the command
+	Lines []LogLine `json:"lines"`
+}
+
+type ResultMessage struct {
+	Type      string          `json:"type"` // "result"
+	ID        string          `json:"id"`   // correlation ID of the command
+	OK        bool            `json:"ok"`
+	Error     string          `json:"error,omitempty"`
+	Container *ContainerState `json:"container,omitempty"` // state after a container action
+	Logs      string          `json:"logs,omitempty"`      // logs output
+}
+
+// HostMetrics describes the machine a node runs on. The JSON shape is the
+// same as /api/system/stats, so the UI renders local and agent hosts alike.
+type HostMetrics struct {
+	CPU          CPUMetrics          `json:"cpu"`
+	Memory       MemoryMetrics       `json:"memory"`
+	Swap         MemoryMetrics       `json:"swap"`
+	Disk         DiskMetrics         `json:"disk"`  // first entry of Disks, kept for older clients
+	Disks        []DiskMetrics       `json:"disks"` // all monitored mount points
+	Network      []NetworkMetrics    `json:"network"`
+	Temperatures []TemperatureMetric `json:"temperatures"`
+	Load         LoadMetrics         `json:"load"`
+	Host         HostInfo            `json:"host"`
+}
+
+type CPUMetrics struct {
+	Percent float64 `json:"percent"`
+	Model   string  `json:"model"`
+	Cores   int     `json:"cores"`
+	Threads int     `json:"threads"`
+}
+
+type MemoryMetrics struct {
+	Total   uint64  `json:"total"`
+	Used    uint64  `json:"used"`
+	Percent float64 `json:"percent"`
+}
+
+type DiskMetrics struct {
+	Path    string  `json:"path"`
+	Device  string  `json:"device,omitempty"`
+	Fstype  string  `json:"fstype,omitempty"`
+	Total   uint64  `json:"total"`
+	Used    uint64  `json:"used"`
+	Percent float64 `json:"percent"`
+}
+
+// NetworkMetrics holds the counters and current throughput of one interface
+type NetworkMetrics struct {
+	Interface string  `json:"interface"`
+	RxBytes   uint64  `json:"rxBytes"` // total since boot
+	TxBytes   uint64  `json:"txBytes"`
+	RxRate    float64 `json:"rxRate"` // bytes per second
+	TxRate    float64 `json:"txRate"`
+}
+
+// TemperatureMetric is a single hardware sensor reading in °C
+type TemperatureMetric struct {
+	Sensor   string  `json:"sensor"`
+	Celsius  float64 `json:"celsius"`
+	High     float64 `json:"high,omitempty"`
+	Critical float64 `json:"critical,omitempty"`
+}
+
+type LoadMetrics struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+type HostInfo struct {
+	Hostname string `json:"hostname"`
+	Uptime   uint64 `json:"uptime"` // seconds
+	OS       string `json:"os"`
+	Platform string `json:"platform"`
+}
+
+// MetricsMessage reports the agent host's metrics, sent periodically
+type MetricsMessage struct {
+	Type     string      `json:"type"` // "metrics"
+	NodeName string      `json:"nodeName"`
+	Metrics  HostMetrics `json:"metrics"`
+}
@@ -0,0 +1,131 @@
+package revisions
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Context is the number of unchanged lines around the changes in a diff
+const Context = 3
+
+// op is one line of an edit script
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+	a, b int // 0-based line numbers in a and b before this line
+}
+
+// Diff returns the changes from a to b in the unified format of diff -u, with
+// nameA and nameB in the header, or "" if they are equal
+func Diff(nameA, nameB string, a, b []byte) string {
+	la, lb := splitLines(string(a)), splitLines(string(b))
+	ops := editScript(la, lb)
+
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change and the end of its hunk
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		from := max(first-Context, start)
+		last, equal := first, 0
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				last, equal = i, 0
+				continue
+			}
+			equal++
+			if equal > 2*Context {
+				break
+			}
+		}
+		to := min(last+Context+1, len(ops))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		writeHunk(&out, ops[from:to])
+		start = to
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []op) {
+	var countA, countB int
+	for _, o := range ops {
+		if o.kind != '+' {
+			countA++
+		}
+		if o.kind != '-' {
+			countB++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(ops[0].a, countA), hunkRange(ops[0].b, countB))
+	for _, o := range ops {
+		out.WriteByte(o.kind)
+		out.WriteString(o.line)
+		out.WriteByte('\n')
+	}
+}
+
+// hunkRange formats the start and length of a hunk like diff does: an empty
+// range starts at the line before it
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// editScript turns a into b with the fewest deleted and inserted lines, by
+// the longest common subsequence. Config files are small enough for the
+// quadratic table.
+func editScript(a, b []string) []op {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j], i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+// splitLines splits s into lines without their line breaks
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
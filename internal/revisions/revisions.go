@@ -0,0 +1,248 @@
+// Package revisions keeps every saved version of the config files, so
+// changes can be compared and rolled back
+package revisions
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"herbst/internal/util"
+)
+
+const indexFilename = "index.jsonl"
+
+// Keep is how many revisions of each file are kept, older ones are deleted
+const Keep = 100
+
+// ErrNotFound is returned for unknown revision IDs
+var ErrNotFound = errors.New("revision not found")
+
+// Revision is one saved version of a file
+type Revision struct {
+	ID      int       `json:"id"`
+	File    string    `json:"file"` // base name, e.g. "config.toml"
+	Time    time.Time `json:"time"`
+	Author  string    `json:"author"`
+	Message string    `json:"message,omitempty"` // e.g. "restored revision 4"
+	Size    int       `json:"size"`
+	SHA256  string    `json:"sha256"`
+}
+
+// Store keeps the content of every revision in a directory, one file per
+// revision, and their metadata in an append-only index with one JSON
+// revision per line
+type Store struct {
+	dir string
+
+	mu   sync.Mutex
+	list []Revision // oldest first
+}
+
+// Open loads the revisions stored in dir, creating it if needed. Revisions
+// hold the secrets of the config, so only the owner may read them.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	// Directories created by older versions were readable by everyone
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir}
+
+	f, err := os.Open(filepath.Join(dir, indexFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rev Revision
+		if err := json.Unmarshal(sc.Bytes(), &rev); err != nil || rev.ID == 0 || rev.File == "" {
+			continue
+		}
+		s.list = append(s.list, rev)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(s.list, func(a, b Revision) int { return a.ID - b.ID })
+	return s, nil
+}
+
+// Dir returns the directory the revisions are stored in
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Record stores data as the newest revision of file. Nothing is stored if it
+// equals the newest revision of file; that one is returned with false.
+func (s *Store) Record(file string, data []byte, author, message string) (Revision, bool, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if latest, ok := s.latestLocked(file); ok && latest.SHA256 == hash {
+		return latest, false, nil
+	}
+
+	rev := Revision{
+		ID:      1,
+		File:    file,
+		Time:    time.Now().UTC().Truncate(time.Millisecond),
+		Author:  author,
+		Message: message,
+		Size:    len(data),
+		SHA256:  hash,
+	}
+	if n := len(s.list); n > 0 {
+		rev.ID = s.list[n-1].ID + 1
+	}
+
+	// The content first, an index entry must never point at a missing file
+	if err := util.WriteFileAtomic(s.path(rev), data, 0o600); err != nil {
+		return Revision{}, false, err
+	}
+	line, err := json.Marshal(rev)
+	if err != nil {
+		return Revision{}, false, err
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, indexFilename), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return Revision{}, false, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return Revision{}, false, err
+	}
+	if err := f.Close(); err != nil {
+		return Revision{}, false, err
+	}
+
+	s.list = append(s.list, rev)
+	if err := s.pruneLocked(file); err != nil {
+		// The new revision is stored, old ones are tried again on the next save
+		log.Printf("revisions: failed to delete old revisions of %s: %v", file, err)
+	}
+	return rev, true, nil
+}
+
+// pruneLocked deletes the oldest revisions of file beyond Keep. The index is
+// rewritten before the contents are deleted, so it never points at a missing file.
+func (s *Store) pruneLocked(file string) error {
+	count := 0
+	for _, rev := range s.list {
+		if rev.File == file {
+			count++
+		}
+	}
+	if count <= Keep {
+		return nil
+	}
+
+	var kept, dropped []Revision
+	for _, rev := range s.list {
+		if rev.File == file && count > Keep {
+			dropped = append(dropped, rev)
+			count--
+			continue
+		}
+		kept = append(kept, rev)
+	}
+
+	var index []byte
+	for _, rev := range kept {
+		line, err := json.Marshal(rev)
+		if err != nil {
+			return err
+		}
+		index = append(append(index, line...), '\n')
+	}
+	if err := util.WriteFileAtomic(filepath.Join(s.dir, indexFilename), index, 0o600); err != nil {
+		return err
+	}
+	s.list = kept
+
+	for _, rev := range dropped {
+		if err := os.Remove(s.path(rev)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the revisions of file, or of all files if file is empty, newest first
+func (s *Store) List(file string) []Revision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []Revision{}
+	for i := len(s.list) - 1; i >= 0; i-- {
+		if file == "" || s.list[i].File == file {
+			list = append(list, s.list[i])
+		}
+	}
+	return list
+}
+
+// Get returns revision id
+func (s *Store) Get(id int) (Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := slices.BinarySearchFunc(s.list, id, func(rev Revision, id int) int { return rev.ID - id })
+	if !ok {
+		return Revision{}, ErrNotFound
+	}
+	return s.list[i], nil
+}
+
+// Read returns revision id and its content
+func (s *Store) Read(id int) (Revision, []byte, error) {
+	rev, err := s.Get(id)
+	if err != nil {
+		return Revision{}, nil, err
+	}
+	data, err := os.ReadFile(s.path(rev))
+	if err != nil {
+		return Revision{}, nil, err
+	}
+	return rev, data, nil
+}
+
+// Latest returns the newest revision of file
+func (s *Store) Latest(file string) (Revision, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latestLocked(file)
+}
+
+func (s *Store) latestLocked(file string) (Revision, bool) {
+	for i := len(s.list) - 1; i >= 0; i-- {
+		if s.list[i].File == file {
+			return s.list[i], true
+		}
+	}
+	return Revision{}, false
+}
+
+// path is where the content of rev is stored, e.g. "12-config.toml"
+func (s *Store) path(rev Revision) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d-%s", rev.ID, rev.File))
+}
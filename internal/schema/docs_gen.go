@@ -0,0 +1,127 @@
+// Code generated by gen.go from the comments of the config and themes types; DO NOT EDIT.
+
+package schema
+
+// typeDocs describe the types, by package and type name
+var typeDocs = map[string]string{
+	"config.API":               "API holds settings for the HTTP API",
+	"config.AlertRule":         "AlertRule is a threshold on a metric or state ([[alert]])",
+	"config.Background":        "Background holds background-related configuration",
+	"config.Clock":             "Clock holds clock display configuration",
+	"config.Config":            "Config is the main configuration structure",
+	"config.Docker":            "Docker holds all Docker integration configuration",
+	"config.DockerAgentConfig": "DockerAgentConfig represents a remote docker agent node",
+	"config.DockerLocal":       "DockerLocal holds local Docker integration configuration",
+	"config.DockerMTLS":        "DockerMTLS configures the mutual TLS listener for remote agents",
+	"config.Health":            "Health holds settings for the background service checks",
+	"config.Notify":            "Notify is a channel that alerts are sent to ([[notify]])",
+	"config.Service":           "Service represents a dashboard service entry",
+	"config.ServiceCheck":      "ServiceCheck configures how a service with online-badge is checked ([section.service.check])",
+	"config.ServiceSection":    "ServiceSection represents a group of services with a title",
+	"config.Storage":           "Storage holds settings for the on-disk history (metrics, health checks)",
+	"config.System":            "System holds system monitoring configuration",
+	"config.UI":                "UI holds UI-related configuration",
+	"config.Weather":           "Weather holds weather-related configuration",
+	"themes.Theme":             "Theme represents a single theme configuration",
+	"themes.ThemeFile":         "ThemeFile holds all themes",
+}
+
+// fieldDocs describe the fields, by package, type and field name
+var fieldDocs = map[string]string{
+	"config.API.Token":                 "Bearer token for write endpoints (container actions); empty disables them",
+	"config.API.TrustedProxies":        "Reverse proxies (addresses or CIDRs) whose X-Forwarded-For and Remote-User headers are used",
+	"config.AlertRule.Above":           "Fires while the value is above this",
+	"config.AlertRule.Below":           "Fires while the value is below this",
+	"config.AlertRule.Container":       "Container name, * wildcards (default: all)",
+	"config.AlertRule.For":             "How long the condition must hold before the alert fires (default: right away)",
+	"config.AlertRule.Metric":          "Host metric (cpu, memory, swap, load1, disk:<path>, net:<iface>:rx|tx, temp:<sensor>, * wildcards) or agent-connected, container-running, container-restarts, container-cpu, container-memory, service-up, service-latency, service-tls-days",
+	"config.AlertRule.Node":            "Node name (\"local\" or an agent), * wildcards (default: all)",
+	"config.AlertRule.Service":         "Service id, * wildcards (default: all)",
+	"config.AlertRule.Severity":        "info, warning (default) or critical",
+	"config.AlertRule.Window":          "Time range of container-restarts (default: \"1h\")",
+	"config.Clock.DateFormat":          "\"short\" (3. Dez 2025) or \"numeric\" (03.12.2025)",
+	"config.Clock.TimeFormat":          "\"24h\" or \"12h\"",
+	"config.Config.Alerts":             "[[alert]]",
+	"config.Config.Notify":             "[[notify]], not sent to the browser (tokens, passwords)",
+	"config.Config.Sections":           "Grouped services",
+	"config.Config.Services":           "Flat services (legacy)",
+	"config.Config.Theme":              "Key or name of a theme in themes.toml",
+	"config.Docker.AgentProtocol":      "ws or wss (default: ws)",
+	"config.Docker.Agents":             "[[docker.agent]]",
+	"config.Docker.Host":               "External host URL for agents (e.g. \"192.168.1.100:8080\")",
+	"config.Docker.Local":              "[docker.local]",
+	"config.Docker.MTLS":               "[docker.mtls]",
+	"config.DockerLocal.Enabled":       "Default: on if the socket exists",
+	"config.DockerMTLS.Listen":         "Address of the TLS listener (default: \":8443\")",
+	"config.DockerMTLS.Require":        "Refuse token-only agents on the plain listener",
+	"config.DockerMTLS.ServerNames":    "DNS names / IPs agents use to reach herbst",
+	"config.Health.AllowCIDRs":         "Networks checks may connect to (default: any)",
+	"config.Health.DenyCIDRs":          "Networks checks must not connect to, wins over allow-cidrs",
+	"config.Health.Interval":           "How often each service with online-badge is checked (default: \"30s\")",
+	"config.Health.MaxConcurrent":      "Checks running at the same time (default: 10)",
+	"config.Health.MaxRedirects":       "Redirects followed by HTTP checks (default: 5, 0 = none)",
+	"config.Health.Schemes":            "URL schemes HTTP checks may use (default: [\"http\", \"https\"])",
+	"config.Health.TLSCA":              "PEM file with extra CAs for certificate checks, relative to the config directory",
+	"config.Health.TLSExpiryWarning":   "Flag certificates expiring within this (default: \"14d\")",
+	"config.Health.Timeout":            "Timeout of a single check (default: \"5s\")",
+	"config.Notify.Body":               "Webhook body as Go template (default: the alert as JSON)",
+	"config.Notify.Cooldown":           "Minimum time between two alerts for the same thing (default: \"10m\")",
+	"config.Notify.Events":             "agent, container, service and/or host (default: all)",
+	"config.Notify.Headers":            "Extra HTTP request headers",
+	"config.Notify.Method":             "Webhook HTTP method (default: POST)",
+	"config.Notify.MinSeverity":        "info, warning or critical (default: info = everything)",
+	"config.Notify.Name":               "Shown in logs (default: the type)",
+	"config.Notify.Priority":           "ntfy (1-5) or Gotify (0-10) priority of alerts",
+	"config.Notify.Recovery":           "Send a message when the condition clears (default: true)",
+	"config.Notify.SMTPPort":           "Default: 587 (465 with tls = \"tls\")",
+	"config.Notify.TLS":                "starttls (default), tls or none",
+	"config.Notify.Token":              "ntfy access token or Gotify app token",
+	"config.Notify.Type":               "webhook, ntfy, gotify or email",
+	"config.Notify.URL":                "Webhook URL, ntfy topic URL or Gotify server URL",
+	"config.Service.Check":             "Not sent to the browser, headers may contain secrets",
+	"config.Service.ID":                "Stable identifier, derived from section and name if empty",
+	"config.ServiceCheck.BodyContains": "Text the response body must contain",
+	"config.ServiceCheck.BodyRegex":    "Regular expression the response body must match",
+	"config.ServiceCheck.Expect":       "Addresses the DNS name must resolve to",
+	"config.ServiceCheck.Headers":      "Extra HTTP request headers",
+	"config.ServiceCheck.Method":       "HTTP method (default: HEAD with GET fallback, GET when the body is checked)",
+	"config.ServiceCheck.Server":       "DNS server to ask (default: system resolver)",
+	"config.ServiceCheck.Status":       "Expected HTTP status codes, e.g. [\"200-299\", \"401\"] (default: anything below 500)",
+	"config.ServiceCheck.Target":       "URL (http), host:port (tcp) or host name (dns, icmp), default: taken from the service url",
+	"config.ServiceCheck.Timeout":      "Overrides [health] timeout",
+	"config.ServiceCheck.Type":         "http (default), tcp, dns or icmp",
+	"config.Storage.CompactInterval":   "How often expired samples are removed (default: \"1h\")",
+	"config.Storage.DownsampleAfter":   "Older samples are merged into hourly ones (default: \"7d\", \"0\" = never)",
+	"config.Storage.Path":              "Relative to the config directory (default: \"history.log\")",
+	"config.Storage.Retention":         "How long samples are kept, e.g. \"30d\" (default), \"0\" = forever",
+	"config.System.DiskPath":           "Which disk/partition to monitor (default: \"/\" or \"C:\")",
+	"config.System.Disks":              "Several mount points, or [\"all\"] for all real filesystems (overrides disk-path)",
+	"config.System.Interfaces":         "Network interfaces to show (default: all except loopback/virtual)",
+	"config.Weather.Location":          "City name, \"zip:CODE,COUNTRY\", or empty for lat/lon",
+	"config.Weather.Units":             "metric (°C), imperial (°F) or standard (K)",
+}
+
+// fieldDefaults are the defaults the field comments mention, as JSON
+var fieldDefaults = map[string]string{
+	"config.AlertRule.Severity":      "\"warning\"",
+	"config.AlertRule.Window":        "\"1h\"",
+	"config.Docker.AgentProtocol":    "\"ws\"",
+	"config.DockerMTLS.Listen":       "\":8443\"",
+	"config.Health.Interval":         "\"30s\"",
+	"config.Health.MaxConcurrent":    "10",
+	"config.Health.MaxRedirects":     "5",
+	"config.Health.Schemes":          "[\"http\",\"https\"]",
+	"config.Health.TLSExpiryWarning": "\"14d\"",
+	"config.Health.Timeout":          "\"5s\"",
+	"config.Notify.Cooldown":         "\"10m\"",
+	"config.Notify.MinSeverity":      "\"info\"",
+	"config.Notify.Recovery":         "true",
+	"config.Notify.SMTPPort":         "587",
+	"config.Notify.TLS":              "\"starttls\"",
+	"config.ServiceCheck.Type":       "\"http\"",
+	"config.Storage.CompactInterval": "\"1h\"",
+	"config.Storage.DownsampleAfter": "\"7d\"",
+	"config.Storage.Path":            "\"history.log\"",
+	"config.Storage.Retention":       "\"30d\"",
+	"config.System.DiskPath":         "\"/\"",
+}
@@ -0,0 +1,247 @@
+//go:build ignore
+
+// gen reads the doc comments of the config and themes types and writes them,
+// with the defaults they mention, to docs_gen.go. go generate runs it.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"herbst/internal/config"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+var sources = map[string]string{
+	"config": "../config/config.go",
+	"themes": "../themes/themes.go",
+}
+
+// markedRe finds defaults written as `"30d" (default)` or `warning (default)`
+var markedRe = regexp.MustCompile(`("[^"]*"|[\w.:/-]+) \(default\)`)
+
+func main() {
+	typeDocs := make(map[string]string)
+	fieldDocs := make(map[string]string)
+	defaults := make(map[string]string)
+
+	for pkg, path := range sources {
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ParseComments)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				typeKey := pkg + "." + ts.Name.Name
+				if doc := commentText(gd.Doc); doc != "" {
+					typeDocs[typeKey] = doc
+				}
+				for _, f := range st.Fields.List {
+					if len(f.Names) == 0 || f.Tag == nil {
+						continue
+					}
+					tag, _ := strconv.Unquote(f.Tag.Value)
+					key, _, _ := strings.Cut(reflect.StructTag(tag).Get("toml"), ",")
+					// Only trailing comments, the ones above a field head a group
+					doc := commentText(f.Comment)
+					if key == "" || key == "-" || doc == "" {
+						continue
+					}
+					fieldKey := typeKey + "." + f.Names[0].Name
+					fieldDocs[fieldKey] = doc
+					choices := config.Choices[ts.Name.Name+"."+key]
+					if def, ok := findDefault(doc, f.Type, choices); ok {
+						defaults[fieldKey] = def
+					}
+				}
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by gen.go from the comments of the config and themes types; DO NOT EDIT.\n\n")
+	b.WriteString("package schema\n\n")
+	writeMap(&b, "typeDocs", "typeDocs describe the types, by package and type name", typeDocs)
+	writeMap(&b, "fieldDocs", "fieldDocs describe the fields, by package, type and field name", fieldDocs)
+	writeMap(&b, "fieldDefaults", "fieldDefaults are the defaults the field comments mention, as JSON", defaults)
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("docs_gen.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func commentText(g *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(g.Text()), " ")
+}
+
+func writeMap(b *bytes.Buffer, name, doc string, m map[string]string) {
+	fmt.Fprintf(b, "// %s\nvar %s = map[string]string{\n", doc, name)
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, "\t%q: %q,\n", k, m[k])
+	}
+	b.WriteString("}\n\n")
+}
+
+// findDefault returns the default a comment mentions, e.g. `(default: "30s")`,
+// as JSON. Only values that fit the field type count, so prose like
+// "(default: all)" is skipped; plain words are taken if they are a choice.
+func findDefault(doc string, typ ast.Expr, choices []string) (string, bool) {
+	var candidates []string
+	if i := strings.Index(strings.ToLower(doc), "default: "); i >= 0 {
+		rest := doc[i+len("default: "):]
+		depth := 0
+		if i > 0 && doc[i-1] == '(' {
+			depth = 1
+		}
+		rest = untilClose(rest, depth)
+		candidates = append(candidates, rest, cutOutside(rest, ", "), cutOutside(rest, " ("))
+		if word, _, _ := strings.Cut(rest, " "); word != "" {
+			candidates = append(candidates, word)
+		}
+	}
+	for _, m := range markedRe.FindAllStringSubmatch(doc, -1) {
+		candidates = append(candidates, m[1])
+	}
+
+	want := fieldKind(typ)
+	for _, c := range candidates {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		var v struct{ V any }
+		if err := toml.Unmarshal([]byte("V = "+c), &v); err == nil && kindOf(v.V) == want {
+			return jsonValue(v.V), true
+		}
+		if want == "string" && slices.Contains(choices, c) {
+			return jsonValue(c), true
+		}
+	}
+	return "", false
+}
+
+// untilClose returns s up to the parenthesis that closes depth open ones
+func untilClose(s string, depth int) string {
+	inString := false
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inString = !inString
+		case inString:
+		case r == '(' || r == '[':
+			depth++
+		case r == ')' || r == ']':
+			if depth == 0 {
+				return s[:i]
+			}
+			depth--
+			if depth == 0 && r == ')' {
+				return s[:i]
+			}
+		}
+	}
+	return s
+}
+
+// cutOutside returns s up to the first sep that is not inside quotes or brackets
+func cutOutside(s, sep string) string {
+	inString, depth := false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// fieldKind is the kind of value a field holds: string, integer, number, boolean or strings
+func fieldKind(typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.StarExpr:
+		return fieldKind(t.X)
+	case *ast.ArrayType:
+		if fieldKind(t.Elt) == "string" {
+			return "strings"
+		}
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			return "string"
+		case "int", "int64":
+			return "integer"
+		case "float64":
+			return "number"
+		case "bool":
+			return "boolean"
+		}
+	}
+	return ""
+}
+
+func kindOf(v any) string {
+	switch v := v.(type) {
+	case string:
+		return "string"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		for _, e := range v {
+			if _, ok := e.(string); !ok {
+				return ""
+			}
+		}
+		return "strings"
+	}
+	return ""
+}
+
+func jsonValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return string(data)
+}
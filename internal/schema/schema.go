@@ -0,0 +1,173 @@
+// Package schema describes config.toml and themes.toml as JSON Schema, so
+// editors can complete and check them. The structure is read from the config
+// and themes types when the schema is built; descriptions and defaults come
+// from their comments through docs_gen.go, which go generate keeps current.
+package schema
+
+//go:generate go run gen.go
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+
+	"herbst/internal/config"
+	"herbst/internal/themes"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Draft is the JSON Schema version of the generated schemas
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// envPattern matches values taken from environment variables, they are only known at load time
+const envPattern = `\$\{[^}]+\}`
+
+// Schema is the subset of JSON Schema the config types need
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Default              json.RawMessage    `json:"default,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"` // false or a *Schema
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+}
+
+var (
+	configSchema = sync.OnceValues(func() ([]byte, error) {
+		return json.MarshalIndent(Config(), "", "  ")
+	})
+	themesSchema = sync.OnceValues(func() ([]byte, error) {
+		return json.MarshalIndent(Themes(), "", "  ")
+	})
+)
+
+// ConfigJSON returns the schema of config.toml, built once
+func ConfigJSON() ([]byte, error) {
+	return configSchema()
+}
+
+// ThemesJSON returns the schema of themes.toml, built once
+func ThemesJSON() ([]byte, error) {
+	return themesSchema()
+}
+
+// Config builds the schema of config.toml
+func Config() *Schema {
+	s := build(reflect.TypeFor[config.Config]())
+	s.Title = "herbst config.toml"
+	return s
+}
+
+// Themes builds the schema of themes.toml. The variables of the default
+// themes are listed, others are allowed too.
+func Themes() *Schema {
+	s := build(reflect.TypeFor[themes.ThemeFile]())
+	s.Title = "herbst themes.toml"
+
+	var defaults themes.ThemeFile
+	if err := toml.Unmarshal([]byte(themes.DefaultThemesTOML), &defaults); err == nil {
+		vars := s.Definitions["Theme"].Properties["vars"]
+		vars.Properties = make(map[string]*Schema)
+		for _, theme := range defaults.Themes {
+			for name := range theme.Vars {
+				vars.Properties[name] = &Schema{Type: "string"}
+			}
+		}
+	}
+	return s
+}
+
+// build returns the schema of the struct root with the structs it uses as definitions
+func build(root reflect.Type) *Schema {
+	b := &builder{defs: make(map[string]*Schema)}
+	s := b.object(root)
+	s.Schema = Draft
+	s.Definitions = b.defs
+	return s
+}
+
+type builder struct {
+	defs map[string]*Schema // by type name
+}
+
+// of returns the schema of a value of type t, structs are referenced
+func (b *builder) of(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.of(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: b.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.of(t.Elem())}
+	case reflect.Struct:
+		if _, ok := b.defs[t.Name()]; !ok {
+			b.defs[t.Name()] = nil // reserved while its fields are built
+			b.defs[t.Name()] = b.object(t)
+		}
+		return &Schema{Ref: "#/definitions/" + t.Name()}
+	}
+	return &Schema{}
+}
+
+// object returns the schema of struct t, keys that it does not decode are errors
+func (b *builder) object(t reflect.Type) *Schema {
+	typeKey := path.Base(t.PkgPath()) + "." + t.Name()
+	s := &Schema{
+		Type:                 "object",
+		Description:          typeDocs[typeKey],
+		Properties:           make(map[string]*Schema),
+		AdditionalProperties: false,
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if key == "" || key == "-" || !f.IsExported() {
+			continue
+		}
+		p := b.of(f.Type)
+		// Tables are described by their type, a $ref ignores everything next to it
+		if p.Ref == "" && (p.Items == nil || p.Items.Ref == "") {
+			p.Description = fieldDocs[typeKey+"."+f.Name]
+		}
+		if def, ok := fieldDefaults[typeKey+"."+f.Name]; ok {
+			p.Default = json.RawMessage(def)
+		}
+		if choices, ok := config.Choices[t.Name()+"."+key]; ok {
+			if p.Items != nil {
+				p.Items = oneOf(choices)
+			} else {
+				p.Type = ""
+				p.AnyOf = oneOf(choices).AnyOf
+			}
+		}
+		s.Properties[key] = p
+	}
+	return s
+}
+
+// oneOf is a string that is one of choices or an environment variable
+func oneOf(choices []string) *Schema {
+	return &Schema{AnyOf: []*Schema{
+		{Type: "string", Enum: choices},
+		{Type: "string", Pattern: envPattern},
+	}}
+}
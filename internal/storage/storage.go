@@ -0,0 +1,368 @@
+// internal/storage/storage.go
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"herbst/internal/history"
+	"herbst/internal/util"
+)
+
+// Options configure the storage file
+type Options struct {
+	Path            string        // storage file
+	Retention       time.Duration // samples older than this are dropped on compaction (0 = keep forever)
+	DownsampleAfter time.Duration // samples older than this are merged into hourly points (0 = never)
+	CompactInterval time.Duration // how often compaction runs
+}
+
+// downsampleStep is the resolution old samples are compacted to
+const downsampleStep = int64(time.Hour / time.Second)
+
+// Storage is an append-only file of history points, one per line:
+//
+//	<unix seconds> <average> <max> <series key>
+//
+// Lines are appended in time order, so a time range can be found with a
+// binary search over byte offsets. Compaction rewrites the file without
+// expired lines and with old lines downsampled.
+//
+// Readers and compaction read through their own file handle, so appends only
+// wait for them to open the file and, for compaction, to switch files.
+type Storage struct {
+	opts Options
+
+	compactMu sync.Mutex // one compaction at a time
+	mu        sync.Mutex // guards f, appends and switching to a compacted file
+	f         *os.File
+}
+
+// Open opens or creates the storage file
+func Open(opts Options) (*Storage, error) {
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(opts.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{opts: opts, f: f}, nil
+}
+
+// Close flushes and closes the file
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.f.Sync(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// Append writes a point, it implements history.Backend
+func (s *Storage) Append(key string, p history.Point) error {
+	if strings.ContainsAny(key, "\n") {
+		return fmt.Errorf("invalid series key %q", key)
+	}
+	line := formatLine(key, p)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := io.WriteString(s.f, line)
+	return err
+}
+
+// Query returns the points of the series keys between from and to (unix
+// seconds) in one pass over the file, it implements history.Backend
+func (s *Storage) Query(keys []string, from, to int64) (map[string][]history.Point, error) {
+	points := make(map[string][]history.Point, len(keys))
+	for _, k := range keys {
+		points[k] = []history.Point{}
+	}
+	err := s.scan(from, func(k string, p history.Point) bool {
+		if p.T > to {
+			return false
+		}
+		if list, ok := points[k]; ok && p.T >= from {
+			points[k] = append(list, p)
+		}
+		return true
+	})
+	return points, err
+}
+
+// Load calls fn for every point from time from on, oldest first
+func (s *Storage) Load(from int64, fn func(key string, p history.Point)) error {
+	return s.scan(from, func(k string, p history.Point) bool {
+		if p.T >= from {
+			fn(k, p)
+		}
+		return true
+	})
+}
+
+// scanSlack allows for lines that were appended slightly out of order
+// (series finish their steps at different moments)
+const scanSlack = int64(10 * 60)
+
+// snapshot opens the file for reading and returns its size at that moment.
+// Lines appended later are not seen, a compaction does not affect the handle.
+func (s *Storage) snapshot() (*os.File, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(s.opts.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// scan reads lines from roughly from on until fn returns false
+func (s *Storage) scan(from int64, fn func(key string, p history.Point) bool) error {
+	f, size, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := seek(f, size, from-scanSlack)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(io.NewSectionReader(f, offset, size-offset), 64<<10)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return nil // a partial last line is still being written
+		}
+		if err != nil {
+			return err
+		}
+		key, p, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		if !fn(key, p) {
+			return nil
+		}
+	}
+}
+
+// seek finds the offset of the first line of f with a time >= t by binary search
+func seek(f *os.File, size int64, t int64) (int64, error) {
+	lo, hi := int64(0), size
+	buf := make([]byte, 256)
+	for hi-lo > 4096 {
+		mid := (lo + hi) / 2
+		n, err := f.ReadAt(buf, mid)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		// Skip the partial line at mid
+		nl := strings.IndexByte(string(buf[:n]), '\n')
+		if nl < 0 {
+			hi = mid
+			continue
+		}
+		rest := string(buf[nl+1 : n])
+		ts, _, _ := strings.Cut(rest, " ")
+		lineT, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil || lineT >= t {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	if lo == 0 {
+		return 0, nil
+	}
+	// Start after the line break following lo
+	n, err := f.ReadAt(buf, lo)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if nl := strings.IndexByte(string(buf[:n]), '\n'); nl >= 0 {
+		return lo + int64(nl) + 1, nil
+	}
+	return lo, nil
+}
+
+// Run compacts the file every CompactInterval until ctx ends
+func (s *Storage) Run(ctx context.Context) {
+	interval := s.opts.CompactInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Compact(time.Now()); err != nil {
+			log.Printf("storage: compaction failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Compact rewrites the file: points older than Retention are dropped and points
+// older than DownsampleAfter are merged into hourly points. Appends go on while
+// the file is rewritten, the lines appended meanwhile are copied at the end.
+func (s *Storage) Compact(now time.Time) error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	var dropBefore, mergeBefore int64
+	if s.opts.Retention > 0 {
+		dropBefore = now.Add(-s.opts.Retention).Unix()
+	}
+	if s.opts.DownsampleAfter > 0 {
+		mergeBefore = now.Add(-s.opts.DownsampleAfter).Unix()
+		mergeBefore -= mergeBefore % downsampleStep // only whole hours
+	}
+
+	src, size, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := util.CreateAtomic(s.opts.Path, 0o644)
+	if err != nil {
+		return err
+	}
+	defer tmp.Abort()
+	w := bufio.NewWriterSize(tmp, 64<<10)
+
+	// Hourly buckets being merged, written once the hour is complete
+	type bucket struct {
+		p   history.Point
+		sum float64
+		n   int
+	}
+	open := make(map[string]*bucket)
+	var openHour int64
+	flush := func() {
+		for key, b := range open {
+			b.p.V = b.sum / float64(b.n)
+			w.WriteString(formatLine(key, b.p))
+		}
+		clear(open)
+	}
+
+	var dropped, merged int
+	r := bufio.NewReaderSize(io.NewSectionReader(src, 0, size), 64<<10)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		key, p, ok := parseLine(line)
+		if !ok || p.T < dropBefore {
+			dropped++
+			continue
+		}
+
+		if p.T >= mergeBefore {
+			flush()
+			w.WriteString(line)
+			continue
+		}
+
+		hour := p.T - p.T%downsampleStep
+		if hour != openHour {
+			flush()
+			openHour = hour
+		}
+		b, ok := open[key]
+		if !ok {
+			b = &bucket{p: history.Point{T: hour, Max: p.Max}}
+			open[key] = b
+		}
+		b.sum += p.V
+		b.p.Max = max(b.p.Max, p.Max)
+		b.n++
+		if b.n > 1 {
+			merged++
+		}
+	}
+	flush()
+
+	// Nothing expired or merged, keep the file as it is
+	if dropped == 0 && merged == 0 {
+		return nil
+	}
+
+	// Appends wait from here on until the compacted file replaces the old one
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, io.NewSectionReader(src, size, info.Size()-size)); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Commit(); err != nil {
+		return err
+	}
+
+	// Continue appending to the new file
+	f, err := os.OpenFile(s.opts.Path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.f.Close()
+	s.f = f
+
+	log.Printf("storage: compacted %s (%d expired, %d merged into hourly samples)", s.opts.Path, dropped, merged)
+	return nil
+}
+
+func formatLine(key string, p history.Point) string {
+	return strconv.FormatInt(p.T, 10) + " " +
+		strconv.FormatFloat(p.V, 'g', 6, 64) + " " +
+		strconv.FormatFloat(p.Max, 'g', 6, 64) + " " +
+		key + "\n"
+}
+
+func parseLine(line string) (string, history.Point, bool) {
+	fields := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 4)
+	if len(fields) != 4 {
+		return "", history.Point{}, false
+	}
+	t, err1 := strconv.ParseInt(fields[0], 10, 64)
+	v, err2 := strconv.ParseFloat(fields[1], 64)
+	m, err3 := strconv.ParseFloat(fields[2], 64)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return "", history.Point{}, false
+	}
+	return fields[3], history.Point{T: t, V: v, Max: m}, true
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"herbst/internal/history"
+)
+
+func openTemp(t *testing.T, opts Options) *Storage {
+	t.Helper()
+	opts.Path = filepath.Join(t.TempDir(), "history.log")
+	s, err := Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSeek(t *testing.T) {
+	s := openTemp(t, Options{})
+	const start, step, n = int64(1_700_000_000), int64(60), 5000
+	for i := range int64(n) {
+		if err := s.Append("local/cpu", history.Point{T: start + i*step, V: 1, Max: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(s.opts.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, size, err := s.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		name string
+		t    int64
+	}{
+		{"before the first line", start - 3600},
+		{"first line", start},
+		{"middle", start + n/2*step},
+		{"between two lines", start + 1000*step + 30},
+		{"last line", start + (n-1)*step},
+		{"after the last line", start + n*step},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, err := seek(f, size, tt.t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offset < 0 || offset > size {
+				t.Fatalf("offset %d outside the file (size %d)", offset, size)
+			}
+			if offset > 0 && data[offset-1] != '\n' {
+				t.Fatalf("offset %d is not at the start of a line", offset)
+			}
+			// No line at or after t may be skipped, and the search narrows down to a few KB
+			firstAfter := size
+			var pos int64
+			for _, line := range strings.SplitAfter(string(data), "\n") {
+				if _, p, ok := parseLine(line); ok && p.T >= tt.t {
+					firstAfter = pos
+					break
+				}
+				pos += int64(len(line))
+			}
+			if offset > firstAfter {
+				t.Fatalf("offset %d skips the first line at or after %d (offset %d)", offset, tt.t, firstAfter)
+			}
+			if firstAfter-offset > 8192 {
+				t.Errorf("offset %d is %d bytes before the first matching line", offset, firstAfter-offset)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	s := openTemp(t, Options{})
+	for i := range int64(100) {
+		s.Append("local/cpu", history.Point{T: i * 60, V: float64(i), Max: float64(i)})
+		s.Append("local/memory", history.Point{T: i * 60, V: 50, Max: 50})
+	}
+
+	got, err := s.Query([]string{"local/cpu", "n1/cpu"}, 600, 720)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]history.Point{
+		"local/cpu": {{T: 600, V: 10, Max: 10}, {T: 660, V: 11, Max: 11}, {T: 720, V: 12, Max: 12}},
+		"n1/cpu":    {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Query() = %v, want %v", got, want)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	now := time.Unix(100*3600, 0)
+	hour := int64(3600)
+
+	// Two points per hour for the last 10 hours
+	var points []history.Point
+	for h := int64(90); h < 100; h++ {
+		points = append(points,
+			history.Point{T: h * hour, V: 10, Max: 20},
+			history.Point{T: h*hour + 1800, V: 30, Max: 40},
+		)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []history.Point
+	}{
+		{
+			name: "nothing to do",
+			opts: Options{},
+			want: points,
+		},
+		{
+			name: "retention",
+			opts: Options{Retention: 2 * time.Hour},
+			want: points[16:],
+		},
+		{
+			name: "downsample",
+			opts: Options{DownsampleAfter: 8 * time.Hour},
+			want: append([]history.Point{
+				{T: 90 * hour, V: 20, Max: 40},
+				{T: 91 * hour, V: 20, Max: 40},
+			}, points[4:]...),
+		},
+		{
+			name: "retention and downsample",
+			opts: Options{Retention: 9 * time.Hour, DownsampleAfter: 8 * time.Hour},
+			want: append([]history.Point{
+				{T: 91 * hour, V: 20, Max: 40},
+			}, points[4:]...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTemp(t, tt.opts)
+			for _, p := range points {
+				s.Append("local/cpu", p)
+			}
+			if err := s.Compact(now); err != nil {
+				t.Fatal(err)
+			}
+			// Appends after a compaction go to the new file
+			next := history.Point{T: 100 * hour, V: 1, Max: 1}
+			if err := s.Append("local/cpu", next); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []history.Point
+			if err := s.Load(0, func(_ string, p history.Point) { got = append(got, p) }); err != nil {
+				t.Fatal(err)
+			}
+			want := append(append([]history.Point{}, tt.want...), next)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("after Compact:\n got %v\nwant %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		key  string
+		p    history.Point
+		ok   bool
+	}{
+		{"60 1.5 2 local/disk:/data with space\n", "local/disk:/data with space", history.Point{T: 60, V: 1.5, Max: 2}, true},
+		{"60 1.5 2\n", "", history.Point{}, false},
+		{"x 1 2 local/cpu\n", "", history.Point{}, false},
+		{"", "", history.Point{}, false},
+	}
+	for _, tt := range tests {
+		key, p, ok := parseLine(tt.line)
+		if key != tt.key || p != tt.p || ok != tt.ok {
+			t.Errorf("parseLine(%q) = %q, %v, %v, want %q, %v, %v", tt.line, key, p, ok, tt.key, tt.p, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// internal/sysinfo/sampler.go
+package sysinfo
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	gnet "github.com/shirou/gopsutil/v3/net"
+
+	"herbst/internal/proto"
+)
+
+// Sampler measures values that need two readings (CPU usage, network
+// throughput) in the background, so requests can read them without waiting
+type Sampler struct {
+	mu      sync.RWMutex
+	cpu     float64
+	network []proto.NetworkMetrics
+
+	last   map[string]gnet.IOCountersStat // previous counters per interface
+	lastAt time.Time
+}
+
+func NewSampler() *Sampler {
+	return &Sampler{network: []proto.NetworkMetrics{}}
+}
+
+// Start samples in a background goroutine until ctx ends.
+// Each round takes interval, because CPU usage is measured over it.
+func (s *Sampler) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		for ctx.Err() == nil {
+			// This blocks for interval to measure CPU usage
+			cpuPercent, err := cpu.PercentWithContext(ctx, interval, false)
+			if err == nil && len(cpuPercent) > 0 {
+				s.mu.Lock()
+				s.cpu = cpuPercent[0]
+				s.mu.Unlock()
+			} else if err != nil {
+				// No CPU data on this platform, do not spin
+				select {
+				case <-ctx.Done():
+				case <-time.After(interval):
+				}
+			}
+			s.sampleNetwork()
+		}
+	}()
+}
+
+// sampleNetwork computes per-interface rates from the counters since the previous round
+func (s *Sampler) sampleNetwork() {
+	counters, err := gnet.IOCounters(true)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := now.Sub(s.lastAt).Seconds()
+	network := make([]proto.NetworkMetrics, 0, len(counters))
+	current := make(map[string]gnet.IOCountersStat, len(counters))
+	for _, c := range counters {
+		current[c.Name] = c
+		n := proto.NetworkMetrics{
+			Interface: c.Name,
+			RxBytes:   c.BytesRecv,
+			TxBytes:   c.BytesSent,
+		}
+		// Counters reset when an interface is recreated, skip the rate for that round
+		if prev, ok := s.last[c.Name]; ok && elapsed > 0 && c.BytesRecv >= prev.BytesRecv && c.BytesSent >= prev.BytesSent {
+			n.RxRate = float64(c.BytesRecv-prev.BytesRecv) / elapsed
+			n.TxRate = float64(c.BytesSent-prev.BytesSent) / elapsed
+		}
+		network = append(network, n)
+	}
+	sort.Slice(network, func(i, j int) bool { return network[i].Interface < network[j].Interface })
+
+	s.network = network
+	s.last = current
+	s.lastAt = now
+}
+
+// CPUPercent returns the total CPU usage of the last round
+func (s *Sampler) CPUPercent() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cpu
+}
+
+// Network returns the counters and rates of all interfaces from the last round
+func (s *Sampler) Network() []proto.NetworkMetrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.network)
+}
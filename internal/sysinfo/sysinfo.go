@@ -0,0 +1,174 @@
+// internal/sysinfo/sysinfo.go
+package sysinfo
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"herbst/internal/proto"
+)
+
+// AllDisks as the only disk entry selects all real filesystems
+const AllDisks = "all"
+
+// Options select what Collect reports
+type Options struct {
+	Disks      []string // mount points, or ["all"] (default: "/")
+	Interfaces []string // network interfaces (default: all except loopback and virtual ones)
+}
+
+// Collect gathers host metrics with gopsutil. Values that need two readings
+// (CPU usage, network rates) come from the background sampler, so Collect never blocks.
+// Metrics that cannot be read (e.g. load on Windows, sensors in a VM) stay empty.
+func Collect(s *Sampler, opts Options) proto.HostMetrics {
+	m := Usage(s, opts)
+	m.Temperatures = Temperatures()
+
+	info := staticInfo()
+	m.CPU.Model, m.CPU.Cores, m.CPU.Threads = info.cpuModel, info.cpuCores, info.cpuThreads
+	m.Host = info.host
+	m.Host.Uptime, _ = host.Uptime()
+	return m
+}
+
+// Usage gathers only the values that keep changing: CPU usage, memory, swap,
+// load, disks and network rates. It is cheap enough to call every second.
+func Usage(s *Sampler, opts Options) proto.HostMetrics {
+	m := proto.HostMetrics{
+		CPU:     proto.CPUMetrics{Percent: s.CPUPercent()},
+		Disks:   collectDisks(opts.Disks),
+		Network: filterInterfaces(s.Network(), opts.Interfaces),
+	}
+	if len(m.Disks) > 0 {
+		m.Disk = m.Disks[0]
+	}
+
+	if vm, _ := mem.VirtualMemory(); vm != nil {
+		m.Memory = proto.MemoryMetrics{Total: vm.Total, Used: vm.Used, Percent: vm.UsedPercent}
+	}
+	if sw, _ := mem.SwapMemory(); sw != nil {
+		m.Swap = proto.MemoryMetrics{Total: sw.Total, Used: sw.Used, Percent: sw.UsedPercent}
+	}
+
+	if avg, _ := load.Avg(); avg != nil {
+		m.Load = proto.LoadMetrics{Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}
+	}
+
+	return m
+}
+
+// hostStatic is what does not change while herbst runs
+type hostStatic struct {
+	cpuModel   string
+	cpuCores   int
+	cpuThreads int
+	host       proto.HostInfo // without uptime
+}
+
+// staticInfo reads the CPU model and host info once, parsing them is not cheap
+var staticInfo = sync.OnceValue(func() hostStatic {
+	var info hostStatic
+	if ci, _ := cpu.Info(); len(ci) > 0 {
+		info.cpuModel = ci[0].ModelName
+		info.cpuCores = int(ci[0].Cores)
+	}
+	info.cpuThreads, _ = cpu.Counts(true) // logical cores
+	if hi, _ := host.Info(); hi != nil {
+		info.host = proto.HostInfo{Hostname: hi.Hostname, OS: hi.OS, Platform: hi.Platform}
+	}
+	return info
+})
+
+// ignoredFstypes are read-only images that always report 100% usage
+var ignoredFstypes = []string{"squashfs", "iso9660", "udf"}
+
+func collectDisks(paths []string) []proto.DiskMetrics {
+	disks := []proto.DiskMetrics{}
+
+	if len(paths) == 1 && paths[0] == AllDisks {
+		parts, _ := disk.Partitions(false) // physical devices only
+		seen := make(map[string]bool)
+		for _, p := range parts {
+			// Bind mounts show up once per mount point
+			if seen[p.Device] || slices.Contains(ignoredFstypes, p.Fstype) {
+				continue
+			}
+			seen[p.Device] = true
+			if du, err := disk.Usage(p.Mountpoint); err == nil && du.Total > 0 {
+				disks = append(disks, diskMetrics(p.Mountpoint, p.Device, p.Fstype, du))
+			}
+		}
+		return disks
+	}
+
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+	for _, path := range paths {
+		if du, err := disk.Usage(path); err == nil {
+			disks = append(disks, diskMetrics(path, "", du.Fstype, du))
+		}
+	}
+	return disks
+}
+
+func diskMetrics(path, device, fstype string, du *disk.UsageStat) proto.DiskMetrics {
+	return proto.DiskMetrics{
+		Path:    path,
+		Device:  device,
+		Fstype:  fstype,
+		Total:   du.Total,
+		Used:    du.Used,
+		Percent: du.UsedPercent,
+	}
+}
+
+// virtualInterfaces are skipped unless listed explicitly (Docker creates one veth per container)
+var virtualInterfaces = []string{"lo", "veth", "docker", "br-", "virbr", "cni", "flannel"}
+
+func filterInterfaces(all []proto.NetworkMetrics, names []string) []proto.NetworkMetrics {
+	out := []proto.NetworkMetrics{}
+	for _, n := range all {
+		if len(names) > 0 {
+			if slices.Contains(names, n.Interface) {
+				out = append(out, n)
+			}
+			continue
+		}
+		if !slices.ContainsFunc(virtualInterfaces, func(prefix string) bool {
+			return strings.HasPrefix(n.Interface, prefix)
+		}) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// Temperatures reads the hardware sensors, sorted by sensor name
+func Temperatures() []proto.TemperatureMetric {
+	temps := []proto.TemperatureMetric{}
+
+	// Returns partial results together with warnings for unreadable sensors
+	stats, _ := host.SensorsTemperatures()
+	for _, t := range stats {
+		if t.Temperature <= 0 {
+			continue
+		}
+		temps = append(temps, proto.TemperatureMetric{
+			Sensor:   t.SensorKey,
+			Celsius:  t.Temperature,
+			High:     t.High,
+			Critical: t.Critical,
+		})
+	}
+	sort.Slice(temps, func(i, j int) bool { return temps[i].Sensor < temps[j].Sensor })
+	return temps
+}
@@ -0,0 +1,151 @@
+package uptime
+
+import (
+	"time"
+
+	"herbst/internal/health"
+)
+
+// Report is the uptime of a service over a time range
+type Report struct {
+	From             time.Time `json:"from"`
+	To               time.Time `json:"to"`
+	Uptime           *float64  `json:"uptime"`           // percent of the monitored time the service was up, null without data
+	MonitoredSeconds float64   `json:"monitoredSeconds"` // time with a known state
+	DowntimeSeconds  float64   `json:"downtimeSeconds"`
+	Outages          []Outage  `json:"outages,omitempty"`
+	Buckets          []Bucket  `json:"buckets,omitempty"`
+}
+
+// Outage is a period the service was down
+type Outage struct {
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end,omitzero"` // zero while the outage is ongoing
+	DurationSeconds float64   `json:"durationSeconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// Bucket is one segment of a status bar
+type Bucket struct {
+	Start  time.Time `json:"start"`
+	Uptime *float64  `json:"uptime"` // null without data
+}
+
+// period is a stretch of time with one state
+type period struct {
+	from, to time.Time
+	state    health.State
+	err      string
+}
+
+// Report computes the uptime of service id between from and to. With buckets > 0,
+// the range is also split into that many equal segments for a status bar.
+// Outages are listed when outages is set.
+func (t *Tracker) Report(id string, from, to time.Time, buckets int, outages bool) Report {
+	periods := toPeriods(t.Events(id, from, to), from, to)
+
+	r := Report{From: from, To: to}
+	var up float64
+	for _, p := range periods {
+		d := p.to.Sub(p.from).Seconds()
+		switch p.state {
+		case health.StateUp:
+			up += d
+			r.MonitoredSeconds += d
+		case health.StateDown:
+			r.DowntimeSeconds += d
+			r.MonitoredSeconds += d
+		}
+	}
+	r.Uptime = percent(up, r.MonitoredSeconds)
+
+	if outages {
+		r.Outages = toOutages(t.Events(id, from, to), from, to)
+	}
+
+	if buckets > 0 {
+		step := to.Sub(from) / time.Duration(buckets)
+		r.Buckets = make([]Bucket, buckets)
+		for i := range r.Buckets {
+			start := from.Add(time.Duration(i) * step)
+			end := start.Add(step)
+			var bUp, bKnown float64
+			for _, p := range periods {
+				lo, hi := later(p.from, start), earlier(p.to, end)
+				if !hi.After(lo) || p.state == health.StatePending {
+					continue
+				}
+				d := hi.Sub(lo).Seconds()
+				bKnown += d
+				if p.state == health.StateUp {
+					bUp += d
+				}
+			}
+			r.Buckets[i] = Bucket{Start: start, Uptime: percent(bUp, bKnown)}
+		}
+	}
+	return r
+}
+
+// toPeriods turns transitions into periods clipped to [from, to).
+// Time before the first transition has no data.
+func toPeriods(events []Event, from, to time.Time) []period {
+	var periods []period
+	for i, e := range events {
+		end := to
+		if i+1 < len(events) {
+			end = events[i+1].T
+		}
+		start := later(e.T, from)
+		end = earlier(end, to)
+		if end.After(start) {
+			periods = append(periods, period{start, end, e.State, e.Error})
+		}
+	}
+	return periods
+}
+
+// toOutages lists the down periods overlapping [from, to). Unlike periods, they
+// are not clipped, so an outage shows when it really started and ended.
+func toOutages(events []Event, from, to time.Time) []Outage {
+	var list []Outage
+	for i, e := range events {
+		if e.State != health.StateDown {
+			continue
+		}
+		o := Outage{Start: e.T, Error: e.Error}
+		end := time.Now()
+		if i+1 < len(events) {
+			o.End = events[i+1].T
+			end = o.End
+		}
+		if !end.After(from) || !e.T.Before(to) {
+			continue
+		}
+		o.DurationSeconds = end.Sub(e.T).Seconds()
+		list = append(list, o)
+	}
+	return list
+}
+
+func percent(part, total float64) *float64 {
+	if total <= 0 {
+		return nil
+	}
+	p := part / total * 100
+	return &p
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,242 @@
+// Package uptime keeps the state transitions of checked services
+// and computes uptime percentages and outages from them
+package uptime
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"herbst/internal/health"
+	"herbst/internal/util"
+)
+
+// DefaultRetention is how long transitions are kept without [storage]
+const DefaultRetention = 30 * 24 * time.Hour
+
+// Event is a state transition of a service. StatePending means there is no
+// data from T on, e.g. after herbst was restarted.
+type Event struct {
+	T     time.Time    `json:"t"`
+	ID    string       `json:"id"`
+	State health.State `json:"state"`
+	Error string       `json:"error,omitempty"` // why the service went down
+}
+
+// Tracker records transitions in memory and, if a path is set, in an
+// append-only file with one JSON event per line
+type Tracker struct {
+	retention time.Duration
+
+	mu     sync.RWMutex
+	events map[string][]Event // service ID -> transitions in time order
+	path   string
+	f      *os.File // nil = memory only
+}
+
+// Open loads the transitions stored at path. An empty path keeps them in memory only.
+// retention 0 keeps transitions forever.
+func Open(path string, retention time.Duration) (*Tracker, error) {
+	t := &Tracker{
+		retention: retention,
+		events:    make(map[string][]Event),
+		path:      path,
+	}
+	if path == "" {
+		return t, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.ID == "" {
+			continue
+		}
+		t.add(e)
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	t.f = f
+	return t, nil
+}
+
+// Close closes the file
+func (t *Tracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.f == nil {
+		return nil
+	}
+	return t.f.Close()
+}
+
+// add appends e to the in-memory list if it changes the state, t.mu must be held
+func (t *Tracker) add(e Event) bool {
+	list := t.events[e.ID]
+	if n := len(list); n > 0 && list[n-1].State == e.State {
+		return false
+	}
+	t.events[e.ID] = append(list, e)
+	return true
+}
+
+// Record stores a transition of service id
+func (t *Tracker) Record(id string, at time.Time, state health.State, reason string) {
+	e := Event{T: at.UTC().Truncate(time.Millisecond), ID: id, State: state}
+	if state == health.StateDown {
+		e.Error = reason
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.add(e) || t.f == nil {
+		return
+	}
+	data, _ := json.Marshal(e)
+	if _, err := t.f.Write(append(data, '\n')); err != nil {
+		log.Printf("uptime: failed to write %s: %v", t.path, err)
+	}
+}
+
+// MarkUnknown records that nothing is known from at on about every service
+// not in keep. It is called on startup with a nil keep, so the time herbst was
+// not running is not counted as up or down until the first check, and after a
+// config reload with the services that are still checked.
+func (t *Tracker) MarkUnknown(at time.Time, keep map[string]bool) {
+	t.mu.RLock()
+	ids := make([]string, 0, len(t.events))
+	for id := range t.events {
+		if !keep[id] {
+			ids = append(ids, id)
+		}
+	}
+	t.mu.RUnlock()
+
+	for _, id := range ids {
+		t.Record(id, at, health.StatePending, "")
+	}
+}
+
+// Events returns the transitions of service id between from and to, plus the
+// last one before from, which tells the state at the start of the range
+func (t *Tracker) Events(id string, from, to time.Time) []Event {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	list := t.events[id]
+	start, _ := slices.BinarySearchFunc(list, from, func(e Event, at time.Time) int {
+		return e.T.Compare(at)
+	})
+	if start > 0 {
+		start--
+	}
+	end, _ := slices.BinarySearchFunc(list, to, func(e Event, at time.Time) int {
+		return e.T.Compare(at)
+	})
+	return slices.Clone(list[start:end])
+}
+
+// Run compacts every hour until ctx ends
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := t.Compact(time.Now()); err != nil {
+			log.Printf("uptime: compaction failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Compact drops transitions older than the retention. The last transition
+// before the cutoff is kept, it is the state at the start of the retention window.
+func (t *Tracker) Compact(now time.Time) error {
+	if t.retention <= 0 {
+		return nil
+	}
+	cutoff := now.Add(-t.retention)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dropped := 0
+	for id, list := range t.events {
+		keep := 0
+		for keep+1 < len(list) && list[keep+1].T.Before(cutoff) {
+			keep++
+		}
+		// A service that is unknown since before the cutoff was removed from the config
+		if keep == len(list)-1 && list[keep].T.Before(cutoff) && list[keep].State == health.StatePending {
+			keep = len(list)
+		}
+		if keep > 0 {
+			t.events[id] = slices.Clone(list[keep:])
+			dropped += keep
+		}
+		if len(t.events[id]) == 0 {
+			delete(t.events, id)
+		}
+	}
+	if dropped == 0 || t.f == nil {
+		return nil
+	}
+	return t.rewrite(dropped)
+}
+
+// rewrite replaces the file with the events in memory, t.mu must be held
+func (t *Tracker) rewrite(dropped int) error {
+	var all []Event
+	for _, list := range t.events {
+		all = append(all, list...)
+	}
+	slices.SortFunc(all, func(a, b Event) int { return a.T.Compare(b.T) })
+
+	tmp, err := util.CreateAtomic(t.path, 0o644)
+	if err != nil {
+		return err
+	}
+	defer tmp.Abort()
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range all {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Commit(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(t.path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	t.f.Close()
+	t.f = f
+
+	log.Printf("uptime: compacted %s (%d expired transitions)", t.path, dropped)
+	return nil
+}
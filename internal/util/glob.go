@@ -0,0 +1,33 @@
+package util
+
+// MatchGlob reports whether s matches pattern, where * matches any run of
+// characters (including "/", so "disk:*" matches "disk:/data") and an empty
+// pattern matches everything
+func MatchGlob(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	// Iterative wildcard matching, backtracking to the last *
+	p, i := 0, 0
+	star, mark := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, i
+			p++
+		case p < len(pattern) && pattern[p] == s[i]:
+			p++
+			i++
+		case star >= 0:
+			p = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
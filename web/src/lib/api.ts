@@ -0,0 +1,23 @@
+const tokenKey = "herbst-api-token";
+
+/**
+ * fetch with the [api] token as Bearer header. The token is asked for on the
+ * first 401 and kept for the browser session.
+ */
+export async function fetchWithToken(
+  url: string,
+  init: RequestInit = {},
+): Promise<Response> {
+  for (;;) {
+    const token = sessionStorage.getItem(tokenKey);
+    const headers = new Headers(init.headers);
+    if (token) headers.set("Authorization", `Bearer ${token}`);
+    const res = await fetch(url, { ...init, headers });
+    if (res.status !== 401) return res;
+    const entered = prompt(
+      token ? "Wrong API token, try again:" : "API token ([api] token):",
+    );
+    if (!entered) return res;
+    sessionStorage.setItem(tokenKey, entered);
+  }
+}
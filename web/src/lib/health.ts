@@ -0,0 +1,132 @@
+import { reactive } from "vue";
+
+export type HealthState = "pending" | "up" | "down";
+
+export type TLSInfo = {
+  subject: string;
+  issuer: string;
+  dnsNames?: string[];
+  notAfter: string;
+  daysLeft: number;
+  expiring: boolean;
+  expired: boolean;
+  trusted: boolean;
+  trustError?: string;
+  hostnameMatch: boolean;
+};
+
+export type HealthStatus = {
+  id: string;
+  section?: string;
+  name: string;
+  url: string;
+  type?: string;
+  state: HealthState;
+  latencyMs: number;
+  error?: string;
+  tls?: TLSInfo;
+  checkedAt?: string;
+  changedAt?: string;
+};
+
+export type UptimeBucket = {
+  start: string;
+  uptime: number | null; // percent, null = no data
+};
+
+export type UptimeReport = {
+  from: string;
+  to: string;
+  uptime: number | null;
+  monitoredSeconds: number;
+  downtimeSeconds: number;
+  buckets?: UptimeBucket[];
+};
+
+export type ServiceUptime = {
+  id: string;
+  name: string;
+  section?: string;
+  state: HealthState;
+  sla: Record<"24h" | "7d" | "30d", number | null>;
+  report: UptimeReport;
+};
+
+/**
+ * Last background check result per service ID, shared by all service cards
+ */
+export const healthStatus = reactive<Record<string, HealthStatus>>({});
+
+/**
+ * Uptime of the last 24 hours per service ID, in hourly buckets for the status bar
+ */
+export const uptimeStatus = reactive<Record<string, ServiceUptime>>({});
+
+let users = 0;
+let events: EventSource | null = null;
+let pollInterval: ReturnType<typeof setInterval> | null = null;
+
+async function loadHealth() {
+  try {
+    const res = await fetch("/api/health/status");
+    const data: { services: HealthStatus[] } = await res.json();
+    for (const id of Object.keys(healthStatus)) {
+      delete healthStatus[id];
+    }
+    for (const s of data.services) {
+      healthStatus[s.id] = s;
+    }
+  } catch (e) {
+    console.error("Failed to load health status:", e);
+  }
+}
+
+async function loadUptime() {
+  try {
+    const res = await fetch("/api/health/uptime?range=24h&buckets=24");
+    const data: { services: ServiceUptime[] } = await res.json();
+    for (const id of Object.keys(uptimeStatus)) {
+      delete uptimeStatus[id];
+    }
+    for (const s of data.services) {
+      uptimeStatus[s.id] = s;
+    }
+  } catch (e) {
+    console.error("Failed to load uptime:", e);
+  }
+}
+
+function refresh() {
+  loadHealth();
+  loadUptime();
+}
+
+/**
+ * Start following health changes. herbst checks services in the background
+ * and sends a "health" event when one goes up or down; polling is only a fallback.
+ * Every call must be paired with unwatchHealth().
+ */
+export function watchHealth(): void {
+  users++;
+  if (users > 1) return;
+
+  refresh();
+  // Also moves the status bar along while nothing changes
+  pollInterval = setInterval(refresh, 60000);
+  events = new EventSource("/api/events");
+  events.addEventListener("health", refresh);
+  // New or changed services are checked right after a config reload
+  events.addEventListener("reload", refresh);
+}
+
+export function unwatchHealth(): void {
+  users--;
+  if (users > 0) return;
+
+  if (pollInterval) {
+    clearInterval(pollInterval);
+    pollInterval = null;
+  }
+  events?.close();
+  events = null;
+}
@@ -1,4 +1,5 @@
 export type Service = {
+  id: string;
   name: string;
   url: string;
   icon?: string;
@@ -37,11 +38,14 @@ export type DockerConfig = {
   enabled: boolean;
   socketPath: string;
   agentsConfigured: boolean;
+  actionsEnabled: boolean;
 };
 
 export type SystemConfig = {
   enabled: boolean;
   diskPath: string;
+  disks: string[];
+  interfaces: string[] | null;
 };
 
 export type DockerContainer = {
@@ -51,6 +55,18 @@ export type DockerContainer = {
   state: string;
   status: string;
   created: number;
+  stats?: ContainerStats;
+};
+
+export type ContainerStats = {
+  cpuPercent: number;
+  memoryUsage: number;
+  memoryLimit: number;
+  memoryPercent: number;
+  netRx: number;
+  netTx: number;
+  blockRead: number;
+  blockWrite: number;
 };
 
 export type ClockConfig = {